@@ -0,0 +1,68 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package dockertest
+
+import (
+	"strings"
+
+	dc "github.com/ory/dockertest/v3/docker"
+)
+
+// dockerHubRegistry is the name credentials for Docker Hub are stored under.
+const dockerHubRegistry = "https://index.docker.io/v1/"
+
+// registryOf returns the registry repository is pulled from, in the form the docker CLI stores credentials for it:
+// the registry host, or dockerHubRegistry for images on Docker Hub.
+func registryOf(repository string) string {
+	i := strings.Index(repository, "/")
+	if i < 0 {
+		return dockerHubRegistry
+	}
+	host := repository[:i]
+	if !strings.ContainsAny(host, ".:") && host != "localhost" {
+		return dockerHubRegistry
+	}
+	if host == "docker.io" || host == "index.docker.io" || host == "registry-1.docker.io" {
+		return dockerHubRegistry
+	}
+	return host
+}
+
+// authFor resolves the credentials for pulling repository like the docker CLI does: from the credential helper
+// configured for its registry, the credsStore, or the auths of the docker config file, in this order. Without
+// credentials the image is pulled anonymously, so lookup failures are not fatal.
+func authFor(repository string) dc.AuthConfiguration {
+	registry := registryOf(repository)
+
+	if auth, err := dc.NewAuthConfigurationsFromCredsHelpers(registry); err == nil {
+		return *auth
+	}
+
+	auths, err := dc.NewAuthConfigurationsFromDockerCfg()
+	if err != nil {
+		return dc.AuthConfiguration{}
+	}
+	for key, auth := range auths.Configs {
+		if registryKey(key) == registry {
+			return auth
+		}
+	}
+	return dc.AuthConfiguration{}
+}
+
+// registryKey normalizes the keys of the auths in the docker config file, which may be URLs such as
+// "https://ghcr.io/v2/", to the form returned by registryOf.
+func registryKey(key string) string {
+	if key == dockerHubRegistry {
+		return key
+	}
+	key = strings.TrimPrefix(strings.TrimPrefix(key, "https://"), "http://")
+	if i := strings.Index(key, "/"); i >= 0 {
+		key = key[:i]
+	}
+	if key == "docker.io" || key == "index.docker.io" || key == "registry-1.docker.io" {
+		return dockerHubRegistry
+	}
+	return key
+}
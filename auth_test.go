@@ -0,0 +1,48 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package dockertest
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	dc "github.com/ory/dockertest/v3/docker"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCredentialHelper(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake credential helper is a shell script")
+	}
+	fake, pool := newFakePool(t)
+	fake.RequireAuth("registry.example.com/private", dc.AuthConfiguration{Username: "user", Password: "secret"})
+	fake.RequireAuth("private", dc.AuthConfiguration{IdentityToken: "token"})
+
+	testdata, err := filepath.Abs(filepath.Join("docker", "testdata"))
+	require.Nil(t, err)
+	config := t.TempDir()
+	require.Nil(t, os.WriteFile(filepath.Join(config, "config.json"), []byte(`{"credsStore":"fake"}`), 0o600))
+	t.Setenv("DOCKER_CONFIG", config)
+	t.Setenv("PATH", testdata+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	_, err = pool.Run("registry.example.com/private", "latest", nil)
+	require.Nil(t, err)
+	_, err = pool.Run("private", "latest", nil)
+	require.Nil(t, err)
+
+	_, err = pool.RunWithOptions(&RunOptions{
+		Repository: "registry.example.com/private",
+		Tag:        "1",
+		Auth:       dc.AuthConfiguration{Username: "user", Password: "wrong"},
+	})
+	require.ErrorIs(t, err, ErrPullAuth)
+
+	require.Nil(t, os.WriteFile(filepath.Join(config, "config.json"), []byte(`{"credHelpers":{"registry.example.com":"fake"}}`), 0o600))
+	_, err = pool.Run("registry.example.com/private", "2", nil)
+	require.Nil(t, err)
+	_, err = pool.Run("private", "2", nil)
+	require.ErrorIs(t, err, ErrPullAuth)
+}
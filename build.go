@@ -0,0 +1,349 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package dockertest
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	dc "github.com/ory/dockertest/v3/docker"
+	"github.com/ory/dockertest/v3/docker/pkg/fileutils"
+)
+
+// BuildDigestLabel is the label holding the digest of the build context and options of images built by
+// BuildAndRunWithBuildOptions. The build is skipped if the image to build already has the same digest, unless
+// BuildOptions.ForceRebuild is set.
+const BuildDigestLabel = "org.ory.dockertest.build-digest"
+
+// contextModTime is the modification time of all files of in-memory build contexts, which keeps the contexts of
+// identical files identical.
+var contextModTime = time.Unix(0, 0)
+
+// inMemory reports whether the build context is assembled in memory rather than read from ContextDir by the client.
+func (o *BuildOptions) inMemory() bool {
+	return o.DockerfileContent != "" || o.ContextFS != nil || len(o.ContextFiles) > 0
+}
+
+// dockerfile returns the path of the Dockerfile within the build context.
+func (o *BuildOptions) dockerfile() string {
+	if o.Dockerfile == "" {
+		return "Dockerfile"
+	}
+	return contextPath(o.Dockerfile)
+}
+
+// buildImage builds the image described by o and tags it with name, unless the image tagged with name was built from
+// the same build context and options before.
+func (d *Pool) buildImage(ctx context.Context, o *BuildOptions, name string) error {
+	opts := dc.BuildImageOptions{
+		Name:        name,
+		Dockerfile:  o.Dockerfile,
+		ContextDir:  o.ContextDir,
+		BuildArgs:   o.BuildArgs,
+		Platform:    o.Platform,
+		Target:      o.Target,
+		Labels:      o.Labels,
+		NoCache:     o.NoCache,
+		Pull:        o.Pull,
+		CacheFrom:   o.CacheFrom,
+		NetworkMode: o.NetworkMode,
+		Ulimits:     o.Ulimits,
+		Memory:      o.Memory,
+		AuthConfigs: o.AuthConfigs,
+		Secrets:     o.Secrets,
+		SSH:         o.SSH,
+		Context:     ctx,
+	}
+	if o.BuildKit || len(o.Secrets) > 0 || len(o.SSH) > 0 {
+		opts.Version = dc.BuilderBuildKit
+	}
+
+	// the context is read twice, to compute its digest and to send it
+	var archive []byte
+	var content io.ReadCloser
+	var err error
+	switch {
+	case o.inMemory():
+		if archive, err = o.buildContext(); err == nil {
+			content = io.NopCloser(bytes.NewReader(archive))
+		}
+		opts.Dockerfile = o.dockerfile()
+	case o.ContextDir != "":
+		// BuildImage archives ContextDir once more when sending it, instead of holding the archive in memory
+		content, err = dc.CreateTarStream(o.ContextDir, o.Dockerfile)
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to assemble build context: %w", err)
+	}
+
+	if content != nil {
+		h := sha256.New()
+		_, err := io.Copy(h, content)
+		content.Close()
+		if err != nil {
+			return fmt.Errorf("Failed to assemble build context: %w", err)
+		}
+		digest, err := buildDigest(h, &opts)
+		if err != nil {
+			return fmt.Errorf("Failed to assemble build context: %w", err)
+		}
+
+		if !o.ForceRebuild && !o.NoCache && !o.Pull {
+			img, err := d.Client.InspectImageWithContext(name, ctx)
+			if err == nil && img.Config != nil && img.Config.Labels[BuildDigestLabel] == digest {
+				return nil
+			}
+		}
+
+		if archive != nil {
+			opts.ContextDir, opts.InputStream = "", bytes.NewReader(archive)
+		}
+		opts.Labels = make(map[string]string, len(o.Labels)+1)
+		for k, v := range o.Labels {
+			opts.Labels[k] = v
+		}
+		opts.Labels[BuildDigestLabel] = digest
+	}
+
+	p := d.newProgress()
+	opts.OutputStream, opts.RawJSONStream = p, true
+	err = d.Client.BuildImage(opts)
+	if perr := p.Close(); err == nil && perr != nil {
+		err = &BuildError{Image: name, Output: p.output(), Err: perr}
+	}
+	return err
+}
+
+// buildDigest returns the digest of the build context written to h so far and of the options of opts that change
+// the image built from it. Secrets are identified by the digest of their content, SSH agents only by their ID.
+func buildDigest(h hash.Hash, opts *dc.BuildImageOptions) (string, error) {
+	args := make(map[string]string, len(opts.BuildArgs))
+	for _, arg := range opts.BuildArgs {
+		args[arg.Name] = arg.Value
+	}
+	secrets := make(map[string]string, len(opts.Secrets))
+	for _, secret := range opts.Secrets {
+		data, err := os.ReadFile(secret.Src)
+		if err != nil {
+			return "", fmt.Errorf("Failed to read secret %s: %w", secret.ID, err)
+		}
+		sum := sha256.Sum256(data)
+		secrets[secret.ID] = hex.EncodeToString(sum[:])
+	}
+	var ssh []string
+	for _, agent := range opts.SSH {
+		id := agent.ID
+		if id == "" {
+			id = "default"
+		}
+		ssh = append(ssh, id)
+	}
+	sort.Strings(ssh)
+
+	// encoding/json sorts map keys, so the encoding is stable.
+	b, err := json.Marshal(struct {
+		Dockerfile  string
+		BuildArgs   map[string]string
+		Labels      map[string]string
+		Target      string
+		Platform    string
+		CacheFrom   []string          `json:",omitempty"`
+		NetworkMode string            `json:",omitempty"`
+		Ulimits     []dc.ULimit       `json:",omitempty"`
+		Memory      int64             `json:",omitempty"`
+		Version     dc.BuilderVersion `json:",omitempty"`
+		Secrets     map[string]string `json:",omitempty"`
+		SSH         []string          `json:",omitempty"`
+	}{
+		Dockerfile:  opts.Dockerfile,
+		BuildArgs:   args,
+		Labels:      opts.Labels,
+		Target:      opts.Target,
+		Platform:    opts.Platform,
+		CacheFrom:   opts.CacheFrom,
+		NetworkMode: opts.NetworkMode,
+		Ulimits:     opts.Ulimits,
+		Memory:      opts.Memory,
+		Version:     opts.Version,
+		Secrets:     secrets,
+		SSH:         ssh,
+	})
+	if err != nil {
+		return "", err
+	}
+	h.Write(b)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// maxContextLinks is the number of symbolic links to directories buildContext follows within each other, which
+// stops it on links pointing to one of their parents.
+const maxContextLinks = 40
+
+type contextEntry struct {
+	data []byte
+	mode fs.FileMode
+}
+
+// buildContext assembles the build context described by o as a tar archive: the files of ContextFS or ContextDir,
+// overlaid with ContextFiles and DockerfileContent, without the files excluded by the .dockerignore file among
+// them. Like with the docker CLI, the Dockerfile and the .dockerignore file are always sent.
+func (o *BuildOptions) buildContext() ([]byte, error) {
+	base := o.ContextFS
+	if base == nil && o.ContextDir != "" {
+		base = os.DirFS(o.ContextDir)
+	} else if base != nil && o.ContextDir != "" {
+		return nil, errors.New("ContextDir and ContextFS are mutually exclusive")
+	}
+
+	ignore, ok := o.ContextFiles[".dockerignore"]
+	if !ok && base != nil {
+		data, err := fs.ReadFile(base, ".dockerignore")
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		ignore = data
+	}
+	pm, err := fileutils.NewPatternMatcher(readDockerignore(ignore))
+	if err != nil {
+		return nil, err
+	}
+	dockerfile := o.dockerfile()
+	excluded := func(name string) (bool, error) {
+		if name == dockerfile || name == ".dockerignore" {
+			return false, nil
+		}
+		return pm.Matches(name)
+	}
+
+	entries := map[string]contextEntry{}
+	var walk func(root string, links int) error
+	walk = func(root string, links int) error {
+		return fs.WalkDir(base, root, func(name string, d fs.DirEntry, err error) error {
+			if err != nil || name == "." {
+				return err
+			}
+			if skip, err := excluded(name); err != nil {
+				return err
+			} else if skip {
+				if d.IsDir() && !pm.Exclusions() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+
+			// symbolic links are followed, as fs.FS has no notion of them
+			info, err := fs.Stat(base, name)
+			if err != nil {
+				return err
+			}
+			switch {
+			case info.IsDir():
+				entries[name] = contextEntry{mode: fs.ModeDir | info.Mode().Perm()}
+				if name != root && d.Type()&fs.ModeSymlink != 0 {
+					// fs.WalkDir does not descend into symbolic links to directories
+					if links >= maxContextLinks {
+						return fmt.Errorf("too many levels of symbolic links: %s", name)
+					}
+					return walk(name, links+1)
+				}
+			case info.Mode().IsRegular():
+				data, err := fs.ReadFile(base, name)
+				if err != nil {
+					return err
+				}
+				entries[name] = contextEntry{data: data, mode: info.Mode().Perm()}
+			}
+			return nil
+		})
+	}
+	if base != nil {
+		if err := walk(".", 0); err != nil {
+			return nil, err
+		}
+	}
+
+	for name, data := range o.ContextFiles {
+		name = contextPath(name)
+		if skip, err := excluded(name); err != nil {
+			return nil, err
+		} else if !skip {
+			entries[name] = contextEntry{data: data, mode: 0o644}
+		}
+	}
+	if o.DockerfileContent != "" {
+		entries[dockerfile] = contextEntry{data: []byte(o.DockerfileContent), mode: 0o644}
+	}
+
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range names {
+		e := entries[name]
+		hdr := &tar.Header{Name: name, Mode: int64(e.mode.Perm()), ModTime: contextModTime}
+		if e.mode.IsDir() {
+			hdr.Typeflag, hdr.Name = tar.TypeDir, name+"/"
+		} else {
+			hdr.Typeflag, hdr.Size = tar.TypeReg, int64(len(e.data))
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(e.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// contextPath returns name as a clean, slash separated path relative to the root of the build context.
+func contextPath(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(name)), "/")
+}
+
+// readDockerignore returns the patterns of a .dockerignore file, which are matched against slash separated paths
+// relative to the root of the build context.
+func readDockerignore(data []byte) []string {
+	var patterns []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		pattern := strings.TrimSpace(scanner.Text())
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+		exclusion := strings.HasPrefix(pattern, "!")
+		if exclusion {
+			pattern = strings.TrimSpace(pattern[1:])
+		}
+		pattern = contextPath(pattern)
+		if exclusion {
+			pattern = "!" + pattern
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns
+}
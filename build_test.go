@@ -0,0 +1,263 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package dockertest
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	dc "github.com/ory/dockertest/v3/docker"
+	"github.com/ory/dockertest/v3/docker/pkg/jsonmessage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildInMemory(t *testing.T) {
+	fake, pool := newFakePool(t)
+
+	resource, err := pool.BuildAndRunWithBuildOptions(&BuildOptions{
+		DockerfileContent: "FROM alpine\nCOPY . /app\n",
+		ContextFiles: map[string][]byte{
+			"main.go":        []byte("package main\n"),
+			"debug.log":      []byte("noise"),
+			".dockerignore":  []byte("# logs\n*.log\n/secrets\n!secrets/public.pem\n"),
+			"secrets/id_rsa": []byte("private"),
+		},
+		ContextFS: fstest.MapFS{
+			"config/app.yaml":    {Data: []byte("port: 8080\n")},
+			"secrets/public.pem": {Data: []byte("public")},
+			"Dockerfile":         {Data: []byte("FROM scratch\n")},
+		},
+	}, &RunOptions{Name: "in-memory-build"})
+	require.Nil(t, err)
+	assert.Equal(t, "in-memory-build:latest", resource.Container.Config.Image)
+
+	builds := fake.Builds()
+	require.Len(t, builds, 1)
+	assert.Equal(t, []string{"in-memory-build"}, builds[0].Tags)
+	assert.Equal(t, map[string][]byte{
+		"Dockerfile":         []byte("FROM alpine\nCOPY . /app\n"),
+		".dockerignore":      []byte("# logs\n*.log\n/secrets\n!secrets/public.pem\n"),
+		"main.go":            []byte("package main\n"),
+		"config/app.yaml":    []byte("port: 8080\n"),
+		"secrets/public.pem": []byte("public"),
+	}, builds[0].Context)
+
+	_, err = pool.BuildAndRunWithBuildOptions(&BuildOptions{
+		Dockerfile: "build/Dockerfile",
+		ContextFS:  fstest.MapFS{"build/Dockerfile": {Data: []byte("FROM alpine\nRUN exit 3\n")}},
+	}, &RunOptions{Name: "failing-build"})
+	assert.ErrorContains(t, err, "returned a non-zero code: 3")
+
+	_, err = pool.BuildAndRunWithBuildOptions(&BuildOptions{
+		ContextDir: t.TempDir(),
+		ContextFS:  fstest.MapFS{},
+	}, &RunOptions{Name: "ambiguous-build"})
+	assert.ErrorContains(t, err, "Failed to assemble build context")
+}
+
+func TestBuildContextSymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("creating symbolic links requires privileges on Windows")
+	}
+	fake, pool := newFakePool(t)
+	dir := t.TempDir()
+	require.Nil(t, os.MkdirAll(filepath.Join(dir, "shared", "config"), 0o755))
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "shared", "config", "app.yaml"), []byte("port: 8080\n"), 0o644))
+	require.Nil(t, os.Symlink("shared", filepath.Join(dir, "linked")))
+
+	_, err := pool.BuildAndRunWithBuildOptions(&BuildOptions{
+		ContextDir:        dir,
+		DockerfileContent: "FROM alpine\nCOPY linked /app\n",
+	}, &RunOptions{Name: "symlinked-build"})
+	require.Nil(t, err)
+	builds := fake.Builds()
+	require.Len(t, builds, 1)
+	assert.Equal(t, map[string][]byte{
+		"Dockerfile":             []byte("FROM alpine\nCOPY linked /app\n"),
+		"shared/config/app.yaml": []byte("port: 8080\n"),
+		"linked/config/app.yaml": []byte("port: 8080\n"),
+	}, builds[0].Context)
+
+	require.Nil(t, os.Symlink(".", filepath.Join(dir, "loop")))
+	_, err = pool.BuildAndRunWithBuildOptions(&BuildOptions{
+		ContextDir:        dir,
+		DockerfileContent: "FROM alpine\n",
+	}, &RunOptions{Name: "looping-build"})
+	assert.ErrorContains(t, err, "too many levels of symbolic links")
+}
+
+func TestBuildCache(t *testing.T) {
+	fake, pool := newFakePool(t)
+	dir := t.TempDir()
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM alpine\nARG VERSION\n"), 0o644))
+
+	build := func(buildOpts *BuildOptions) {
+		t.Helper()
+		resource, err := pool.BuildAndRunWithBuildOptions(buildOpts, &RunOptions{Name: "cached"})
+		require.Nil(t, err)
+		require.Nil(t, pool.Purge(resource))
+	}
+
+	build(&BuildOptions{ContextDir: dir})
+	build(&BuildOptions{ContextDir: dir})
+	builds := fake.Builds()
+	require.Len(t, builds, 1)
+	digest := builds[0].Labels[BuildDigestLabel]
+	assert.Len(t, digest, 64)
+
+	build(&BuildOptions{ContextDir: dir, BuildArgs: []dc.BuildArg{{Name: "VERSION", Value: "2"}}})
+	require.Len(t, fake.Builds(), 2)
+	assert.NotEqual(t, digest, fake.Builds()[1].Labels[BuildDigestLabel])
+
+	build(&BuildOptions{ContextDir: dir})
+	require.Len(t, fake.Builds(), 3)
+	assert.Equal(t, digest, fake.Builds()[2].Labels[BuildDigestLabel])
+	build(&BuildOptions{ContextDir: dir, ForceRebuild: true})
+	require.Len(t, fake.Builds(), 4)
+
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "app.conf"), []byte("port=8080\n"), 0o644))
+	build(&BuildOptions{ContextDir: dir})
+	require.Len(t, fake.Builds(), 5)
+	assert.NotEqual(t, digest, fake.Builds()[4].Labels[BuildDigestLabel])
+
+	limited := func() *BuildOptions {
+		return &BuildOptions{
+			ContextDir:  dir,
+			CacheFrom:   []string{"cached:latest"},
+			NetworkMode: "none",
+			Ulimits:     []dc.ULimit{{Name: "nofile", Soft: 1024, Hard: 1024}},
+			Memory:      1 << 30,
+		}
+	}
+	build(limited())
+	require.Len(t, fake.Builds(), 6)
+	build(limited())
+	require.Len(t, fake.Builds(), 6)
+
+	build(&BuildOptions{ContextDir: dir, BuildKit: true})
+	require.Len(t, fake.Builds(), 7)
+
+	secret := filepath.Join(t.TempDir(), "token")
+	require.Nil(t, os.WriteFile(secret, []byte("s3cr3t"), 0o600))
+	withSecret := func() *BuildOptions {
+		return &BuildOptions{ContextDir: dir, Secrets: []dc.BuildSecret{{ID: "token", Src: secret}}}
+	}
+	build(withSecret())
+	require.Len(t, fake.Builds(), 8)
+	build(withSecret())
+	require.Len(t, fake.Builds(), 8)
+	require.Nil(t, os.WriteFile(secret, []byte("rotated"), 0o600))
+	build(withSecret())
+	require.Len(t, fake.Builds(), 9)
+}
+
+func TestBuildOptions(t *testing.T) {
+	fake, pool := newFakePool(t)
+
+	dockerfile := "FROM golang AS build\nRUN echo building\nFROM build AS test\nRUN echo testing\nFROM alpine\nRUN echo packaging\n"
+	resource, err := pool.BuildAndRunWithBuildOptions(&BuildOptions{
+		DockerfileContent: dockerfile,
+		Target:            "test",
+		Tag:               "app:test",
+		Labels:            map[string]string{"org.example.suite": "integration"},
+		CacheFrom:         []string{"app:cache"},
+		NetworkMode:       "host",
+	}, &RunOptions{Name: "app-test"})
+	require.Nil(t, err)
+	assert.Equal(t, "app:test", resource.Container.Config.Image)
+	assert.Equal(t, "/app-test", resource.Container.Name)
+
+	builds := fake.Builds()
+	require.Len(t, builds, 1)
+	assert.Equal(t, []string{"app:test"}, builds[0].Tags)
+	assert.Equal(t, "test", builds[0].Target)
+	assert.Equal(t, "integration", builds[0].Labels["org.example.suite"])
+	assert.Contains(t, builds[0].Labels, BuildDigestLabel)
+	assert.Equal(t, []string{"app:cache"}, builds[0].CacheFrom)
+	assert.Equal(t, "host", builds[0].NetworkMode)
+	assert.False(t, builds[0].NoCache)
+
+	var out bytes.Buffer
+	pool.Progress = func(msg jsonmessage.JSONMessage) { out.WriteString(msg.Stream) }
+	_, err = pool.BuildAndRunWithBuildOptions(&BuildOptions{
+		DockerfileContent: dockerfile,
+		Target:            "test",
+		Tag:               "app:test",
+		Labels:            map[string]string{"org.example.suite": "integration"},
+		NoCache:           true,
+	}, &RunOptions{Name: "app-test-nocache"})
+	require.Nil(t, err)
+	require.Len(t, fake.Builds(), 2)
+	assert.True(t, fake.Builds()[1].NoCache)
+	assert.Contains(t, out.String(), "Step 4/4 : RUN echo testing\n")
+	assert.NotContains(t, out.String(), "packaging")
+
+	_, err = pool.BuildAndRunWithBuildOptions(&BuildOptions{
+		DockerfileContent: dockerfile,
+		Target:            "missing",
+	}, &RunOptions{Name: "missing-target"})
+	assert.ErrorContains(t, err, "failed to reach build target missing")
+}
+
+func TestBuildKitSecretMount(t *testing.T) {
+	requireDocker(t)
+	secret := filepath.Join(t.TempDir(), "token")
+	require.Nil(t, os.WriteFile(secret, []byte("s3cr3t"), 0o600))
+
+	// the build fails unless the secret is mounted with its content, without leaving it in the image
+	resource, err := pool.BuildAndRunWithBuildOptions(&BuildOptions{
+		DockerfileContent: "FROM alpine:3.16\n" +
+			"RUN --mount=type=secret,id=token test \"$(cat /run/secrets/token)\" = s3cr3t\n" +
+			"CMD [\"tail\", \"-f\", \"/dev/null\"]\n",
+		Secrets: []dc.BuildSecret{{ID: "token", Src: secret}},
+	}, &RunOptions{Name: "buildkit-secret"})
+	require.Nil(t, err)
+	defer pool.Purge(resource)
+
+	exitCode, err := resource.Exec([]string{"test", "-e", "/run/secrets/token"}, ExecOptions{})
+	require.Nil(t, err)
+	assert.Equal(t, 1, exitCode)
+}
+
+func TestBuildKit(t *testing.T) {
+	_, pool := newFakePool(t)
+
+	var mu sync.Mutex
+	var out strings.Builder
+	pool.Progress = func(msg jsonmessage.JSONMessage) {
+		mu.Lock()
+		defer mu.Unlock()
+		out.WriteString(msg.Stream)
+	}
+
+	_, err := pool.BuildAndRunWithBuildOptions(&BuildOptions{
+		DockerfileContent: "FROM golang\nRUN echo fetching\nRUN echo cloning\n",
+		BuildKit:          true,
+	}, &RunOptions{Name: "buildkit"})
+	require.Nil(t, err)
+	mu.Lock()
+	assert.Contains(t, out.String(), "#2 [2/3] RUN echo fetching\n#2 fetching\n#2 DONE\n")
+	mu.Unlock()
+
+	_, err = pool.BuildAndRunWithBuildOptions(&BuildOptions{
+		DockerfileContent: "FROM golang\nRUN echo compiling && exit 1\n",
+		BuildKit:          true,
+	}, &RunOptions{Name: "failing-buildkit"})
+	var buildErr *BuildError
+	require.ErrorAs(t, err, &buildErr)
+	assert.Equal(t, "[2/2] RUN echo compiling && exit 1\ncompiling\n", buildErr.Output)
+	assert.Contains(t, err.Error(), "did not complete successfully: exit code: 1")
+
+	_, err = pool.BuildAndRunWithBuildOptions(&BuildOptions{
+		DockerfileContent: "FROM golang\nRUN --mount=type=secret,id=token cat /run/secrets/token\n",
+	}, &RunOptions{Name: "legacy-mount"})
+	assert.ErrorContains(t, err, "the --mount option requires BuildKit")
+}
@@ -0,0 +1,552 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package dockertest
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/cli/cli/compose/loader"
+	composetypes "github.com/docker/cli/cli/compose/types"
+	dc "github.com/ory/dockertest/v3/docker"
+)
+
+// Labels set on everything created by Pool.Compose, the same ones docker compose uses.
+const (
+	ComposeProjectLabel = "com.docker.compose.project"
+	ComposeServiceLabel = "com.docker.compose.service"
+	ComposeNetworkLabel = "com.docker.compose.network"
+	ComposeVolumeLabel  = "com.docker.compose.volume"
+)
+
+var composeProjectNameInvalid = regexp.MustCompile(`[^a-z0-9_-]`)
+
+// ComposeProject is a docker compose project started by Pool.Compose.
+type ComposeProject struct {
+	// Name is the project name, used as prefix for network and volume names.
+	Name string
+
+	// Services holds the container of every service by service name.
+	Services map[string]*Resource
+
+	// Networks holds every network by the name used in the compose file, including "default".
+	Networks map[string]*Network
+
+	// Volumes holds every named volume by the name used in the compose file.
+	Volumes map[string]*Volume
+
+	pool     *Pool
+	started  []string
+	networks []*Network
+	volumes  []*Volume
+}
+
+// Service returns the container of the named service.
+func (p *ComposeProject) Service(name string) (*Resource, bool) {
+	r, ok := p.Services[name]
+	return r, ok
+}
+
+// Close removes all services, followed by the networks and volumes created for the project. External networks and
+// volumes are left alone. Calling Close again only retries what could not be removed before.
+func (p *ComposeProject) Close() error {
+	var failed error
+	var started []string
+	for i := len(p.started) - 1; i >= 0; i-- {
+		if err := p.pool.Purge(p.Services[p.started[i]]); err != nil {
+			failed = fmt.Errorf("Failed to remove service %s: %w", p.started[i], err)
+			started = append([]string{p.started[i]}, started...)
+		}
+	}
+	p.started = started
+
+	var networks []*Network
+	for _, n := range p.networks {
+		if err := p.pool.RemoveNetwork(n); err != nil {
+			failed = fmt.Errorf("Failed to remove network %s: %w", n.Network.Name, err)
+			networks = append(networks, n)
+		}
+	}
+	p.networks = networks
+
+	var volumes []*Volume
+	for _, v := range p.volumes {
+		if err := p.pool.RemoveVolume(v); err != nil {
+			failed = fmt.Errorf("Failed to remove volume %s: %w", v.Volume.Name, err)
+			volumes = append(volumes, v)
+		}
+	}
+	p.volumes = volumes
+	return failed
+}
+
+// Compose starts the project described by the given compose (v3) files, which are merged in order. Networks and
+// volumes are created first, then every service is started once the services it depends on are running and, if
+// they have a healthcheck, healthy.
+//
+// The project name is taken from COMPOSE_PROJECT_NAME, or else from the directory of the first file, which is also
+// the base for relative paths. Like RunWithOptions, all ports exposed by a service are published on random host
+// ports, unless the compose file maps them explicitly. Swarm specific settings (deploy, configs, secrets) are ignored.
+//
+// If a service fails to start, everything created so far is removed again.
+func (d *Pool) Compose(ctx context.Context, files ...string) (*ComposeProject, error) {
+	if len(files) == 0 {
+		return nil, fmt.Errorf("No compose files specified")
+	}
+
+	workingDir, err := filepath.Abs(filepath.Dir(files[0]))
+	if err != nil {
+		return nil, err
+	}
+
+	details := composetypes.ConfigDetails{
+		WorkingDir:  workingDir,
+		Environment: map[string]string{},
+	}
+	for _, kv := range os.Environ() {
+		if parts := strings.SplitN(kv, "=", 2); len(parts) == 2 {
+			details.Environment[parts[0]] = parts[1]
+		}
+	}
+	for _, file := range files {
+		source, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		parsed, err := loader.ParseYAML(source)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse %s: %w", file, err)
+		}
+		details.ConfigFiles = append(details.ConfigFiles, composetypes.ConfigFile{Filename: file, Config: parsed})
+	}
+
+	cfg, err := loader.Load(details)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load compose files: %w", err)
+	}
+
+	name := details.Environment["COMPOSE_PROJECT_NAME"]
+	if name == "" {
+		name = filepath.Base(workingDir)
+	}
+	name = composeProjectNameInvalid.ReplaceAllString(strings.ToLower(name), "")
+
+	order, err := composeStartOrder(cfg.Services)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &ComposeProject{
+		Name:     name,
+		Services: map[string]*Resource{},
+		Networks: map[string]*Network{},
+		Volumes:  map[string]*Volume{},
+		pool:     d,
+	}
+
+	if err := p.up(ctx, cfg, order, workingDir); err != nil {
+		if closeErr := p.Close(); closeErr != nil {
+			return nil, fmt.Errorf("%w (cleaning up also failed: %s)", err, closeErr)
+		}
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func (p *ComposeProject) up(ctx context.Context, cfg *composetypes.Config, order []composetypes.ServiceConfig, workingDir string) error {
+	networks := cfg.Networks
+	if networks == nil {
+		networks = map[string]composetypes.NetworkConfig{}
+	}
+	for _, svc := range cfg.Services {
+		if len(svc.Networks) == 0 && svc.NetworkMode == "" {
+			if _, ok := networks["default"]; !ok {
+				networks["default"] = composetypes.NetworkConfig{}
+			}
+		}
+	}
+	for _, key := range sortedKeys(networks) {
+		if err := p.createNetwork(ctx, key, networks[key]); err != nil {
+			return err
+		}
+	}
+	for _, key := range sortedKeys(cfg.Volumes) {
+		if err := p.createVolume(ctx, key, cfg.Volumes[key]); err != nil {
+			return err
+		}
+	}
+
+	for _, svc := range order {
+		for _, dep := range svc.DependsOn {
+			if err := waitForDependency(ctx, p.Services[dep]); err != nil {
+				return fmt.Errorf("Service %s depends on %s, which did not become healthy: %w", svc.Name, dep, err)
+			}
+		}
+		r, err := p.startService(ctx, svc, workingDir)
+		if err != nil {
+			return fmt.Errorf("Failed to start service %s: %w", svc.Name, err)
+		}
+		p.Services[svc.Name] = r
+		p.started = append(p.started, svc.Name)
+	}
+
+	return nil
+}
+
+func (p *ComposeProject) createNetwork(ctx context.Context, key string, cfg composetypes.NetworkConfig) error {
+	name := cfg.Name
+	if name == "" {
+		name = p.Name + "_" + key
+	}
+
+	if cfg.External.External {
+		if cfg.External.Name != "" {
+			name = cfg.External.Name
+		}
+		found, err := p.pool.NetworksByName(name)
+		if err != nil {
+			return err
+		}
+		if len(found) == 0 {
+			return fmt.Errorf("External network %s not found", name)
+		}
+		p.Networks[key] = &found[0]
+		return nil
+	}
+
+	n, err := p.pool.CreateNetworkContext(ctx, name, func(opts *dc.CreateNetworkOptions) {
+		opts.Driver = cfg.Driver
+		opts.Internal = cfg.Internal
+		opts.Labels = map[string]string{ComposeProjectLabel: p.Name, ComposeNetworkLabel: key}
+		for k, v := range cfg.Labels {
+			opts.Labels[k] = v
+		}
+		if len(cfg.DriverOpts) > 0 {
+			opts.Options = map[string]interface{}{}
+			for k, v := range cfg.DriverOpts {
+				opts.Options[k] = v
+			}
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to create network %s: %w", name, err)
+	}
+	p.Networks[key] = n
+	p.networks = append(p.networks, n)
+	return nil
+}
+
+func (p *ComposeProject) createVolume(ctx context.Context, key string, cfg composetypes.VolumeConfig) error {
+	name := cfg.Name
+	if name == "" {
+		name = p.Name + "_" + key
+	}
+
+	if cfg.External.External {
+		if cfg.External.Name != "" {
+			name = cfg.External.Name
+		}
+		v, err := p.pool.Client.InspectVolume(name)
+		if err != nil {
+			return fmt.Errorf("External volume %s not found: %w", name, err)
+		}
+		p.Volumes[key] = &Volume{pool: p.pool, Volume: v}
+		return nil
+	}
+
+	v, err := p.pool.CreateVolumeContext(ctx, name, func(opts *dc.CreateVolumeOptions) {
+		opts.Driver = cfg.Driver
+		opts.DriverOpts = cfg.DriverOpts
+		opts.Labels = map[string]string{ComposeProjectLabel: p.Name, ComposeVolumeLabel: key}
+		for k, v := range cfg.Labels {
+			opts.Labels[k] = v
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to create volume %s: %w", name, err)
+	}
+	p.Volumes[key] = v
+	p.volumes = append(p.volumes, v)
+	return nil
+}
+
+func (p *ComposeProject) startService(ctx context.Context, svc composetypes.ServiceConfig, workingDir string) (*Resource, error) {
+	image := svc.Image
+	if svc.Build.Context != "" {
+		if image == "" {
+			image = p.Name + "-" + svc.Name
+		}
+		if err := p.buildService(ctx, svc, image, workingDir); err != nil {
+			return nil, err
+		}
+	}
+	if image == "" {
+		return nil, fmt.Errorf("Service has neither image nor build context")
+	}
+	if strings.Contains(image, "@") {
+		return nil, fmt.Errorf("Image digests are not supported: %s", image)
+	}
+	repository, tag := image, ""
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		repository, tag = image[:i], image[i+1:]
+	}
+
+	opts := &RunOptions{
+		Name:        svc.ContainerName,
+		Hostname:    svc.Hostname,
+		Repository:  repository,
+		Tag:         tag,
+		Entrypoint:  svc.Entrypoint,
+		Cmd:         svc.Command,
+		ExtraHosts:  svc.ExtraHosts,
+		CapAdd:      svc.CapAdd,
+		SecurityOpt: svc.SecurityOpt,
+		DNS:         svc.DNS,
+		WorkingDir:  svc.WorkingDir,
+		Privileged:  svc.Privileged,
+		User:        svc.User,
+		Tty:         svc.Tty,
+		Labels:      map[string]string{ComposeProjectLabel: p.Name, ComposeServiceLabel: svc.Name},
+	}
+	for k, v := range svc.Labels {
+		opts.Labels[k] = v
+	}
+	for _, k := range sortedKeys(svc.Environment) {
+		if v := svc.Environment[k]; v != nil {
+			opts.Env = append(opts.Env, k+"="+*v)
+		}
+	}
+	for _, port := range svc.Expose {
+		opts.ExposedPorts = append(opts.ExposedPorts, port)
+	}
+	for _, port := range svc.Ports {
+		protocol := port.Protocol
+		if protocol == "" {
+			protocol = "tcp"
+		}
+		target := dc.Port(fmt.Sprintf("%d/%s", port.Target, protocol))
+		opts.ExposedPorts = append(opts.ExposedPorts, string(target))
+		if port.Published > 0 {
+			if opts.PortBindings == nil {
+				opts.PortBindings = map[dc.Port][]dc.PortBinding{}
+			}
+			opts.PortBindings[target] = append(opts.PortBindings[target], dc.PortBinding{HostPort: fmt.Sprint(port.Published)})
+		}
+	}
+
+	var anonymous []string
+	tmpfs := map[string]string{}
+	for _, v := range svc.Volumes {
+		source := v.Source
+		switch v.Type {
+		case "tmpfs":
+			tmpfs[v.Target] = ""
+			continue
+		case "volume":
+			if source == "" {
+				anonymous = append(anonymous, v.Target)
+				continue
+			}
+			if named, ok := p.Volumes[source]; ok {
+				source = named.Volume.Name
+			}
+		}
+		mount := source + ":" + v.Target
+		if v.ReadOnly {
+			mount += ":ro"
+		}
+		opts.Mounts = append(opts.Mounts, mount)
+	}
+	for _, t := range svc.Tmpfs {
+		tmpfs[t] = ""
+	}
+
+	serviceNetworks := svc.Networks
+	if len(serviceNetworks) == 0 && svc.NetworkMode == "" {
+		serviceNetworks = map[string]*composetypes.ServiceNetworkConfig{"default": nil}
+	}
+	for _, key := range sortedKeys(serviceNetworks) {
+		n, ok := p.Networks[key]
+		if !ok {
+			return nil, fmt.Errorf("Network %s is not defined", key)
+		}
+		opts.Networks = append(opts.Networks, n)
+	}
+
+	createOpts, err := p.pool.createContainerOptions(opts, func(hc *dc.HostConfig) {
+		hc.NetworkMode = svc.NetworkMode
+		hc.CapDrop = svc.CapDrop
+		hc.DNSSearch = svc.DNSSearch
+		hc.ReadonlyRootfs = svc.ReadOnly
+		hc.Init = svc.Init != nil && *svc.Init
+		hc.Sysctls = svc.Sysctls
+		if len(tmpfs) > 0 {
+			hc.Tmpfs = tmpfs
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// other services reach this one by its name on every network it joins
+	for _, key := range sortedKeys(serviceNetworks) {
+		endpoint := &dc.EndpointConfig{Aliases: []string{svc.Name}}
+		if cfg := serviceNetworks[key]; cfg != nil {
+			endpoint.Aliases = append(endpoint.Aliases, cfg.Aliases...)
+			if cfg.Ipv4Address != "" || cfg.Ipv6Address != "" {
+				endpoint.IPAMConfig = &dc.EndpointIPAMConfig{IPv4Address: cfg.Ipv4Address, IPv6Address: cfg.Ipv6Address}
+			}
+		}
+		createOpts.NetworkingConfig.EndpointsConfig[p.Networks[key].Network.ID] = endpoint
+	}
+
+	if len(anonymous) > 0 {
+		createOpts.Config.Volumes = map[string]struct{}{}
+		for _, target := range anonymous {
+			createOpts.Config.Volumes[target] = struct{}{}
+		}
+	}
+	if svc.StopSignal != "" {
+		createOpts.Config.StopSignal = svc.StopSignal
+	}
+	if hc := svc.HealthCheck; hc != nil {
+		createOpts.Config.Healthcheck = composeHealthcheck(hc)
+	}
+
+	return p.pool.runContainer(ctx, opts, createOpts)
+}
+
+func (p *ComposeProject) buildService(ctx context.Context, svc composetypes.ServiceConfig, image string, workingDir string) error {
+	contextDir := svc.Build.Context
+	if !filepath.IsAbs(contextDir) {
+		contextDir = filepath.Join(workingDir, contextDir)
+	}
+	dockerfile := svc.Build.Dockerfile
+	if dockerfile == "" {
+		dockerfile = "Dockerfile"
+	}
+
+	var args []dc.BuildArg
+	for _, k := range sortedKeys(svc.Build.Args) {
+		if v := svc.Build.Args[k]; v != nil {
+			args = append(args, dc.BuildArg{Name: k, Value: *v})
+		}
+	}
+
+	progress := p.pool.newProgress()
+	err := p.pool.Client.BuildImage(dc.BuildImageOptions{
+		Name:          image,
+		Dockerfile:    dockerfile,
+		ContextDir:    contextDir,
+		BuildArgs:     args,
+		Labels:        svc.Build.Labels,
+		CacheFrom:     svc.Build.CacheFrom,
+		Target:        svc.Build.Target,
+		NetworkMode:   svc.Build.Network,
+		OutputStream:  progress,
+		RawJSONStream: true,
+		Context:       ctx,
+	})
+	if perr := progress.Close(); err == nil && perr != nil {
+		return &BuildError{Image: image, Output: progress.output(), Err: perr}
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to build image %s: %w", image, err)
+	}
+	return nil
+}
+
+func composeHealthcheck(hc *composetypes.HealthCheckConfig) *dc.HealthConfig {
+	if hc.Disable {
+		return &dc.HealthConfig{Test: []string{"NONE"}}
+	}
+
+	cfg := &dc.HealthConfig{Test: hc.Test}
+	if hc.Interval != nil {
+		cfg.Interval = time.Duration(*hc.Interval)
+	}
+	if hc.Timeout != nil {
+		cfg.Timeout = time.Duration(*hc.Timeout)
+	}
+	if hc.StartPeriod != nil {
+		cfg.StartPeriod = time.Duration(*hc.StartPeriod)
+	}
+	if hc.Retries != nil {
+		cfg.Retries = int(*hc.Retries)
+	}
+	return cfg
+}
+
+// waitForDependency waits until r is healthy, if it has a healthcheck.
+func waitForDependency(ctx context.Context, r *Resource) error {
+	hc := r.Container.Config.Healthcheck
+	if hc == nil || len(hc.Test) == 0 || hc.Test[0] == "NONE" {
+		return nil
+	}
+	return ForHealthy().WaitUntilReady(ctx, r)
+}
+
+// composeStartOrder sorts services so that every service comes after the services it depends on.
+func composeStartOrder(services []composetypes.ServiceConfig) ([]composetypes.ServiceConfig, error) {
+	byName := map[string]composetypes.ServiceConfig{}
+	for _, svc := range services {
+		byName[svc.Name] = svc
+	}
+
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := map[string]int{}
+	var order []composetypes.ServiceConfig
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case done:
+			return nil
+		case visiting:
+			return fmt.Errorf("Circular dependency between services: %s", strings.Join(append(path, name), " -> "))
+		}
+		svc, ok := byName[name]
+		if !ok {
+			return fmt.Errorf("Service %s depends on undefined service %s", path[len(path)-1], name)
+		}
+		state[name] = visiting
+		for _, dep := range svc.DependsOn {
+			if err := visit(dep, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = done
+		order = append(order, svc)
+		return nil
+	}
+
+	for _, name := range sortedKeys(byName) {
+		if err := visit(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// sortedKeys returns the keys of a map with string keys in order, so that compose projects start up the same way
+// every time.
+func sortedKeys(m interface{}) []string {
+	v := reflect.ValueOf(m)
+	keys := make([]string, 0, v.Len())
+	for _, k := range v.MapKeys() {
+		keys = append(keys, k.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,138 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package dockertest
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+
+	dc "github.com/ory/dockertest/v3/docker"
+	"github.com/ory/dockertest/v3/fakedocker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompose(t *testing.T) {
+	fake, pool := newFakePool(t)
+
+	// pg_isready succeeds if a container of the project answers to the host name on one of its networks
+	var mu sync.Mutex
+	var execs [][]string
+	fake.SetBehavior("postgres", fakedocker.Behavior{Exec: func(cmd []string) fakedocker.ExecResult {
+		mu.Lock()
+		execs = append(execs, cmd)
+		mu.Unlock()
+
+		if len(cmd) != 5 || cmd[0] != "pg_isready" || cmd[1] != "-h" {
+			return fakedocker.ExecResult{ExitCode: 127}
+		}
+		containers, err := pool.Client.ListContainers(dc.ListContainersOptions{
+			Filters: map[string][]string{"label": {ComposeProjectLabel}},
+		})
+		if err != nil {
+			return fakedocker.ExecResult{Stderr: err.Error(), ExitCode: 3}
+		}
+		for _, c := range containers {
+			container, _ := fake.Container(c.ID)
+			for _, n := range container.NetworkSettings.Networks {
+				for _, alias := range n.Aliases {
+					if alias == cmd[2] {
+						return fakedocker.ExecResult{Stdout: cmd[2] + ":5432 - accepting connections\n"}
+					}
+				}
+			}
+		}
+		return fakedocker.ExecResult{Stderr: cmd[2] + ":5432 - no response\n", ExitCode: 2}
+	}})
+
+	dir := t.TempDir()
+	composePath := dir + "/docker-compose.yml"
+	require.Nil(t, os.WriteFile(composePath, []byte(`
+services:
+  db:
+    image: postgres:9.5
+    environment:
+      POSTGRES_PASSWORD: secret
+    healthcheck:
+      test: ["CMD", "pg_isready", "-U", "postgres"]
+      interval: 1s
+      retries: 60
+    volumes:
+      - data:/var/lib/postgresql/data
+    networks:
+      backend:
+        aliases:
+          - database
+  client:
+    image: postgres:9.5
+    command: tail -f /dev/null
+    depends_on:
+      - db
+    networks:
+      - backend
+volumes:
+  data:
+networks:
+  backend:
+`), 0o644))
+
+	project, err := pool.Compose(context.Background(), composePath)
+	require.Nil(t, err)
+	defer project.Close()
+
+	backend, ok := project.Networks["backend"]
+	require.True(t, ok)
+	assert.Equal(t, project.Name+"_backend", backend.Network.Name)
+
+	db, ok := project.Service("db")
+	require.True(t, ok)
+	container, ok := fake.Container(db.Container.ID)
+	require.True(t, ok)
+	require.Len(t, container.NetworkSettings.Networks, 1)
+	assert.Equal(t, backend.Network.ID, container.NetworkSettings.Networks[backend.Network.Name].NetworkID)
+	assert.Equal(t, []string{"db", "database"}, container.NetworkSettings.Networks[backend.Network.Name].Aliases)
+	assert.Contains(t, container.Config.Env, "POSTGRES_PASSWORD=secret")
+	assert.Equal(t, "db", container.Config.Labels[ComposeServiceLabel])
+
+	client, ok := project.Service("client")
+	require.True(t, ok)
+	container, ok = fake.Container(client.Container.ID)
+	require.True(t, ok)
+	require.Len(t, container.NetworkSettings.Networks, 1)
+	assert.Equal(t, []string{"client"}, container.NetworkSettings.Networks[backend.Network.Name].Aliases)
+
+	// services resolve each other by name and alias
+	exitCode, err := client.Exec([]string{"pg_isready", "-h", "db", "-U", "postgres"}, ExecOptions{})
+	require.Nil(t, err)
+	require.Zero(t, exitCode)
+	exitCode, err = client.Exec([]string{"pg_isready", "-h", "database", "-U", "postgres"}, ExecOptions{})
+	require.Nil(t, err)
+	require.Zero(t, exitCode)
+	exitCode, err = client.Exec([]string{"pg_isready", "-h", "cache", "-U", "postgres"}, ExecOptions{})
+	require.Nil(t, err)
+	require.Equal(t, 2, exitCode)
+
+	mu.Lock()
+	assert.Equal(t, [][]string{
+		{"pg_isready", "-h", "db", "-U", "postgres"},
+		{"pg_isready", "-h", "database", "-U", "postgres"},
+		{"pg_isready", "-h", "cache", "-U", "postgres"},
+	}, execs)
+	mu.Unlock()
+
+	require.Nil(t, project.Close())
+	volumes, err := pool.Client.ListVolumes(dc.ListVolumesOptions{
+		Filters: map[string][]string{"label": {ComposeProjectLabel + "=" + project.Name}},
+	})
+	require.Nil(t, err)
+	require.Empty(t, volumes)
+	networks, err := pool.NetworksByName(backend.Network.Name)
+	require.Nil(t, err)
+	require.Empty(t, networks)
+
+	// everything is gone already
+	require.Nil(t, project.Close())
+}
@@ -0,0 +1,133 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package dockertest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	dc "github.com/ory/dockertest/v3/docker"
+)
+
+// dockerContext is the docker endpoint of a docker CLI context, as created by `docker context create`.
+type dockerContext struct {
+	Name          string
+	Host          string
+	SkipTLSVerify bool
+
+	// TLSPath is the directory holding the ca.pem, cert.pem and key.pem of the context, if it has TLS material.
+	TLSPath string
+}
+
+// contextMeta is the meta.json of a docker CLI context.
+type contextMeta struct {
+	Name      string `json:"Name"`
+	Endpoints map[string]struct {
+		Host          string `json:"Host"`
+		SkipTLSVerify bool   `json:"SkipTLSVerify"`
+	} `json:"Endpoints"`
+}
+
+// dockerConfigDir returns the directory of the docker CLI configuration, which is $DOCKER_CONFIG or ~/.docker.
+func dockerConfigDir() string {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return dir
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".docker")
+}
+
+// currentDockerContext returns the context selected with DOCKER_CONTEXT or `docker context use`, or nil if the
+// default context is used, which connects to the default endpoint.
+func currentDockerContext() (*dockerContext, error) {
+	dir := dockerConfigDir()
+	if dir == "" {
+		return nil, nil
+	}
+
+	name := os.Getenv("DOCKER_CONTEXT")
+	if name == "" {
+		data, err := ioutil.ReadFile(filepath.Join(dir, "config.json"))
+		if os.IsNotExist(err) {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		var config struct {
+			CurrentContext string `json:"currentContext"`
+		}
+		if err := json.Unmarshal(data, &config); err != nil {
+			return nil, fmt.Errorf("Failed to parse %s: %w", filepath.Join(dir, "config.json"), err)
+		}
+		name = config.CurrentContext
+	}
+	if name == "" || name == "default" {
+		return nil, nil
+	}
+
+	return loadDockerContext(dir, name)
+}
+
+// loadDockerContext reads the context with the given name from the config directory dir. Contexts are stored in
+// directories named after the SHA-256 digest of their name.
+func loadDockerContext(dir, name string) (*dockerContext, error) {
+	digest := sha256.Sum256([]byte(name))
+	id := hex.EncodeToString(digest[:])
+
+	path := filepath.Join(dir, "contexts", "meta", id, "meta.json")
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("Docker context %q does not exist", name)
+	} else if err != nil {
+		return nil, err
+	}
+
+	var meta contextMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("Failed to parse %s: %w", path, err)
+	}
+	endpoint, ok := meta.Endpoints["docker"]
+	if !ok || endpoint.Host == "" {
+		return nil, fmt.Errorf("Docker context %q has no docker endpoint", name)
+	}
+
+	c := &dockerContext{
+		Name:          name,
+		Host:          endpoint.Host,
+		SkipTLSVerify: endpoint.SkipTLSVerify,
+	}
+	tlsPath := filepath.Join(dir, "contexts", "tls", id, "docker")
+	if _, err := os.Stat(tlsPath); err == nil {
+		c.TLSPath = tlsPath
+	}
+	return c, nil
+}
+
+// newClient creates a client for the endpoint of the context, using its TLS material if it has any.
+func (c *dockerContext) newClient() (*dc.Client, error) {
+	if c.TLSPath == "" {
+		return dc.NewClient(c.Host)
+	}
+
+	client, err := dc.NewTLSClient(c.Host,
+		filepath.Join(c.TLSPath, "cert.pem"),
+		filepath.Join(c.TLSPath, "key.pem"),
+		filepath.Join(c.TLSPath, "ca.pem"))
+	if err != nil {
+		return nil, err
+	}
+	if c.SkipTLSVerify {
+		client.TLSConfig.InsecureSkipVerify = true
+	}
+	return client, nil
+}
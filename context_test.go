@@ -0,0 +1,62 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package dockertest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ory/dockertest/v3/fakedocker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDockerContext(t *testing.T) {
+	fake := fakedocker.NewServer()
+	t.Cleanup(fake.Close)
+	secure := httptest.NewTLSServer(fake.Config.Handler)
+	t.Cleanup(secure.Close)
+
+	config := t.TempDir()
+	writeContext := func(name, host string, tls bool) {
+		digest := sha256.Sum256([]byte(name))
+		id := hex.EncodeToString(digest[:])
+		meta := filepath.Join(config, "contexts", "meta", id)
+		require.Nil(t, os.MkdirAll(meta, 0o700))
+		require.Nil(t, os.WriteFile(filepath.Join(meta, "meta.json"),
+			[]byte(`{"Name":"`+name+`","Endpoints":{"docker":{"Host":"`+host+`","SkipTLSVerify":true}}}`), 0o600))
+		if tls {
+			require.Nil(t, os.MkdirAll(filepath.Join(config, "contexts", "tls", id, "docker"), 0o700))
+		}
+	}
+	writeContext("fake", fake.URL, false)
+	writeContext("secure", secure.URL, true)
+	require.Nil(t, os.WriteFile(filepath.Join(config, "config.json"), []byte(`{"currentContext":"fake"}`), 0o600))
+
+	t.Setenv("DOCKER_CONFIG", config)
+	t.Setenv("DOCKER_MACHINE_NAME", "")
+	t.Setenv("DOCKER_HOST", "")
+	t.Setenv("DOCKER_URL", "")
+	t.Setenv("DOCKER_CERT_PATH", "")
+	t.Setenv("DOCKER_CONTEXT", "")
+
+	pool, err := NewPool("")
+	require.Nil(t, err)
+	assert.Equal(t, fake.URL, pool.Client.Endpoint())
+	require.Nil(t, pool.Client.Ping())
+
+	t.Setenv("DOCKER_CONTEXT", "secure")
+	pool, err = NewPool("")
+	require.Nil(t, err)
+	assert.Equal(t, secure.URL, pool.Client.Endpoint())
+	require.Nil(t, pool.Client.Ping())
+
+	t.Setenv("DOCKER_CONTEXT", "missing")
+	_, err = NewPool("")
+	require.Error(t, err)
+}
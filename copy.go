@@ -0,0 +1,239 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package dockertest
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	dc "github.com/ory/dockertest/v3/docker"
+	"github.com/ory/dockertest/v3/docker/pkg/archive"
+	"github.com/ory/dockertest/v3/docker/pkg/idtools"
+	"github.com/ory/dockertest/v3/docker/types"
+)
+
+// maxSymlinks is the number of symbolic links ReadFile follows before it gives up.
+const maxSymlinks = 40
+
+// rootOwner is the owner of the files copied into a container, like with docker cp.
+var rootOwner = &idtools.IDPair{UID: 0, GID: 0}
+
+// CopyTo copies the file or directory at hostPath into the container at containerPath, like docker cp does:
+//
+//   - If containerPath is an existing directory, the source is copied into it.
+//   - If it does not exist, the source is copied to it, unless it ends with a path separator and the source is a
+//     file, in which case the directory is required to exist.
+//   - If hostPath ends with "/.", the contents of the directory are copied instead of the directory itself.
+//
+// Symbolic links in hostPath are copied as links, and a symbolic link at containerPath is followed. The copied files
+// are owned by root, and paths in the container are relative to its root directory.
+func (r *Resource) CopyTo(ctx context.Context, hostPath, containerPath string) error {
+	hostPath, err := absHostPath(hostPath)
+	if err != nil {
+		return err
+	}
+	srcInfo, err := archive.CopyInfoSourcePath(hostPath, false)
+	if err != nil {
+		return fmt.Errorf("Failed to copy %s to container: %w", hostPath, err)
+	}
+
+	dstInfo := archive.CopyInfo{Path: containerAbsPath(containerPath)}
+	stat, err := r.statPath(ctx, dstInfo.Path)
+	if err == nil && stat.Mode&os.ModeSymlink != 0 {
+		// docker cp writes to the target of a link, so does the extraction into its directory
+		target := resolveLink(path.Clean(dstInfo.Path), stat.LinkTarget)
+		dstInfo.Path = target
+		stat, err = r.statPath(ctx, target)
+	}
+	switch {
+	case err == nil:
+		dstInfo.Exists, dstInfo.IsDir = true, stat.Mode.IsDir()
+	case !isNotFound(err):
+		return fmt.Errorf("Failed to copy %s to container: %w", hostPath, err)
+	}
+
+	sourceDir, sourceBase := archive.SplitPathDirEntry(srcInfo.Path)
+	opts := archive.TarResourceRebaseOpts(sourceBase, srcInfo.RebaseName)
+	opts.ChownOpts = rootOwner
+	content, err := archive.TarWithOptions(sourceDir, opts)
+	if err != nil {
+		return fmt.Errorf("Failed to copy %s to container: %w", hostPath, err)
+	}
+	defer content.Close()
+
+	dstDir, prepared, err := archive.PrepareArchiveCopy(content, srcInfo, dstInfo)
+	if err != nil {
+		return fmt.Errorf("Failed to copy %s to container: %w", hostPath, err)
+	}
+	defer prepared.Close()
+
+	err = r.pool.Client.UploadToContainer(r.Container.ID, dc.UploadToContainerOptions{
+		InputStream:          prepared,
+		Path:                 dstDir,
+		NoOverwriteDirNonDir: true,
+		Context:              ctx,
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to copy %s to container: %w", hostPath, err)
+	}
+	return nil
+}
+
+// CopyFrom copies the file or directory at containerPath out of the container to hostPath, like docker cp does, see
+// CopyTo. The copied files are owned by the current user.
+func (r *Resource) CopyFrom(ctx context.Context, containerPath, hostPath string) error {
+	containerPath = containerAbsPath(containerPath)
+	hostPath, err := absHostPath(hostPath)
+	if err != nil {
+		return err
+	}
+
+	stat, err := r.statPath(ctx, containerPath)
+	if err != nil {
+		return fmt.Errorf("Failed to copy %s from container: %w", containerPath, err)
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(r.pool.Client.DownloadFromContainer(r.Container.ID, dc.DownloadFromContainerOptions{
+			OutputStream: pw,
+			Path:         containerPath,
+			Context:      ctx,
+		}))
+	}()
+	// unblocks the download if the extraction fails
+	defer pr.Close()
+
+	srcInfo := archive.CopyInfo{Path: containerPath, Exists: true, IsDir: stat.Mode.IsDir()}
+	if err := archive.CopyTo(pr, srcInfo, hostPath); err != nil {
+		return fmt.Errorf("Failed to copy %s from container: %w", containerPath, err)
+	}
+	return nil
+}
+
+// WriteFile writes data to the file name in the container, creating it with mode and owned by root if it does not
+// exist. The directory of the file has to exist.
+func (r *Resource) WriteFile(name string, data []byte, mode os.FileMode) error {
+	name = path.Clean(containerAbsPath(name))
+	dir, base := path.Split(name)
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     base,
+		Mode:     int64(mode.Perm()),
+		Size:     int64(len(data)),
+		Uid:      rootOwner.UID,
+		Gid:      rootOwner.GID,
+		ModTime:  time.Now(),
+	})
+	if err == nil {
+		_, err = tw.Write(data)
+	}
+	if err == nil {
+		err = tw.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to write %s to container: %w", name, err)
+	}
+
+	err = r.pool.Client.UploadToContainer(r.Container.ID, dc.UploadToContainerOptions{
+		InputStream:          &buf,
+		Path:                 dir,
+		NoOverwriteDirNonDir: true,
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to write %s to container: %w", name, err)
+	}
+	return nil
+}
+
+// ReadFile returns the contents of the file name in the container, following symbolic links.
+func (r *Resource) ReadFile(name string) ([]byte, error) {
+	p := path.Clean(containerAbsPath(name))
+	for i := 0; i < maxSymlinks; i++ {
+		data, link, err := r.readFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read %s from container: %w", name, err)
+		}
+		if link == "" {
+			return data, nil
+		}
+		p = resolveLink(p, link)
+	}
+	return nil, fmt.Errorf("Failed to read %s from container: too many levels of symbolic links", name)
+}
+
+// readFile returns the contents of the regular file at p, or the target of the symbolic link at p.
+func (r *Resource) readFile(p string) (data []byte, link string, err error) {
+	var buf bytes.Buffer
+	err = r.pool.Client.DownloadFromContainer(r.Container.ID, dc.DownloadFromContainerOptions{
+		OutputStream: &buf,
+		Path:         p,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	tr := tar.NewReader(&buf)
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, "", err
+	}
+	switch hdr.Typeflag {
+	case tar.TypeSymlink:
+		return nil, hdr.Linkname, nil
+	case tar.TypeReg, tar.TypeRegA:
+		data, err := io.ReadAll(tr)
+		return data, "", err
+	case tar.TypeDir:
+		return nil, "", errors.New("is a directory")
+	default:
+		return nil, "", errors.New("not a regular file")
+	}
+}
+
+// statPath returns information about the file, directory or symbolic link at p in the container.
+func (r *Resource) statPath(ctx context.Context, p string) (*types.ContainerPathStat, error) {
+	return r.pool.Client.StatContainerPath(r.Container.ID, dc.StatContainerPathOptions{Path: p, Context: ctx})
+}
+
+// isNotFound reports whether err is a response of the daemon saying that the container or path does not exist.
+func isNotFound(err error) bool {
+	var e *dc.Error
+	return errors.As(err, &e) && e.Status == http.StatusNotFound
+}
+
+// containerAbsPath makes p absolute in the container, keeping a trailing "/" or "/." which tells docker cp to copy
+// into, or the contents of, a directory.
+func containerAbsPath(p string) string {
+	return archive.PreserveTrailingDotOrSeparator(path.Join("/", p), p, '/')
+}
+
+// absHostPath makes p absolute on the host, keeping a trailing separator or "/." like containerAbsPath.
+func absHostPath(p string) (string, error) {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return "", err
+	}
+	return archive.PreserveTrailingDotOrSeparator(abs, p, os.PathSeparator), nil
+}
+
+// resolveLink returns the path the symbolic link at p with target link points to.
+func resolveLink(p, link string) string {
+	if path.IsAbs(link) {
+		return link
+	}
+	return path.Join(path.Dir(p), link)
+}
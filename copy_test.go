@@ -0,0 +1,118 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package dockertest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ory/dockertest/v3/fakedocker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopy(t *testing.T) {
+	fake, pool := newFakePool(t)
+	resource, err := pool.Run("busybox", "latest", nil)
+	require.Nil(t, err)
+	ctx := context.Background()
+
+	src := t.TempDir()
+	require.Nil(t, os.MkdirAll(filepath.Join(src, "app", "conf.d"), 0o755))
+	require.Nil(t, os.WriteFile(filepath.Join(src, "app", "config.yml"), []byte("port: 80\n"), 0o640))
+	require.Nil(t, os.WriteFile(filepath.Join(src, "app", "conf.d", "extra.yml"), []byte("debug: true\n"), 0o644))
+	require.Nil(t, os.Symlink("config.yml", filepath.Join(src, "app", "current.yml")))
+
+	t.Run("directory to new path", func(t *testing.T) {
+		require.Nil(t, resource.CopyTo(ctx, filepath.Join(src, "app"), "/etc/myapp"))
+
+		f, ok := fake.File(resource.Container.ID, "/etc/myapp/config.yml")
+		require.True(t, ok)
+		assert.Equal(t, "port: 80\n", string(f.Data))
+		assert.Equal(t, os.FileMode(0o640), f.Mode)
+		assert.Equal(t, 0, f.UID)
+		f, ok = fake.File(resource.Container.ID, "/etc/myapp/conf.d/extra.yml")
+		require.True(t, ok)
+		assert.Equal(t, "debug: true\n", string(f.Data))
+		f, ok = fake.File(resource.Container.ID, "/etc/myapp/current.yml")
+		require.True(t, ok)
+		assert.Equal(t, "config.yml", f.LinkTarget)
+	})
+
+	t.Run("directory into existing directory", func(t *testing.T) {
+		require.Nil(t, resource.CopyTo(ctx, filepath.Join(src, "app"), "/var"))
+		_, ok := fake.File(resource.Container.ID, "/var/app/config.yml")
+		assert.True(t, ok)
+	})
+
+	t.Run("directory contents", func(t *testing.T) {
+		require.Nil(t, resource.CopyTo(ctx, filepath.Join(src, "app")+"/.", "/root"))
+		_, ok := fake.File(resource.Container.ID, "/root/config.yml")
+		assert.True(t, ok)
+	})
+
+	t.Run("file", func(t *testing.T) {
+		require.Nil(t, resource.CopyTo(ctx, filepath.Join(src, "app", "config.yml"), "/tmp"))
+		_, ok := fake.File(resource.Container.ID, "/tmp/config.yml")
+		assert.True(t, ok)
+
+		require.Nil(t, resource.CopyTo(ctx, filepath.Join(src, "app", "config.yml"), "/tmp/renamed.yml"))
+		_, ok = fake.File(resource.Container.ID, "/tmp/renamed.yml")
+		assert.True(t, ok)
+
+		assert.NotNil(t, resource.CopyTo(ctx, filepath.Join(src, "app", "config.yml"), "/missing/"))
+		assert.NotNil(t, resource.CopyTo(ctx, filepath.Join(src, "app"), "/tmp/renamed.yml"))
+	})
+
+	t.Run("from container", func(t *testing.T) {
+		dst := t.TempDir()
+		require.Nil(t, resource.CopyFrom(ctx, "/etc/myapp", filepath.Join(dst, "out")))
+		data, err := os.ReadFile(filepath.Join(dst, "out", "config.yml"))
+		require.Nil(t, err)
+		assert.Equal(t, "port: 80\n", string(data))
+		link, err := os.Readlink(filepath.Join(dst, "out", "current.yml"))
+		require.Nil(t, err)
+		assert.Equal(t, "config.yml", link)
+
+		require.Nil(t, resource.CopyFrom(ctx, "/etc/myapp/conf.d/extra.yml", dst))
+		data, err = os.ReadFile(filepath.Join(dst, "extra.yml"))
+		require.Nil(t, err)
+		assert.Equal(t, "debug: true\n", string(data))
+
+		require.Nil(t, resource.CopyFrom(ctx, "/etc/myapp/conf.d/.", filepath.Join(dst, "contents")))
+		_, err = os.Stat(filepath.Join(dst, "contents", "extra.yml"))
+		assert.Nil(t, err)
+
+		assert.NotNil(t, resource.CopyFrom(ctx, "/etc/missing", dst))
+	})
+}
+
+func TestReadWriteFile(t *testing.T) {
+	fake, pool := newFakePool(t)
+	resource, err := pool.Run("busybox", "latest", nil)
+	require.Nil(t, err)
+
+	require.Nil(t, resource.WriteFile("/etc/motd", []byte("hello\n"), 0o600))
+	f, ok := fake.File(resource.Container.ID, "/etc/motd")
+	require.True(t, ok)
+	assert.Equal(t, os.FileMode(0o600), f.Mode)
+	assert.Equal(t, 0, f.UID)
+
+	data, err := resource.ReadFile("/etc/motd")
+	require.Nil(t, err)
+	assert.Equal(t, "hello\n", string(data))
+
+	require.Nil(t, fake.WriteFile(resource.Container.ID, "/etc/greeting", fakedocker.File{Mode: os.ModeSymlink | 0o777, LinkTarget: "motd"}))
+	data, err = resource.ReadFile("/etc/greeting")
+	require.Nil(t, err)
+	assert.Equal(t, "hello\n", string(data))
+
+	_, err = resource.ReadFile("/etc")
+	assert.ErrorContains(t, err, "is a directory")
+	_, err = resource.ReadFile("/etc/missing")
+	assert.NotNil(t, err)
+	assert.NotNil(t, resource.WriteFile("/missing/motd", []byte("hello\n"), 0o600))
+}
@@ -16,12 +16,19 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"path"
 	"strings"
 )
 
-// ErrCannotParseDockercfg is the error returned by NewAuthConfigurations when the dockercfg cannot be parsed.
-var ErrCannotParseDockercfg = errors.New("Failed to read authentication from dockercfg")
+var (
+	// ErrCannotParseDockercfg is the error returned by NewAuthConfigurations when the dockercfg cannot be parsed.
+	ErrCannotParseDockercfg = errors.New("Failed to read authentication from dockercfg")
+
+	// ErrCredentialsNotFound is the error returned by NewAuthConfigurationsFromCredsHelpers when no credential
+	// helper is configured for a registry, or the helper has no credentials for it.
+	ErrCredentialsNotFound = errors.New("No credentials found")
+)
 
 // AuthConfiguration represents authentication options to use in the PushImage
 // method. It represents the authentication in the Docker index server.
@@ -92,6 +99,96 @@ func NewAuthConfigurationsFromDockerCfg() (*AuthConfigurations, error) {
 	return auths, err
 }
 
+// credentialHelpersConfig represents the credential helpers configured in the
+// config.json file.
+type credentialHelpersConfig struct {
+	CredsStore  string            `json:"credsStore"`
+	CredHelpers map[string]string `json:"credHelpers"`
+}
+
+// credentialHelperResponse is the output of the get command of a credential
+// helper.
+type credentialHelperResponse struct {
+	ServerURL string `json:"ServerURL"`
+	Username  string `json:"Username"`
+	Secret    string `json:"Secret"`
+}
+
+// NewAuthConfigurationsFromCredsHelpers returns the AuthConfiguration of the
+// given registry from the credential helper configured for it in the system
+// config files, which is either the one in credHelpers or the credsStore. The
+// helper is run as docker-credential-<name>, which has to be in the PATH.
+//
+// Registries are identified like the docker CLI does, by their host, e.g.
+// "ghcr.io", or "https://index.docker.io/v1/" for Docker Hub.
+func NewAuthConfigurationsFromCredsHelpers(registry string) (*AuthConfiguration, error) {
+	helper, err := getHelperProviderFromDockerCfg(cfgPaths(os.Getenv("DOCKER_CONFIG"), os.Getenv("HOME")), registry)
+	if err != nil {
+		return nil, err
+	}
+	return getCredentialsFromHelper(helper, registry)
+}
+
+func getHelperProviderFromDockerCfg(pathsToTry []string, registry string) (string, error) {
+	for _, path := range pathsToTry {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var conf credentialHelpersConfig
+		if err := json.Unmarshal(data, &conf); err != nil {
+			return "", err
+		}
+		if helper, ok := conf.CredHelpers[registry]; ok {
+			return helper, nil
+		}
+		if conf.CredsStore != "" {
+			return conf.CredsStore, nil
+		}
+		return "", ErrCredentialsNotFound
+	}
+	return "", fmt.Errorf("No docker configuration found")
+}
+
+// getCredentialsFromHelper runs the get command of the docker-credential-helpers
+// protocol, which reads the server URL from stdin and writes the credentials as
+// JSON to stdout.
+func getCredentialsFromHelper(helper, registry string) (*AuthConfiguration, error) {
+	cmd := exec.Command("docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(registry)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(string(out))
+		if msg == "" {
+			msg = strings.TrimSpace(stderr.String())
+		}
+		if strings.Contains(msg, "credentials not found") {
+			return nil, ErrCredentialsNotFound
+		}
+		if msg == "" {
+			msg = err.Error()
+		}
+		return nil, fmt.Errorf("Failed to get credentials from docker-credential-%s: %s", helper, msg)
+	}
+
+	var resp credentialHelperResponse
+	if err := json.Unmarshal(out, &resp); err != nil {
+		return nil, fmt.Errorf("Failed to decode credentials from docker-credential-%s: %w", helper, err)
+	}
+
+	auth := &AuthConfiguration{ServerAddress: registry}
+	if resp.Username == "<token>" {
+		// identity tokens are stored with this placeholder instead of a username
+		auth.IdentityToken = resp.Secret
+	} else {
+		auth.Username = resp.Username
+		auth.Password = resp.Secret
+	}
+	return auth, nil
+}
+
 // NewAuthConfigurations returns AuthConfigurations from a JSON encoded string in the
 // same format as the .dockercfg file.
 func NewAuthConfigurations(r io.Reader) (*AuthConfigurations, error) {
@@ -0,0 +1,45 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package docker
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAuthConfigurationsFromCredsHelpers(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake credential helper is a shell script")
+	}
+	testdata, err := filepath.Abs("testdata")
+	require.Nil(t, err)
+	config := t.TempDir()
+	t.Setenv("DOCKER_CONFIG", config)
+	t.Setenv("PATH", testdata+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	require.Nil(t, os.WriteFile(filepath.Join(config, "config.json"), []byte(`{"credsStore":"fake"}`), 0o600))
+	auth, err := NewAuthConfigurationsFromCredsHelpers("registry.example.com")
+	require.Nil(t, err)
+	assert.Equal(t, AuthConfiguration{Username: "user", Password: "secret", ServerAddress: "registry.example.com"}, *auth)
+
+	auth, err = NewAuthConfigurationsFromCredsHelpers("https://index.docker.io/v1/")
+	require.Nil(t, err)
+	assert.Equal(t, AuthConfiguration{IdentityToken: "token", ServerAddress: "https://index.docker.io/v1/"}, *auth)
+
+	_, err = NewAuthConfigurationsFromCredsHelpers("ghcr.io")
+	require.ErrorIs(t, err, ErrCredentialsNotFound)
+
+	require.Nil(t, os.WriteFile(filepath.Join(config, "config.json"), []byte(`{"credHelpers":{"registry.example.com":"fake","ghcr.io":"missing"}}`), 0o600))
+	_, err = NewAuthConfigurationsFromCredsHelpers("registry.example.com")
+	require.Nil(t, err)
+	_, err = NewAuthConfigurationsFromCredsHelpers("https://index.docker.io/v1/")
+	require.ErrorIs(t, err, ErrCredentialsNotFound)
+	_, err = NewAuthConfigurationsFromCredsHelpers("ghcr.io")
+	assert.ErrorContains(t, err, "docker-credential-missing")
+}
@@ -0,0 +1,342 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package docker
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// BuilderVersion selects the builder BuildImage uses.
+type BuilderVersion string
+
+const (
+	// BuilderV1 is the legacy builder.
+	BuilderV1 BuilderVersion = "1"
+	// BuilderBuildKit is BuildKit, which is required for secrets and SSH
+	// agent forwarding.
+	BuilderBuildKit BuilderVersion = "2"
+)
+
+// BuildKitTraceID is the ID of the messages of BuildKit builds whose aux
+// holds the progress of the build, see ParseSolveStatus.
+const BuildKitTraceID = "moby.buildkit.trace"
+
+// BuildSecret is a secret BuildKit builds can mount with
+// RUN --mount=type=secret,id=ID.
+type BuildSecret struct {
+	ID string
+	// Src is the file holding the secret.
+	Src string
+}
+
+// BuildSSH is an SSH agent BuildKit builds can use with
+// RUN --mount=type=ssh,id=ID.
+type BuildSSH struct {
+	// ID is "default" if empty.
+	ID string
+	// Socket is the socket of the agent, $SSH_AUTH_SOCK if empty.
+	Socket string
+}
+
+// SolveStatus is the progress of a BuildKit build reported by a single
+// message, see ParseSolveStatus.
+type SolveStatus struct {
+	Vertexes []*Vertex
+	Statuses []*VertexStatus
+	Logs     []*VertexLog
+	Warnings []*VertexWarning
+}
+
+// Vertex is a step of a BuildKit build. It is reported again whenever it
+// changes, e.g. once started and once completed.
+type Vertex struct {
+	Digest    string
+	Inputs    []string
+	Name      string
+	Cached    bool
+	Started   *time.Time
+	Completed *time.Time
+	Error     string
+}
+
+// VertexStatus is the progress of a task of a vertex, e.g. a layer download.
+type VertexStatus struct {
+	ID        string
+	Vertex    string
+	Name      string
+	Current   int64
+	Total     int64
+	Timestamp time.Time
+	Started   *time.Time
+	Completed *time.Time
+}
+
+// VertexLog is output of a vertex. Stream is 1 for stdout and 2 for stderr.
+type VertexLog struct {
+	Vertex    string
+	Timestamp time.Time
+	Stream    int
+	Data      []byte
+}
+
+// VertexWarning is a warning about a vertex, e.g. about a deprecated
+// instruction.
+type VertexWarning struct {
+	Vertex string
+	Level  int
+	Short  []byte
+	Detail [][]byte
+	URL    string
+}
+
+var errInvalidProto = errors.New("invalid protocol buffers message")
+
+// ParseSolveStatus decodes the aux of a message with the ID BuildKitTraceID,
+// which holds a base64 encoded moby.buildkit.v1.StatusResponse.
+func ParseSolveStatus(aux json.RawMessage) (*SolveStatus, error) {
+	var b []byte
+	if err := json.Unmarshal(aux, &b); err != nil {
+		return nil, err
+	}
+	fields, err := protoFields(b)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &SolveStatus{}
+	for _, f := range fields {
+		switch f.num {
+		case 1:
+			v, err := parseVertex(f.data)
+			if err != nil {
+				return nil, err
+			}
+			s.Vertexes = append(s.Vertexes, v)
+		case 2:
+			v, err := parseVertexStatus(f.data)
+			if err != nil {
+				return nil, err
+			}
+			s.Statuses = append(s.Statuses, v)
+		case 3:
+			v, err := parseVertexLog(f.data)
+			if err != nil {
+				return nil, err
+			}
+			s.Logs = append(s.Logs, v)
+		case 4:
+			v, err := parseVertexWarning(f.data)
+			if err != nil {
+				return nil, err
+			}
+			s.Warnings = append(s.Warnings, v)
+		}
+	}
+	return s, nil
+}
+
+func parseVertex(b []byte) (*Vertex, error) {
+	fields, err := protoFields(b)
+	if err != nil {
+		return nil, err
+	}
+	v := &Vertex{}
+	for _, f := range fields {
+		switch f.num {
+		case 1:
+			v.Digest = string(f.data)
+		case 2:
+			v.Inputs = append(v.Inputs, string(f.data))
+		case 3:
+			v.Name = string(f.data)
+		case 4:
+			v.Cached = f.value != 0
+		case 5:
+			v.Started, err = parseTimestampPtr(f.data)
+		case 6:
+			v.Completed, err = parseTimestampPtr(f.data)
+		case 7:
+			v.Error = string(f.data)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+func parseVertexStatus(b []byte) (*VertexStatus, error) {
+	fields, err := protoFields(b)
+	if err != nil {
+		return nil, err
+	}
+	v := &VertexStatus{}
+	for _, f := range fields {
+		switch f.num {
+		case 1:
+			v.ID = string(f.data)
+		case 2:
+			v.Vertex = string(f.data)
+		case 3:
+			v.Name = string(f.data)
+		case 4:
+			v.Current = int64(f.value)
+		case 5:
+			v.Total = int64(f.value)
+		case 6:
+			v.Timestamp, err = parseTimestamp(f.data)
+		case 7:
+			v.Started, err = parseTimestampPtr(f.data)
+		case 8:
+			v.Completed, err = parseTimestampPtr(f.data)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+func parseVertexLog(b []byte) (*VertexLog, error) {
+	fields, err := protoFields(b)
+	if err != nil {
+		return nil, err
+	}
+	v := &VertexLog{}
+	for _, f := range fields {
+		switch f.num {
+		case 1:
+			v.Vertex = string(f.data)
+		case 2:
+			v.Timestamp, err = parseTimestamp(f.data)
+		case 3:
+			v.Stream = int(f.value)
+		case 4:
+			v.Data = f.data
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+func parseVertexWarning(b []byte) (*VertexWarning, error) {
+	fields, err := protoFields(b)
+	if err != nil {
+		return nil, err
+	}
+	v := &VertexWarning{}
+	for _, f := range fields {
+		switch f.num {
+		case 1:
+			v.Vertex = string(f.data)
+		case 2:
+			v.Level = int(f.value)
+		case 3:
+			v.Short = f.data
+		case 4:
+			v.Detail = append(v.Detail, f.data)
+		case 5:
+			v.URL = string(f.data)
+		}
+	}
+	return v, nil
+}
+
+// parseTimestamp decodes a google.protobuf.Timestamp.
+func parseTimestamp(b []byte) (time.Time, error) {
+	fields, err := protoFields(b)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var sec, nsec int64
+	for _, f := range fields {
+		switch f.num {
+		case 1:
+			sec = int64(f.value)
+		case 2:
+			nsec = int64(f.value)
+		}
+	}
+	return time.Unix(sec, nsec), nil
+}
+
+func parseTimestampPtr(b []byte) (*time.Time, error) {
+	t, err := parseTimestamp(b)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// protoField is a field of a protocol buffers message. Varint and fixed
+// size values are held by value, length-delimited ones by data.
+type protoField struct {
+	num   int
+	value uint64
+	data  []byte
+}
+
+// protoFields decodes the fields of the protocol buffers message b.
+func protoFields(b []byte) ([]protoField, error) {
+	var fields []protoField
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, errInvalidProto
+		}
+		b = b[n:]
+
+		f := protoField{num: int(key >> 3)}
+		switch key & 7 {
+		case 0:
+			if f.value, n = binary.Uvarint(b); n <= 0 {
+				return nil, errInvalidProto
+			}
+			b = b[n:]
+		case 1:
+			if len(b) < 8 {
+				return nil, errInvalidProto
+			}
+			f.value, b = binary.LittleEndian.Uint64(b), b[8:]
+		case 2:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || l > uint64(len(b)-n) {
+				return nil, errInvalidProto
+			}
+			f.data, b = b[n:n+int(l)], b[n+int(l):]
+		case 5:
+			if len(b) < 4 {
+				return nil, errInvalidProto
+			}
+			f.value, b = uint64(binary.LittleEndian.Uint32(b)), b[4:]
+		default:
+			return nil, errInvalidProto
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// appendProtoBytes appends the length-delimited field num holding v to b.
+func appendProtoBytes(b []byte, num int, v []byte) []byte {
+	b = appendUvarint(b, uint64(num)<<3|2)
+	b = appendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+// appendProtoVarint appends the varint field num holding v to b.
+func appendProtoVarint(b []byte, num int, v uint64) []byte {
+	b = appendUvarint(b, uint64(num)<<3)
+	return appendUvarint(b, v)
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], v)]...)
+}
@@ -0,0 +1,84 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package docker_test
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+	"time"
+
+	dc "github.com/ory/dockertest/v3/docker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// statusResponse is a moby.buildkit.v1.StatusResponse in the wire format of protocol buffers, with one message of
+// each kind. The vertex has a progress group (field 8), which is not decoded.
+var statusResponse = []string{
+	// vertexes: digest, inputs, name, started, completed, progressGroup
+	"0a530a0b7368613235363a38643262120b7368613235363a356633611a175b322f335d2052554e206563686f206665746368696e672a" +
+		"0b0880e2cfaa0610c0a9d33a32080881e2cfaa06100042070a0567726f7570",
+	// statuses: ID, vertex, current, total, timestamp, started
+	"123a0a0a65787472616374696e67120b7368613235363a38643262208010288020320c0880e2cfaa061080cab5ee013a0b0880e2cfaa06" +
+		"10c0a9d33a",
+	// logs: vertex, timestamp, stream, msg
+	"1a280a0b7368613235363a38643262120c0880e2cfaa0610808c8d9e02180122096665746368696e670a",
+	// warnings: vertex, level, short, detail, url
+	"22730a0b7368613235363a3864326210011a0a64657072656361746564221175736520454e56206b65793d76616c75652a436874747073" +
+		"3a2f2f646f63732e646f636b65722e636f6d2f676f2f646f636b657266696c652f72756c652f6c65676163792d6b65792d76616c7565" +
+		"2d666f726d61742f",
+}
+
+func TestParseSolveStatus(t *testing.T) {
+	var msg []byte
+	for _, part := range statusResponse {
+		b, err := hex.DecodeString(part)
+		require.Nil(t, err)
+		msg = append(msg, b...)
+	}
+	// the daemon sends the message base64 encoded as the aux of a JSON message
+	aux, err := json.Marshal(msg)
+	require.Nil(t, err)
+
+	status, err := dc.ParseSolveStatus(aux)
+	require.Nil(t, err)
+
+	started := time.Unix(1700000000, 123000000)
+	completed := time.Unix(1700000001, 0)
+	assert.Equal(t, []*dc.Vertex{{
+		Digest:    "sha256:8d2b",
+		Inputs:    []string{"sha256:5f3a"},
+		Name:      "[2/3] RUN echo fetching",
+		Started:   &started,
+		Completed: &completed,
+	}}, status.Vertexes)
+	assert.Equal(t, []*dc.VertexStatus{{
+		ID:        "extracting",
+		Vertex:    "sha256:8d2b",
+		Current:   2048,
+		Total:     4096,
+		Timestamp: time.Unix(1700000000, 500000000),
+		Started:   &started,
+	}}, status.Statuses)
+	assert.Equal(t, []*dc.VertexLog{{
+		Vertex:    "sha256:8d2b",
+		Timestamp: time.Unix(1700000000, 600000000),
+		Stream:    1,
+		Data:      []byte("fetching\n"),
+	}}, status.Logs)
+	assert.Equal(t, []*dc.VertexWarning{{
+		Vertex: "sha256:8d2b",
+		Level:  1,
+		Short:  []byte("deprecated"),
+		Detail: [][]byte{[]byte("use ENV key=value")},
+		URL:    "https://docs.docker.com/go/dockerfile/rule/legacy-key-value-format/",
+	}}, status.Warnings)
+
+	// a length beyond the end of the message
+	truncated, err := json.Marshal(msg[:len(msg)-1])
+	require.Nil(t, err)
+	_, err = dc.ParseSolveStatus(truncated)
+	require.Error(t, err)
+}
@@ -58,6 +58,12 @@ var (
 	// ErrInactivityTimeout is returned when a streamable call has been inactive for some time.
 	ErrInactivityTimeout = errors.New("inactivity time exceeded timeout")
 
+	// ErrPortAllocated is the class of API errors caused by a host port that is already in use.
+	ErrPortAllocated = errors.New("port is already allocated")
+
+	// ErrPullAccessDenied is the class of API errors caused by a registry refusing access to an image.
+	ErrPullAccessDenied = errors.New("pull access denied")
+
 	apiVersion112, _ = NewAPIVersion("1.12")
 	apiVersion119, _ = NewAPIVersion("1.19")
 	apiVersion124, _ = NewAPIVersion("1.24")
@@ -463,7 +469,7 @@ func (c *Client) do(method, path string, doOptions doOptions) (*http.Response, e
 	protocol := c.endpointURL.Scheme
 	var u string
 	switch protocol {
-	case unixProtocol, namedPipeProtocol:
+	case unixProtocol, namedPipeProtocol, sshProtocol:
 		u = c.getFakeNativeURL(path)
 	default:
 		u = c.getURL(path)
@@ -569,7 +575,7 @@ func (c *Client) stream(method, path string, streamOptions streamOptions) error
 	subCtx, cancelRequest := context.WithCancel(ctx)
 	defer cancelRequest()
 
-	if protocol == unixProtocol || protocol == namedPipeProtocol {
+	if isNativeProtocol(protocol) {
 		var dial net.Conn
 		dial, err = c.Dialer.Dial(protocol, address)
 		if err != nil {
@@ -707,6 +713,7 @@ type hijackOptions struct {
 	stdout         io.Writer
 	stderr         io.Writer
 	data           interface{}
+	context        context.Context
 }
 
 // CloseWaiter is an interface with methods for closing the underlying resource
@@ -724,6 +731,25 @@ type closerFunc func() error
 
 func (c closerFunc) Close() error { return c() }
 
+// dialHijack opens a connection to the endpoint for a request that takes over
+// the connection.
+func (c *Client) dialHijack() (net.Conn, error) {
+	protocol := c.endpointURL.Scheme
+	address := c.endpointURL.Path
+	if !isNativeProtocol(protocol) {
+		protocol = "tcp"
+		address = c.endpointURL.Host
+	}
+	if c.TLSConfig != nil && !isNativeProtocol(protocol) {
+		netDialer, ok := c.Dialer.(*net.Dialer)
+		if !ok {
+			return nil, ErrTLSNotSupported
+		}
+		return tlsDialWithDialer(netDialer, protocol, address, c.TLSConfig)
+	}
+	return c.Dialer.Dial(protocol, address)
+}
+
 func (c *Client) hijack(method, path string, hijackOptions hijackOptions) (CloseWaiter, error) {
 	if path != "/version" && !c.SkipServerVersionCheck && c.expectedAPIVersion == nil {
 		err := c.checkAPIVersion()
@@ -746,32 +772,27 @@ func (c *Client) hijack(method, path string, hijackOptions hijackOptions) (Close
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Connection", "Upgrade")
 	req.Header.Set("Upgrade", "tcp")
-	protocol := c.endpointURL.Scheme
-	address := c.endpointURL.Path
-	if protocol != unixProtocol && protocol != namedPipeProtocol {
-		protocol = "tcp"
-		address = c.endpointURL.Host
+	dial, err := c.dialHijack()
+	if err != nil {
+		return nil, err
 	}
-	var dial net.Conn
-	if c.TLSConfig != nil && protocol != unixProtocol && protocol != namedPipeProtocol {
-		netDialer, ok := c.Dialer.(*net.Dialer)
-		if !ok {
-			return nil, ErrTLSNotSupported
-		}
-		dial, err = tlsDialWithDialer(netDialer, protocol, address, c.TLSConfig)
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		dial, err = c.Dialer.Dial(protocol, address)
-		if err != nil {
-			return nil, err
-		}
+
+	// make a sub-context so that the connection is torn down once the caller
+	// gives up, or once the hijacked session is over
+	ctx := hijackOptions.context
+	if ctx == nil {
+		ctx = context.Background()
 	}
+	subCtx, cancelRequest := context.WithCancel(ctx)
+	go func() {
+		<-subCtx.Done()
+		dial.Close()
+	}()
 
 	errs := make(chan error, 1)
 	quit := make(chan struct{})
 	go func() {
+		defer cancelRequest()
 		clientconn := httputil.NewClientConn(dial, nil)
 		defer clientconn.Close()
 		clientconn.Do(req)
@@ -842,9 +863,11 @@ func (c *Client) hijack(method, path string, hijackOptions hijackOptions) (Close
 		}
 
 		if errIn != nil {
-			errs <- errIn
+			errs <- chooseError(ctx, errIn)
+		} else if errOut != nil {
+			errs <- chooseError(ctx, errOut)
 		} else {
-			errs <- errOut
+			errs <- nil
 		}
 	}()
 
@@ -859,7 +882,7 @@ func (c *Client) hijack(method, path string, hijackOptions hijackOptions) (Close
 
 func (c *Client) getURL(path string) string {
 	urlStr := strings.TrimRight(c.endpointURL.String(), "/")
-	if c.endpointURL.Scheme == unixProtocol || c.endpointURL.Scheme == namedPipeProtocol {
+	if isNativeProtocol(c.endpointURL.Scheme) {
 		urlStr = ""
 	}
 	if c.requestedAPIVersion != nil {
@@ -868,6 +891,12 @@ func (c *Client) getURL(path string) string {
 	return fmt.Sprintf("%s%s", urlStr, path)
 }
 
+// isNativeProtocol reports whether connections to endpoints with the given
+// scheme are dialed by the Dialer of the client rather than over TCP.
+func isNativeProtocol(protocol string) bool {
+	return protocol == unixProtocol || protocol == namedPipeProtocol || protocol == sshProtocol
+}
+
 // getFakeNativeURL returns the URL needed to make an HTTP request over a UNIX
 // domain socket to the given path.
 func (c *Client) getFakeNativeURL(path string) string {
@@ -964,9 +993,57 @@ func addQueryStringValue(items url.Values, key string, v reflect.Value) {
 }
 
 // Error represents failures in the API. It represents a failure from the API.
+//
+// Errors are classified by their status and message, so that errors.Is(err,
+// ErrNoSuchImage), ErrContainerAlreadyExists, ErrPortAllocated or
+// ErrPullAccessDenied can be used instead of matching the message.
 type Error struct {
 	Status  int
 	Message string
+
+	class error
+}
+
+// Unwrap returns the class of the error, see ClassifyError.
+func (e *Error) Unwrap() error {
+	return e.class
+}
+
+// ClassifyError returns the class of an API error with the given status and
+// message, which is one of ErrNoSuchImage, ErrContainerAlreadyExists and
+// ErrPortAllocated, or nil if it is none of them. It also applies to errors
+// reported within a JSON stream. Use ClassifyPullError for the errors of
+// pulls, which may also be ErrPullAccessDenied.
+func ClassifyError(status int, message string) error {
+	msg := strings.ToLower(message)
+	switch {
+	case strings.Contains(msg, "port is already allocated"),
+		strings.Contains(msg, "address already in use"):
+		return ErrPortAllocated
+	case strings.HasPrefix(msg, "no such image"),
+		strings.Contains(msg, "manifest unknown"):
+		return ErrNoSuchImage
+	case status == http.StatusConflict && strings.Contains(msg, "is already in use by container"):
+		return ErrContainerAlreadyExists
+	}
+	return nil
+}
+
+// ClassifyPullError is ClassifyError for the errors of pulling an image,
+// either returned by PullImage or reported within the JSON stream of a pull or
+// build. A registry refusing access, which is any authentication failure
+// during a pull, is classified as ErrPullAccessDenied.
+func ClassifyPullError(status int, message string) error {
+	msg := strings.ToLower(message)
+	switch {
+	case strings.Contains(msg, "pull access denied"),
+		strings.Contains(msg, "unauthorized"),
+		strings.Contains(msg, "authentication required"),
+		strings.Contains(msg, "requested access to the resource is denied"),
+		status == http.StatusUnauthorized:
+		return ErrPullAccessDenied
+	}
+	return ClassifyError(status, message)
 }
 
 func newError(resp *http.Response) *Error {
@@ -978,12 +1055,12 @@ func newError(resp *http.Response) *Error {
 	if err != nil {
 		return &Error{Status: resp.StatusCode, Message: fmt.Sprintf("cannot read body, err: %v", err)}
 	}
+	message := string(data)
 	var emsg ErrMsg
-	err = json.Unmarshal(data, &emsg)
-	if err != nil {
-		return &Error{Status: resp.StatusCode, Message: string(data)}
+	if err := json.Unmarshal(data, &emsg); err == nil {
+		message = emsg.Message
 	}
-	return &Error{Status: resp.StatusCode, Message: emsg.Message}
+	return &Error{Status: resp.StatusCode, Message: message, class: ClassifyError(resp.StatusCode, message)}
 }
 
 func (e *Error) Error() string {
@@ -998,12 +1075,17 @@ func parseEndpoint(endpoint string, tls bool) (*url.URL, error) {
 	if err != nil {
 		return nil, ErrInvalidEndpoint
 	}
-	if tls && u.Scheme != "unix" {
+	if tls && u.Scheme != unixProtocol && u.Scheme != sshProtocol {
 		u.Scheme = "https"
 	}
 	switch u.Scheme {
 	case unixProtocol, namedPipeProtocol:
 		return u, nil
+	case sshProtocol:
+		if u.Hostname() == "" {
+			return nil, ErrInvalidEndpoint
+		}
+		return u, nil
 	case "http", "https", "tcp":
 		_, port, err := net.SplitHostPort(u.Host)
 		if err != nil {
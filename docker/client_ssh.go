@@ -0,0 +1,262 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package docker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+const sshProtocol = "ssh"
+
+// SSHDialer is a Dialer that tunnels the Engine API through SSH, like the
+// docker CLI does for ssh:// endpoints: it runs `docker system dial-stdio` on
+// the remote host with the ssh binary from the PATH, and talks to the daemon
+// over the standard input and output of that command. Every connection runs
+// its own ssh process, so authentication is left to the SSH configuration and
+// agent of the user.
+type SSHDialer struct {
+	// Host is the host to connect to, optionally with a user, as in user@host.
+	Host string
+
+	// Args are passed to ssh in addition to the ones derived from the
+	// endpoint, e.g. []string{"-i", "/path/to/key"}.
+	Args []string
+
+	// Socket is the path of the daemon's socket on the remote host. The
+	// default socket is used if it is empty.
+	Socket string
+
+	port string
+}
+
+// NewSSHDialer returns an SSHDialer for an endpoint of the form
+// ssh://[user@]host[:port][/path/to/docker.sock].
+func NewSSHDialer(endpoint string) (*SSHDialer, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme != sshProtocol || u.Hostname() == "" {
+		return nil, ErrInvalidEndpoint
+	}
+	return newSSHDialer(u), nil
+}
+
+func newSSHDialer(u *url.URL) *SSHDialer {
+	d := &SSHDialer{Host: u.Hostname(), port: u.Port()}
+	if u.User != nil && u.User.Username() != "" {
+		d.Host = u.User.Username() + "@" + d.Host
+	}
+	if u.Path != "" && u.Path != "/" {
+		d.Socket = u.Path
+	}
+	return d
+}
+
+// Dial starts the tunnel. The network and address are ignored, as the tunnel
+// always leads to the daemon of the remote host.
+func (d *SSHDialer) Dial(network, address string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, address)
+}
+
+// DialContext is like Dial, but kills the ssh process once the context is
+// done, which closes the connection.
+func (d *SSHDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	args := []string{"-o", "ConnectTimeout=30", "-T"}
+	if d.port != "" {
+		args = append(args, "-p", d.port)
+	}
+	args = append(args, d.Args...)
+	args = append(args, "--", d.Host, "docker")
+	if d.Socket != "" {
+		args = append(args, "--host", "unix://"+d.Socket)
+	}
+	args = append(args, "system", "dial-stdio")
+
+	// the pipes are created here rather than with StdinPipe and StdoutPipe, as
+	// only *os.File supports deadlines
+	stdinR, stdinW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	stdoutR, stdoutW, err := os.Pipe()
+	if err != nil {
+		stdinR.Close()
+		stdinW.Close()
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, "ssh", args...)
+	cmd.Stdin = stdinR
+	cmd.Stdout = stdoutW
+	conn := &commandConn{cmd: cmd, stdin: stdinW, stdout: stdoutR, host: d.Host}
+	cmd.Stderr = &conn.stderr
+	err = cmd.Start()
+	stdinR.Close()
+	stdoutW.Close()
+	if err != nil {
+		stdinW.Close()
+		stdoutR.Close()
+		return nil, fmt.Errorf("cannot start ssh tunnel to %s: %w", d.Host, err)
+	}
+	return conn, nil
+}
+
+// initializeSSHClient makes the HTTP client dial through the SSH tunnel.
+func (c *Client) initializeSSHClient(trFunc func() *http.Transport) {
+	if _, ok := c.Dialer.(*SSHDialer); !ok {
+		c.Dialer = newSSHDialer(c.endpointURL)
+	}
+
+	tr := trFunc()
+	tr.Dial = func(network, addr string) (net.Conn, error) {
+		return c.Dialer.Dial(sshProtocol, c.endpointURL.Host)
+	}
+	tr.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if d, ok := c.Dialer.(*SSHDialer); ok {
+			return d.DialContext(ctx, sshProtocol, c.endpointURL.Host)
+		}
+		return c.Dialer.Dial(sshProtocol, c.endpointURL.Host)
+	}
+	c.HTTPClient.Transport = tr
+}
+
+// commandConn is a net.Conn over the standard input and output of a command.
+// Deadlines are set on the pipes where the platform supports it, and kill the
+// command otherwise.
+type commandConn struct {
+	cmd    *exec.Cmd
+	stdin  *os.File
+	stdout *os.File
+	stderr lockedBuffer
+	host   string
+
+	closeOnce sync.Once
+
+	// mu guards kill, the timer of a deadline the pipes do not support
+	mu   sync.Mutex
+	kill *time.Timer
+}
+
+func (c *commandConn) Read(p []byte) (int, error) {
+	n, err := c.stdout.Read(p)
+	if err != nil && err != io.EOF && !errors.Is(err, os.ErrDeadlineExceeded) {
+		if msg := strings.TrimSpace(c.stderr.String()); msg != "" {
+			err = fmt.Errorf("%w (ssh: %s)", err, msg)
+		}
+	}
+	return n, err
+}
+
+func (c *commandConn) Write(p []byte) (int, error) {
+	return c.stdin.Write(p)
+}
+
+// CloseWrite closes the standard input of the command, which ends the request
+// stream of hijacked connections.
+func (c *commandConn) CloseWrite() error {
+	return c.stdin.Close()
+}
+
+func (c *commandConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.stdin.Close()
+		if c.cmd.Process != nil {
+			c.cmd.Process.Kill()
+		}
+		c.cmd.Wait()
+		c.stdout.Close()
+		c.mu.Lock()
+		if c.kill != nil {
+			c.kill.Stop()
+		}
+		c.mu.Unlock()
+	})
+	return nil
+}
+
+func (c *commandConn) LocalAddr() net.Addr {
+	return sshAddr("localhost")
+}
+
+func (c *commandConn) RemoteAddr() net.Addr {
+	return sshAddr(c.host)
+}
+
+func (c *commandConn) SetDeadline(t time.Time) error {
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.SetWriteDeadline(t)
+}
+
+func (c *commandConn) SetReadDeadline(t time.Time) error {
+	if err := c.stdout.SetReadDeadline(t); !errors.Is(err, os.ErrNoDeadline) {
+		return err
+	}
+	c.killAt(t)
+	return nil
+}
+
+func (c *commandConn) SetWriteDeadline(t time.Time) error {
+	if err := c.stdin.SetWriteDeadline(t); !errors.Is(err, os.ErrNoDeadline) {
+		return err
+	}
+	c.killAt(t)
+	return nil
+}
+
+// killAt kills the command at t, for pipes that do not support deadlines. A
+// zero t cancels it.
+func (c *commandConn) killAt(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.kill != nil {
+		c.kill.Stop()
+		c.kill = nil
+	}
+	if t.IsZero() {
+		return
+	}
+	c.kill = time.AfterFunc(time.Until(t), func() {
+		c.cmd.Process.Kill()
+	})
+}
+
+type sshAddr string
+
+func (a sshAddr) Network() string { return sshProtocol }
+func (a sshAddr) String() string  { return string(a) }
+
+// lockedBuffer is a bytes.Buffer that can be written by the command while the
+// connection reads it.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
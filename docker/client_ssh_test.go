@@ -0,0 +1,153 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package docker_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	dc "github.com/ory/dockertest/v3/docker"
+	"github.com/ory/dockertest/v3/fakedocker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSSH(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the ssh stand-in is a shell script")
+	}
+	fake := fakedocker.NewServer()
+	t.Cleanup(fake.Close)
+
+	// ssh is replaced by this test binary, which runs TestSSHHelperProcess to forward stdio to the fake server
+	bin := t.TempDir()
+	test, err := os.Executable()
+	require.Nil(t, err)
+	require.Nil(t, os.WriteFile(filepath.Join(bin, "ssh"),
+		[]byte("#!/bin/sh\nexec \""+test+"\" -test.run='^TestSSHHelperProcess$' -- \"$@\"\n"), 0o700))
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("FAKEDOCKER_SSH_ADDR", fake.Listener.Addr().String())
+
+	client, err := dc.NewClient("ssh://user@build-host:2222")
+	require.Nil(t, err)
+	require.Nil(t, client.Ping())
+
+	events := make(chan *dc.APIEvents, 16)
+	require.Nil(t, client.AddEventListener(events))
+	defer client.RemoveEventListener(events)
+
+	fake.AddImage("busybox:latest")
+	fake.SetBehavior("busybox", fakedocker.Behavior{
+		Exec: func(cmd []string) fakedocker.ExecResult { return fakedocker.ExecResult{Stdout: "hello\n"} },
+	})
+	container, err := client.CreateContainer(dc.CreateContainerOptions{Config: &dc.Config{Image: "busybox"}})
+	require.Nil(t, err)
+	require.Nil(t, client.StartContainer(container.ID, nil))
+
+	exec, err := client.CreateExec(dc.CreateExecOptions{
+		Container:    container.ID,
+		Cmd:          []string{"echo", "hello"},
+		AttachStdout: true,
+	})
+	require.Nil(t, err)
+	var stdout bytes.Buffer
+	require.Nil(t, client.StartExec(exec.ID, dc.StartExecOptions{OutputStream: &stdout}))
+	assert.Equal(t, "hello\n", stdout.String())
+
+	timeout := time.After(5 * time.Second)
+	for started := false; !started; {
+		select {
+		case e := <-events:
+			started = e.Action == "start" && e.Actor.ID == container.ID
+		case <-timeout:
+			t.Fatal("did not receive start event")
+		}
+	}
+
+	require.Nil(t, client.RemoveContainer(dc.RemoveContainerOptions{ID: container.ID, Force: true}))
+}
+
+func TestSSHDialerDeadlineAndContext(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the ssh stand-in is a shell script")
+	}
+
+	// an ssh that connects but never answers
+	bin := t.TempDir()
+	require.Nil(t, os.WriteFile(filepath.Join(bin, "ssh"), []byte("#!/bin/sh\nexec sleep 30\n"), 0o700))
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	dialer, err := dc.NewSSHDialer("ssh://build-host")
+	require.Nil(t, err)
+
+	conn, err := dialer.Dial("ssh", "build-host")
+	require.Nil(t, err)
+	require.Nil(t, conn.SetReadDeadline(time.Now().Add(50*time.Millisecond)))
+	_, err = conn.Read(make([]byte, 1))
+	var netErr net.Error
+	require.ErrorAs(t, err, &netErr)
+	assert.True(t, netErr.Timeout())
+	require.Nil(t, conn.Close())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	conn, err = dialer.DialContext(ctx, "ssh", "build-host")
+	require.Nil(t, err)
+	defer conn.Close()
+	read := make(chan error, 1)
+	go func() {
+		_, err := conn.Read(make([]byte, 1))
+		read <- err
+	}()
+	cancel()
+	select {
+	case err := <-read:
+		require.Error(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("cancelling the context did not close the connection")
+	}
+
+	_, err = dialer.DialContext(ctx, "ssh", "build-host")
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestSSHHelperProcess(t *testing.T) {
+	addr := os.Getenv("FAKEDOCKER_SSH_ADDR")
+	if addr == "" {
+		return
+	}
+
+	args := os.Args
+	for i, arg := range args {
+		if arg == "--" {
+			args = args[i+1:]
+			break
+		}
+	}
+	want := []string{"-o", "ConnectTimeout=30", "-T", "-p", "2222", "--", "user@build-host", "docker", "system", "dial-stdio"}
+	if strings.Join(args, " ") != strings.Join(want, " ") {
+		fmt.Fprintf(os.Stderr, "unexpected arguments: %q\n", args)
+		os.Exit(2)
+	}
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	go func() {
+		_, _ = io.Copy(conn, os.Stdin)
+		_ = conn.(*net.TCPConn).CloseWrite()
+	}()
+	_, _ = io.Copy(os.Stdout, conn)
+	os.Exit(0)
+}
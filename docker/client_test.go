@@ -0,0 +1,36 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package docker_test
+
+import (
+	"net/http"
+	"testing"
+
+	dc "github.com/ory/dockertest/v3/docker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorClass(t *testing.T) {
+	fake, client := newFakeClient(t)
+
+	restore := fake.Fail(http.MethodGet, "/containers/*/json", http.StatusUnauthorized, "unauthorized: authentication required")
+	_, err := client.InspectContainer("any")
+	var apiErr *dc.Error
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusUnauthorized, apiErr.Status)
+	assert.NotErrorIs(t, err, dc.ErrPullAccessDenied)
+	restore()
+
+	restore = fake.Fail(http.MethodPost, "/images/create", http.StatusUnauthorized, "unauthorized: authentication required")
+	err = client.PullImage(dc.PullImageOptions{Repository: "private", Tag: "latest"}, dc.AuthConfiguration{})
+	require.ErrorIs(t, err, dc.ErrPullAccessDenied)
+	restore()
+
+	restore = fake.Fail(http.MethodPost, "/images/create", http.StatusNotFound, "manifest for private:latest not found: manifest unknown")
+	err = client.PullImage(dc.PullImageOptions{Repository: "private", Tag: "latest"}, dc.AuthConfiguration{})
+	require.ErrorIs(t, err, dc.ErrNoSuchImage)
+	assert.NotErrorIs(t, err, dc.ErrPullAccessDenied)
+	restore()
+}
@@ -19,6 +19,10 @@ import (
 // initializeNativeClient initializes the native Unix domain socket client on
 // Unix-style operating systems
 func (c *Client) initializeNativeClient(trFunc func() *http.Transport) {
+	if c.endpointURL.Scheme == sshProtocol {
+		c.initializeSSHClient(trFunc)
+		return
+	}
 	if c.endpointURL.Scheme != unixProtocol {
 		return
 	}
@@ -31,6 +31,10 @@ func (p pipeDialer) Dial(network, address string) (net.Conn, error) {
 
 // initializeNativeClient initializes the native Named Pipe client for Windows
 func (c *Client) initializeNativeClient(trFunc func() *http.Transport) {
+	if c.endpointURL.Scheme == sshProtocol {
+		c.initializeSSHClient(trFunc)
+		return
+	}
 	if c.endpointURL.Scheme != namedPipeProtocol {
 		return
 	}
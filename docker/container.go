@@ -9,6 +9,7 @@ package docker
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -20,6 +21,7 @@ import (
 	"time"
 
 	"github.com/docker/go-units"
+	"github.com/ory/dockertest/v3/docker/types"
 )
 
 // ErrContainerAlreadyExists is the error returned by CreateContainer when the
@@ -1291,6 +1293,43 @@ func (c *Client) DownloadFromContainer(id string, opts DownloadFromContainerOpti
 	})
 }
 
+// StatContainerPathOptions is the set of options that can be used when
+// getting information about a path in the filesystem of a container.
+//
+// See https://docs.docker.com/engine/api/v1.41/#operation/ContainerArchiveInfo
+// for more details.
+type StatContainerPathOptions struct {
+	Path    string `qs:"path"`
+	Context context.Context
+}
+
+// StatContainerPath returns information about the file, directory or symbolic
+// link at a path in the filesystem of a container. Symbolic links are not
+// followed. If the container or the path does not exist, the error is an
+// *Error with status http.StatusNotFound.
+//
+// See https://docs.docker.com/engine/api/v1.41/#operation/ContainerArchiveInfo
+// for more details.
+func (c *Client) StatContainerPath(id string, opts StatContainerPathOptions) (*types.ContainerPathStat, error) {
+	url := fmt.Sprintf("/containers/%s/archive?", id) + queryString(opts)
+	resp, err := c.do(http.MethodHead, url, doOptions{context: opts.Context})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	header := resp.Header.Get("X-Docker-Container-Path-Stat")
+	data, err := base64.StdEncoding.DecodeString(header)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path stat %q: %w", header, err)
+	}
+	var stat types.ContainerPathStat
+	if err := json.Unmarshal(data, &stat); err != nil {
+		return nil, fmt.Errorf("invalid path stat %q: %w", header, err)
+	}
+	return &stat, nil
+}
+
 // CopyFromContainerOptions contains the set of options used for copying
 // files from a container.
 //
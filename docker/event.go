@@ -8,6 +8,7 @@
 package docker
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -16,6 +17,7 @@ import (
 	"net"
 	"net/http"
 	"net/http/httputil"
+	"net/url"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -92,6 +94,129 @@ var (
 	}
 )
 
+// EventsOptions specify the events streamed by Events.
+type EventsOptions struct {
+	// Filters restrict the events, e.g. to the start and die events of a
+	// container with {"container": {id}, "event": {"start", "die"}}.
+	Filters map[string][]string
+
+	// Since replays the past events from the given time on.
+	Since time.Time
+
+	// Until ends the stream once the given time is reached.
+	Until time.Time
+}
+
+// Events streams the events matching opts until ctx is done or Until is
+// reached, after which both channels are closed. Unlike AddEventListener, the
+// events are filtered by the daemon, and every call gets its own stream.
+//
+// Like the event monitor of AddEventListener, Events reconnects from the last
+// event it received if the connection fails or the daemon ends the stream
+// before Until. The error sent on the error channel ends the stream, which
+// happens if the daemon rejects the request or cannot be reached again.
+func (c *Client) Events(ctx context.Context, opts EventsOptions) (<-chan *APIEvents, <-chan error) {
+	events := make(chan *APIEvents)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(events)
+		defer close(errs)
+
+		since := opts.Since
+		for retries := 0; ; {
+			lastSeen, err := c.streamEvents(ctx, opts, since, events)
+			if !lastSeen.IsZero() {
+				since = lastSeen.Add(time.Nanosecond)
+				retries = 0
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			if err == nil {
+				if !opts.Until.IsZero() && !time.Now().Before(opts.Until) {
+					return
+				}
+				// the daemon ended the stream early, e.g. because it is restarting
+				err = io.ErrUnexpectedEOF
+			}
+			var apiErr *Error
+			if errors.As(err, &apiErr) || retries >= maxMonitorConnRetries {
+				errs <- err
+				return
+			}
+
+			waitTime := int64(retryInitialWaitTime * math.Pow(2, float64(retries)))
+			select {
+			case <-time.After(time.Duration(waitTime) * time.Millisecond):
+			case <-ctx.Done():
+				return
+			}
+			retries++
+		}
+	}()
+	return events, errs
+}
+
+// streamEvents sends the events of a single /events request to events, and
+// returns the time of the last one. The error is nil if the daemon ended the
+// stream, which it does once Until is reached.
+func (c *Client) streamEvents(ctx context.Context, opts EventsOptions, since time.Time, events chan<- *APIEvents) (time.Time, error) {
+	query := url.Values{}
+	if !since.IsZero() {
+		query.Set("since", formatEventTime(since))
+	}
+	if !opts.Until.IsZero() {
+		query.Set("until", formatEventTime(opts.Until))
+	}
+	if len(opts.Filters) > 0 {
+		filters, err := json.Marshal(opts.Filters)
+		if err != nil {
+			return time.Time{}, err
+		}
+		query.Set("filters", string(filters))
+	}
+	path := "/events"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	resp, err := c.do(http.MethodGet, path, doOptions{context: ctx})
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer resp.Body.Close()
+
+	var lastSeen time.Time
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var event APIEvents
+		if err := decoder.Decode(&event); err != nil {
+			if err == io.EOF {
+				return lastSeen, nil
+			}
+			return lastSeen, err
+		}
+		transformEvent(&event)
+		if event.TimeNano != 0 {
+			lastSeen = time.Unix(0, event.TimeNano)
+		} else {
+			lastSeen = time.Unix(event.Time, 0)
+		}
+
+		select {
+		case events <- &event:
+		case <-ctx.Done():
+			return lastSeen, ctx.Err()
+		}
+	}
+}
+
+// formatEventTime formats t as the Unix timestamp with nanoseconds the since
+// and until parameters of /events expect.
+func formatEventTime(t time.Time) string {
+	return fmt.Sprintf("%d.%09d", t.Unix(), t.Nanosecond())
+}
+
 // AddEventListener adds a new listener to container events in the Docker API.
 //
 // The parameter is a channel through which events will be sent.
@@ -315,13 +440,13 @@ func (c *Client) eventHijack(startTime int64, eventChan chan *APIEvents, errChan
 	}
 	protocol := c.endpointURL.Scheme
 	address := c.endpointURL.Path
-	if protocol != "unix" && protocol != "npipe" {
+	if !isNativeProtocol(protocol) {
 		protocol = "tcp"
 		address = c.endpointURL.Host
 	}
 	var dial net.Conn
 	var err error
-	if c.TLSConfig == nil {
+	if c.TLSConfig == nil || isNativeProtocol(protocol) {
 		dial, err = c.Dialer.Dial(protocol, address)
 	} else {
 		netDialer, ok := c.Dialer.(*net.Dialer)
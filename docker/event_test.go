@@ -0,0 +1,100 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package docker_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	dc "github.com/ory/dockertest/v3/docker"
+	"github.com/ory/dockertest/v3/fakedocker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newFakeClient(t *testing.T) (*fakedocker.Server, *dc.Client) {
+	fake := fakedocker.NewServer()
+	t.Cleanup(fake.Close)
+
+	client, err := dc.NewClient(fake.URL)
+	require.Nil(t, err)
+	return fake, client
+}
+
+func TestEvents(t *testing.T) {
+	fake, client := newFakeClient(t)
+	fake.AddImage("busybox:latest")
+
+	since := time.Now()
+	container, err := client.CreateContainer(dc.CreateContainerOptions{Config: &dc.Config{Image: "busybox"}})
+	require.Nil(t, err)
+	require.Nil(t, client.RemoveContainer(dc.RemoveContainerOptions{ID: container.ID, Force: true}))
+
+	events, errs := client.Events(context.Background(), dc.EventsOptions{
+		Filters: map[string][]string{"event": {"create", "destroy"}},
+		Since:   since,
+		Until:   time.Now(),
+	})
+	var actions []string
+	for e := range events {
+		actions = append(actions, e.Action)
+	}
+	assert.Nil(t, <-errs)
+	assert.Equal(t, []string{"create", "destroy"}, actions)
+
+	restore := fake.Fail(http.MethodGet, "/events", http.StatusBadRequest, "invalid filter")
+	defer restore()
+	_, errs = client.Events(context.Background(), dc.EventsOptions{})
+	var apiErr *dc.Error
+	require.ErrorAs(t, <-errs, &apiErr)
+	assert.Equal(t, http.StatusBadRequest, apiErr.Status)
+}
+
+func TestEventsReconnect(t *testing.T) {
+	fake := fakedocker.NewServer()
+	t.Cleanup(fake.Close)
+	fake.AddImage("busybox:latest")
+
+	// the first stream ends right away, as if the daemon restarted
+	var streams int32
+	daemon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/events") && atomic.AddInt32(&streams, 1) == 1 {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		fake.Config.Handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(daemon.Close)
+	client, err := dc.NewClient(daemon.URL)
+	require.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	events, errs := client.Events(ctx, dc.EventsOptions{
+		Filters: map[string][]string{"event": {"create"}},
+		Since:   time.Now(),
+	})
+
+	container, err := client.CreateContainer(dc.CreateContainerOptions{Config: &dc.Config{Image: "busybox"}})
+	require.Nil(t, err)
+	select {
+	case e := <-events:
+		assert.Equal(t, container.ID, e.Actor.ID)
+	case err := <-errs:
+		t.Fatalf("event stream failed: %s", err)
+	case <-ctx.Done():
+		t.Fatal("did not receive create event")
+	}
+	assert.GreaterOrEqual(t, atomic.LoadInt32(&streams), int32(2))
+
+	cancel()
+	for range events {
+	}
+	assert.Nil(t, <-errs)
+}
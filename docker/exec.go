@@ -136,6 +136,7 @@ func (c *Client) StartExecNonBlocking(id string, opts StartExecOptions) (CloseWa
 		stdout:         opts.OutputStream,
 		stderr:         opts.ErrorStream,
 		data:           opts,
+		context:        opts.Context,
 	})
 }
 
@@ -190,8 +191,20 @@ type ExecInspect struct {
 //
 // See https://goo.gl/ctMUiW for more details
 func (c *Client) InspectExec(id string) (*ExecInspect, error) {
+	return c.inspectExec(id, doOptions{})
+}
+
+// InspectExecWithContext returns low-level information about the exec command
+// id. The context object can be used to cancel the inspect request.
+//
+// See https://goo.gl/ctMUiW for more details
+func (c *Client) InspectExecWithContext(id string, ctx context.Context) (*ExecInspect, error) {
+	return c.inspectExec(id, doOptions{context: ctx})
+}
+
+func (c *Client) inspectExec(id string, opts doOptions) (*ExecInspect, error) {
 	path := fmt.Sprintf("/exec/%s/json", id)
-	resp, err := c.do("GET", path, doOptions{})
+	resp, err := c.do("GET", path, opts)
 	if err != nil {
 		if e, ok := err.(*Error); ok && e.Status == http.StatusNotFound {
 			return nil, &NoSuchExec{ID: id}
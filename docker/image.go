@@ -200,7 +200,19 @@ func (c *Client) RemoveImageExtended(name string, opts RemoveImageOptions) error
 //
 // See https://goo.gl/ncLTG8 for more details.
 func (c *Client) InspectImage(name string) (*Image, error) {
-	resp, err := c.do("GET", "/images/"+name+"/json", doOptions{})
+	return c.inspectImage(name, doOptions{})
+}
+
+// InspectImageWithContext returns an image by its name or ID. The context
+// object can be used to cancel the inspect request.
+//
+// See https://goo.gl/ncLTG8 for more details.
+func (c *Client) InspectImageWithContext(name string, ctx context.Context) (*Image, error) {
+	return c.inspectImage(name, doOptions{context: ctx})
+}
+
+func (c *Client) inspectImage(name string, opts doOptions) (*Image, error) {
+	resp, err := c.do("GET", "/images/"+name+"/json", opts)
 	if err != nil {
 		if e, ok := err.(*Error); ok && e.Status == http.StatusNotFound {
 			return nil, ErrNoSuchImage
@@ -323,7 +335,12 @@ func (c *Client) PullImage(opts PullImageOptions, auth AuthConfiguration) error
 		opts.Repository = parts[0]
 		opts.Tag = parts[1]
 	}
-	return c.createImage(queryString(&opts), headers, nil, opts.OutputStream, opts.RawJSONStream, opts.InactivityTimeout, opts.Context)
+	err = c.createImage(queryString(&opts), headers, nil, opts.OutputStream, opts.RawJSONStream, opts.InactivityTimeout, opts.Context)
+	var e *Error
+	if errors.As(err, &e) {
+		e.class = ClassifyPullError(e.Status, e.Message)
+	}
+	return err
 }
 
 func (c *Client) createImage(qs string, headers map[string]string, in io.Reader, w io.Writer, rawJSONStream bool, timeout time.Duration, context context.Context) error {
@@ -478,8 +495,11 @@ type BuildImageOptions struct {
 	InactivityTimeout   time.Duration      `qs:"-"`
 	CgroupParent        string             `qs:"cgroupparent"`
 	SecurityOpt         []string           `qs:"securityopt"`
-	Target              string             `gs:"target"`
+	Target              string             `qs:"target"`
 	Platform            string             `qs:"platform"`
+	Version             BuilderVersion     `qs:"version"`
+	Secrets             []BuildSecret      `qs:"-"` // requires BuilderBuildKit
+	SSH                 []BuildSSH         `qs:"-"` // requires BuilderBuildKit
 	Context             context.Context
 }
 
@@ -496,6 +516,11 @@ type BuildArg struct {
 // BuildImage builds an image from a tarball's url or a Dockerfile in the input
 // stream.
 //
+// With Version set to BuilderBuildKit, Secrets and SSH agents are provided to
+// the build through a session. BuildKit reports its progress in messages with
+// the ID BuildKitTraceID, which are only written with RawJSONStream set, see
+// ParseSolveStatus.
+//
 // See https://goo.gl/4nYHwV for more details.
 func (c *Client) BuildImage(opts BuildImageOptions) error {
 	if opts.OutputStream == nil {
@@ -525,6 +550,22 @@ func (c *Client) BuildImage(opts BuildImageOptions) error {
 	}
 	qs := queryString(&opts)
 
+	if len(opts.Secrets) > 0 || len(opts.SSH) > 0 {
+		if opts.Version != BuilderBuildKit {
+			return ErrBuildKitRequired
+		}
+		ctx := opts.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		s, err := c.startSession(ctx, opts.Secrets, opts.SSH)
+		if err != nil {
+			return err
+		}
+		defer s.Close()
+		qs = fmt.Sprintf("%s&%s", qs, url.Values{"session": {s.id}}.Encode())
+	}
+
 	if c.serverAPIVersion.GreaterThanOrEqualTo(apiVersion125) && len(opts.CacheFrom) > 0 {
 		if b, err := json.Marshal(opts.CacheFrom); err == nil {
 			item := url.Values(map[string][]string{})
@@ -8,6 +8,7 @@
 package docker
 
 import (
+	"context"
 	"encoding/json"
 	"net"
 	"strings"
@@ -17,7 +18,15 @@ import (
 //
 // See https://goo.gl/mU7yje for more details.
 func (c *Client) Version() (*Env, error) {
-	resp, err := c.do("GET", "/version", doOptions{})
+	return c.VersionWithContext(context.Background())
+}
+
+// VersionWithContext returns version information about the docker server.
+// The context object can be used to cancel the version request.
+//
+// See https://goo.gl/mU7yje for more details.
+func (c *Client) VersionWithContext(ctx context.Context) (*Env, error) {
+	resp, err := c.do("GET", "/version", doOptions{context: ctx})
 	if err != nil {
 		return nil, err
 	}
@@ -146,7 +155,15 @@ type IndexInfo struct {
 //
 // See https://goo.gl/ElTHi2 for more details.
 func (c *Client) Info() (*DockerInfo, error) {
-	resp, err := c.do("GET", "/info", doOptions{})
+	return c.InfoWithContext(context.Background())
+}
+
+// InfoWithContext returns system-wide information about the Docker server.
+// The context object can be used to cancel the info request.
+//
+// See https://goo.gl/ElTHi2 for more details.
+func (c *Client) InfoWithContext(ctx context.Context) (*DockerInfo, error) {
+	resp, err := c.do("GET", "/info", doOptions{context: ctx})
 	if err != nil {
 		return nil, err
 	}
@@ -91,8 +91,20 @@ func (c *Client) FilteredListNetworks(opts NetworkFilterOpts) ([]Network, error)
 //
 // See https://goo.gl/6GugX3 for more details.
 func (c *Client) NetworkInfo(id string) (*Network, error) {
+	return c.networkInfo(id, doOptions{})
+}
+
+// NetworkInfoWithContext returns information about a network by its ID. The
+// context object can be used to cancel the request.
+//
+// See https://goo.gl/6GugX3 for more details.
+func (c *Client) NetworkInfoWithContext(id string, ctx context.Context) (*Network, error) {
+	return c.networkInfo(id, doOptions{context: ctx})
+}
+
+func (c *Client) networkInfo(id string, opts doOptions) (*Network, error) {
 	path := "/networks/" + id
-	resp, err := c.do("GET", path, doOptions{})
+	resp, err := c.do("GET", path, opts)
 	if err != nil {
 		if e, ok := err.(*Error); ok && e.Status == http.StatusNotFound {
 			return nil, &NoSuchNetwork{ID: id}
@@ -182,7 +194,19 @@ func (c *Client) CreateNetwork(opts CreateNetworkOptions) (*Network, error) {
 //
 // See https://goo.gl/6GugX3 for more details.
 func (c *Client) RemoveNetwork(id string) error {
-	resp, err := c.do("DELETE", "/networks/"+id, doOptions{})
+	return c.removeNetwork(id, doOptions{})
+}
+
+// RemoveNetworkWithContext removes a network or returns an error in case of
+// failure. The context object can be used to cancel the request.
+//
+// See https://goo.gl/6GugX3 for more details.
+func (c *Client) RemoveNetworkWithContext(id string, ctx context.Context) error {
+	return c.removeNetwork(id, doOptions{context: ctx})
+}
+
+func (c *Client) removeNetwork(id string, opts doOptions) error {
+	resp, err := c.do("DELETE", "/networks/"+id, opts)
 	if err != nil {
 		if e, ok := err.(*Error); ok && e.Status == http.StatusNotFound {
 			return &NoSuchNetwork{ID: id}
@@ -260,7 +284,10 @@ func (c *Client) ConnectNetwork(id string, opts NetworkConnectionOptions) error
 //
 // See https://goo.gl/6GugX3 for more details.
 func (c *Client) DisconnectNetwork(id string, opts NetworkConnectionOptions) error {
-	resp, err := c.do("POST", "/networks/"+id+"/disconnect", doOptions{data: opts})
+	resp, err := c.do("POST", "/networks/"+id+"/disconnect", doOptions{
+		data:    opts,
+		context: opts.Context,
+	})
 	if err != nil {
 		if e, ok := err.(*Error); ok && e.Status == http.StatusNotFound {
 			return &NoSuchNetworkOrContainer{NetworkID: id, ContainerID: opts.Container}
@@ -245,17 +245,20 @@ func (jm *JSONMessage) Display(out io.Writer, termInfo termInfo) error {
 	return nil
 }
 
-// DisplayJSONMessagesStream displays a json message stream from `in` to `out`, `isTerminal`
-// describes if `out` is a terminal. If this is the case, it will print `\n` at the end of
-// each line and move the cursor while displaying.
-func DisplayJSONMessagesStream(in io.Reader, out io.Writer, terminalFd uintptr, isTerminal bool, auxCallback func(*json.RawMessage)) error {
-	var (
-		dec = json.NewDecoder(in)
-		ids = make(map[string]int)
-	)
-
-	var termInfo termInfo
+// Displayer displays JSON messages one at a time, the way
+// DisplayJSONMessagesStream displays a stream of them: progress bars of the
+// same ID are updated in place if the output is a terminal.
+type Displayer struct {
+	out        io.Writer
+	terminalFd uintptr
+	termInfo   termInfo
+	ids        map[string]int
+}
 
+// NewDisplayer returns a Displayer writing to `out`, `isTerminal` describes if
+// `out` is the terminal with the file descriptor `terminalFd`.
+func NewDisplayer(out io.Writer, terminalFd uintptr, isTerminal bool) *Displayer {
+	d := &Displayer{out: out, terminalFd: terminalFd, ids: make(map[string]int)}
 	if isTerminal {
 		term := os.Getenv("TERM")
 		if term == "" {
@@ -263,13 +266,65 @@ func DisplayJSONMessagesStream(in io.Reader, out io.Writer, terminalFd uintptr,
 		}
 
 		var err error
-		if termInfo, err = gotty.OpenTermInfo(term); err != nil {
-			termInfo = &noTermInfo{}
+		if d.termInfo, err = gotty.OpenTermInfo(term); err != nil {
+			d.termInfo = &noTermInfo{}
 		}
 	}
+	return d
+}
+
+// Display displays jm, which must not hold Aux.
+func (d *Displayer) Display(jm JSONMessage) error {
+	diff := 0
+	if jm.Progress != nil {
+		progress := *jm.Progress
+		progress.terminalFd = d.terminalFd
+		jm.Progress = &progress
+	}
+	if jm.ID != "" && (jm.Progress != nil || jm.ProgressMessage != "") {
+		line, ok := d.ids[jm.ID]
+		if !ok {
+			// NOTE: This approach of using len(id) to
+			// figure out the number of lines of history
+			// only works as long as we clear the history
+			// when we output something that's not
+			// accounted for in the map, such as a line
+			// with no ID.
+			line = len(d.ids)
+			d.ids[jm.ID] = line
+			if d.termInfo != nil {
+				fmt.Fprintf(d.out, "\n")
+			}
+		}
+		diff = len(d.ids) - line
+		if d.termInfo != nil {
+			cursorUp(d.out, d.termInfo, diff)
+		}
+	} else {
+		// When outputting something that isn't progress
+		// output, clear the history of previous lines. We
+		// don't want progress entries from some previous
+		// operation to be updated (for example, pull -a
+		// with multiple tags).
+		d.ids = make(map[string]int)
+	}
+	err := jm.Display(d.out, d.termInfo)
+	if jm.ID != "" && d.termInfo != nil {
+		cursorDown(d.out, d.termInfo, diff)
+	}
+	return err
+}
+
+// DisplayJSONMessagesStream displays a json message stream from `in` to `out`, `isTerminal`
+// describes if `out` is a terminal. If this is the case, it will print `\n` at the end of
+// each line and move the cursor while displaying.
+func DisplayJSONMessagesStream(in io.Reader, out io.Writer, terminalFd uintptr, isTerminal bool, auxCallback func(*json.RawMessage)) error {
+	var (
+		dec       = json.NewDecoder(in)
+		displayer = NewDisplayer(out, terminalFd, isTerminal)
+	)
 
 	for {
-		diff := 0
 		var jm JSONMessage
 		if err := dec.Decode(&jm); err != nil {
 			if err == io.EOF {
@@ -285,41 +340,7 @@ func DisplayJSONMessagesStream(in io.Reader, out io.Writer, terminalFd uintptr,
 			continue
 		}
 
-		if jm.Progress != nil {
-			jm.Progress.terminalFd = terminalFd
-		}
-		if jm.ID != "" && (jm.Progress != nil || jm.ProgressMessage != "") {
-			line, ok := ids[jm.ID]
-			if !ok {
-				// NOTE: This approach of using len(id) to
-				// figure out the number of lines of history
-				// only works as long as we clear the history
-				// when we output something that's not
-				// accounted for in the map, such as a line
-				// with no ID.
-				line = len(ids)
-				ids[jm.ID] = line
-				if termInfo != nil {
-					fmt.Fprintf(out, "\n")
-				}
-			}
-			diff = len(ids) - line
-			if termInfo != nil {
-				cursorUp(out, termInfo, diff)
-			}
-		} else {
-			// When outputting something that isn't progress
-			// output, clear the history of previous lines. We
-			// don't want progress entries from some previous
-			// operation to be updated (for example, pull -a
-			// with multiple tags).
-			ids = make(map[string]int)
-		}
-		err := jm.Display(out, termInfo)
-		if jm.ID != "" && termInfo != nil {
-			cursorDown(out, termInfo, diff)
-		}
-		if err != nil {
+		if err := displayer.Display(jm); err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,378 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package docker
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+
+	"golang.org/x/net/http2"
+)
+
+// The gRPC methods a session exposes to BuildKit.
+const (
+	healthCheckMethod  = "/grpc.health.v1.Health/Check"
+	getSecretMethod    = "/moby.buildkit.secrets.v1.Secrets/GetSecret"
+	checkAgentMethod   = "/moby.sshforward.v1.SSH/CheckAgent"
+	forwardAgentMethod = "/moby.sshforward.v1.SSH/ForwardAgent"
+)
+
+// The gRPC status codes a session responds with.
+const (
+	grpcOK            = 0
+	grpcNotFound      = 5
+	grpcUnimplemented = 12
+	grpcInternal      = 13
+)
+
+// sshIDHeader is the gRPC metadata holding the ID of the agent to forward.
+const sshIDHeader = "buildkit.ssh.id"
+
+// maxGRPCMessageSize limits the size of the messages BuildKit sends.
+const maxGRPCMessageSize = 16 << 20
+
+// ErrBuildKitRequired is returned by BuildImage if secrets or SSH agents are
+// set for a build that does not use BuilderBuildKit.
+var ErrBuildKitRequired = errors.New("secrets and SSH agent forwarding require BuildKit")
+
+// session is a BuildKit session, which the daemon calls back into for
+// secrets and SSH agents during a build. The daemon is the gRPC client and
+// the session the server, on a connection hijacked from POST /session.
+type session struct {
+	id      string
+	secrets map[string]string
+	agents  map[string]string
+
+	conn net.Conn
+	done chan struct{}
+}
+
+// startSession opens a session providing secrets and agents, which lasts
+// until it is closed or ctx is done.
+func (c *Client) startSession(ctx context.Context, secrets []BuildSecret, agents []BuildSSH) (*session, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	s := &session{
+		id:      hex.EncodeToString(id),
+		secrets: map[string]string{},
+		agents:  map[string]string{},
+	}
+	methods := []string{healthCheckMethod}
+	if len(secrets) > 0 {
+		methods = append(methods, getSecretMethod)
+	}
+	for _, secret := range secrets {
+		s.secrets[secret.ID] = secret.Src
+	}
+	if len(agents) > 0 {
+		methods = append(methods, checkAgentMethod, forwardAgentMethod)
+	}
+	for _, agent := range agents {
+		if agent.ID == "" {
+			agent.ID = "default"
+		}
+		if agent.Socket == "" {
+			agent.Socket = os.Getenv("SSH_AUTH_SOCK")
+		}
+		if agent.Socket == "" {
+			return nil, fmt.Errorf("no socket for SSH agent %s, SSH_AUTH_SOCK is not set", agent.ID)
+		}
+		s.agents[agent.ID] = agent.Socket
+	}
+
+	if !c.SkipServerVersionCheck && c.expectedAPIVersion == nil {
+		if err := c.checkAPIVersion(); err != nil {
+			return nil, err
+		}
+	}
+	req, err := http.NewRequest(http.MethodPost, c.getURL("/session"), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "h2c")
+	req.Header.Set("X-Docker-Expose-Session-Uuid", s.id)
+	req.Header.Set("X-Docker-Expose-Session-Name", "dockertest")
+	req.Header.Set("X-Docker-Expose-Session-Sharedkey", s.id)
+	for _, m := range methods {
+		req.Header.Add("X-Docker-Expose-Session-Grpc-Method", m)
+	}
+
+	conn, err := c.dialHijack()
+	if err != nil {
+		return nil, err
+	}
+	s.done = make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-s.done:
+		}
+	}()
+
+	br := bufio.NewReader(conn)
+	fail := func(err error) (*session, error) {
+		conn.Close()
+		close(s.done)
+		return nil, err
+	}
+	if err := req.Write(conn); err != nil {
+		return fail(chooseError(ctx, err))
+	}
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return fail(chooseError(ctx, err))
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return fail(newError(resp))
+	}
+
+	s.conn = &bufferedConn{Conn: conn, r: br}
+	go func() {
+		defer close(s.done)
+		(&http2.Server{}).ServeConn(s.conn, &http2.ServeConnOpts{Context: ctx, Handler: s})
+	}()
+	return s, nil
+}
+
+// Close ends the session.
+func (s *session) Close() error {
+	err := s.conn.Close()
+	<-s.done
+	return err
+}
+
+// ServeHTTP handles the gRPC calls of the daemon.
+func (s *session) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	w.WriteHeader(http.StatusOK)
+	// streams start with the headers, before either side sent a message
+	w.(http.Flusher).Flush()
+
+	var code int
+	var err error
+	switch r.URL.Path {
+	case healthCheckMethod:
+		// status SERVING
+		code, err = s.unary(w, r, func([]byte) (int, []byte, error) {
+			return grpcOK, appendProtoVarint(nil, 1, 1), nil
+		})
+	case getSecretMethod:
+		code, err = s.unary(w, r, s.getSecret)
+	case checkAgentMethod:
+		code, err = s.unary(w, r, s.checkAgent)
+	case forwardAgentMethod:
+		code, err = s.forwardAgent(w, r)
+	default:
+		code, err = grpcUnimplemented, fmt.Errorf("unknown method %s", r.URL.Path)
+	}
+
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	if err != nil {
+		w.Header().Set("Grpc-Message", err.Error())
+	}
+}
+
+// unary reads the request message of a unary call and writes the response of
+// handle, unless it fails.
+func (s *session) unary(w http.ResponseWriter, r *http.Request, handle func([]byte) (int, []byte, error)) (int, error) {
+	req, err := readGRPCMessage(r.Body)
+	if err != nil {
+		return grpcInternal, err
+	}
+	code, resp, err := handle(req)
+	if code != grpcOK {
+		return code, err
+	}
+	if err := writeGRPCMessage(w, resp); err != nil {
+		return grpcInternal, err
+	}
+	return grpcOK, nil
+}
+
+// getSecret handles a moby.buildkit.secrets.v1.GetSecretRequest.
+func (s *session) getSecret(req []byte) (int, []byte, error) {
+	id, err := protoString(req, 1)
+	if err != nil {
+		return grpcInternal, nil, err
+	}
+	src, ok := s.secrets[id]
+	if !ok {
+		return grpcNotFound, nil, fmt.Errorf("secret %s not found", id)
+	}
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return grpcInternal, nil, fmt.Errorf("failed to read secret %s: %w", id, err)
+	}
+	return grpcOK, appendProtoBytes(nil, 1, data), nil
+}
+
+// checkAgent handles a moby.sshforward.v1.CheckAgentRequest.
+func (s *session) checkAgent(req []byte) (int, []byte, error) {
+	id, err := protoString(req, 1)
+	if err != nil {
+		return grpcInternal, nil, err
+	}
+	if id == "" {
+		id = "default"
+	}
+	if _, ok := s.agents[id]; !ok {
+		return grpcNotFound, nil, fmt.Errorf("unset ssh forward key %s", id)
+	}
+	return grpcOK, nil, nil
+}
+
+// forwardAgent connects the stream of moby.sshforward.v1.BytesMessage of the
+// daemon to the agent.
+func (s *session) forwardAgent(w http.ResponseWriter, r *http.Request) (int, error) {
+	id := r.Header.Get(sshIDHeader)
+	if id == "" {
+		id = "default"
+	}
+	socket, ok := s.agents[id]
+	if !ok {
+		return grpcNotFound, fmt.Errorf("unset ssh forward key %s", id)
+	}
+	agent, err := net.Dial("unix", socket)
+	if err != nil {
+		return grpcInternal, fmt.Errorf("failed to connect to SSH agent %s: %w", id, err)
+	}
+	defer agent.Close()
+
+	var once sync.Once
+	var streamErr error
+	fail := func(err error) {
+		once.Do(func() {
+			streamErr = err
+			agent.Close()
+			r.Body.Close()
+		})
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			msg, err := readGRPCMessage(r.Body)
+			if err != nil {
+				if err != io.EOF {
+					fail(err)
+				}
+				// the daemon is done, let the agent finish its answers
+				if cw, ok := agent.(interface{ CloseWrite() error }); ok {
+					cw.CloseWrite() //nolint:errcheck
+				}
+				return
+			}
+			data, err := protoBytes(msg, 1)
+			if err == nil {
+				_, err = agent.Write(data)
+			}
+			if err != nil {
+				fail(err)
+				return
+			}
+		}
+	}()
+
+	buf := make([]byte, 32<<10)
+	for {
+		n, err := agent.Read(buf)
+		if n > 0 {
+			if werr := writeGRPCMessage(w, appendProtoBytes(nil, 1, buf[:n])); werr != nil {
+				fail(werr)
+				break
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	fail(nil)
+	wg.Wait()
+	if streamErr != nil {
+		return grpcInternal, streamErr
+	}
+	return grpcOK, nil
+}
+
+// readGRPCMessage reads a length-prefixed message of a gRPC stream.
+func readGRPCMessage(r io.Reader) ([]byte, error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	if hdr[0] != 0 {
+		return nil, errors.New("compressed gRPC messages are not supported")
+	}
+	n := binary.BigEndian.Uint32(hdr[1:])
+	if n > maxGRPCMessageSize {
+		return nil, fmt.Errorf("gRPC message of %d bytes exceeds the limit", n)
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// writeGRPCMessage writes a length-prefixed message of a gRPC stream and
+// flushes it.
+func writeGRPCMessage(w http.ResponseWriter, msg []byte) error {
+	hdr := [5]byte{}
+	binary.BigEndian.PutUint32(hdr[1:], uint32(len(msg)))
+	if _, err := w.Write(append(hdr[:], msg...)); err != nil {
+		return err
+	}
+	w.(http.Flusher).Flush()
+	return nil
+}
+
+// protoBytes returns the last value of the length-delimited field num of the
+// protocol buffers message b.
+func protoBytes(b []byte, num int) ([]byte, error) {
+	fields, err := protoFields(b)
+	if err != nil {
+		return nil, err
+	}
+	var v []byte
+	for _, f := range fields {
+		if f.num == num {
+			v = f.data
+		}
+	}
+	return v, nil
+}
+
+func protoString(b []byte, num int) (string, error) {
+	v, err := protoBytes(b, num)
+	return string(v), err
+}
+
+// bufferedConn is a connection whose first bytes were read into r already.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
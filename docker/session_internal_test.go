@@ -0,0 +1,65 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package docker
+
+import (
+	"bytes"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSessionFraming checks the gRPC messages of a session byte for byte. Each message is framed by a compression
+// flag and a big endian length, followed by the protocol buffers message.
+func TestSessionFraming(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "token")
+	require.Nil(t, os.WriteFile(secret, []byte("s3cr3t"), 0o600))
+	s := &session{
+		secrets: map[string]string{"token": secret},
+		agents:  map[string]string{"default": filepath.Join(t.TempDir(), "agent.sock")},
+	}
+
+	for _, tc := range []struct {
+		method string
+		req    string
+		resp   string
+		status string
+	}{
+		// grpc.health.v1.HealthCheckRequest{} and HealthCheckResponse{status: SERVING}
+		{healthCheckMethod, "0000000000", "00000000020801", "0"},
+		// moby.buildkit.secrets.v1.GetSecretRequest{ID: "token"} and GetSecretResponse{data: "s3cr3t"}
+		{getSecretMethod, "00000000070a05746f6b656e", "00000000080a06733363723374", "0"},
+		// GetSecretRequest{ID: "token", annotations: {"k": "v"}}, annotations are ignored
+		{getSecretMethod, "000000000f0a05746f6b656e12060a016b120176", "00000000080a06733363723374", "0"},
+		// GetSecretRequest{ID: "missing"} fails with NOT_FOUND
+		{getSecretMethod, "00000000090a076d697373696e67", "", "5"},
+		// moby.sshforward.v1.CheckAgentRequest{ID: "default"} and CheckAgentResponse{}
+		{checkAgentMethod, "00000000090a0764656661756c74", "0000000000", "0"},
+		// compressed messages fail with INTERNAL
+		{getSecretMethod, "01000000070a05746f6b656e", "", "13"},
+		// unknown methods fail with UNIMPLEMENTED
+		{"/moby.filesync.v1.FileSync/DiffCopy", "", "", "12"},
+	} {
+		t.Run(tc.method, func(t *testing.T) {
+			req, err := hex.DecodeString(tc.req)
+			require.Nil(t, err)
+			resp, err := hex.DecodeString(tc.resp)
+			require.Nil(t, err)
+
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, httptest.NewRequest(http.MethodPost, tc.method, bytes.NewReader(req)))
+			result := w.Result()
+			assert.Equal(t, http.StatusOK, result.StatusCode)
+			assert.Equal(t, "application/grpc", result.Header.Get("Content-Type"))
+			assert.Equal(t, tc.status, result.Trailer.Get("Grpc-Status"))
+			assert.Equal(t, hex.EncodeToString(resp), hex.EncodeToString(w.Body.Bytes()))
+		})
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package docker_test
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	dc "github.com/ory/dockertest/v3/docker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildImageSession(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("SSH agents are forwarded from unix sockets")
+	}
+	fake, client := newFakeClient(t)
+	dir := t.TempDir()
+
+	secret := filepath.Join(dir, "token")
+	require.Nil(t, os.WriteFile(secret, []byte("s3cr3t"), 0o600))
+
+	// answers requests for identities with an empty list
+	agent, err := net.Listen("unix", filepath.Join(dir, "agent.sock"))
+	require.Nil(t, err)
+	t.Cleanup(func() { agent.Close() })
+	go func() {
+		for {
+			conn, err := agent.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				req := make([]byte, 5)
+				if _, err := io.ReadFull(conn, req); err != nil || req[4] != 11 {
+					return
+				}
+				_, _ = conn.Write([]byte{0, 0, 0, 5, 12, 0, 0, 0, 0})
+				_, _ = io.Copy(io.Discard, conn)
+			}()
+		}
+	}()
+
+	build := func(dockerfile string, version dc.BuilderVersion) error {
+		contextDir := t.TempDir()
+		require.Nil(t, os.WriteFile(filepath.Join(contextDir, "Dockerfile"), []byte(dockerfile), 0o600))
+		return client.BuildImage(dc.BuildImageOptions{
+			Name:         "buildkit",
+			Dockerfile:   "Dockerfile",
+			ContextDir:   contextDir,
+			OutputStream: &bytes.Buffer{},
+			Version:      version,
+			Secrets:      []dc.BuildSecret{{ID: "token", Src: secret}},
+			SSH:          []dc.BuildSSH{{Socket: agent.Addr().String()}},
+		})
+	}
+
+	require.Nil(t, build("FROM golang\n"+
+		"RUN --mount=type=secret,id=token echo fetching\n"+
+		"RUN --mount=type=ssh echo cloning\n", dc.BuilderBuildKit))
+	builds := fake.Builds()
+	require.Len(t, builds, 1)
+	assert.Equal(t, "2", builds[0].Version)
+	assert.Equal(t, map[string][]byte{"token": []byte("s3cr3t")}, builds[0].Secrets)
+	assert.Equal(t, map[string][]byte{"default": {0, 0, 0, 5, 12, 0, 0, 0, 0}}, builds[0].SSH)
+
+	err = build("FROM golang\nRUN --mount=type=secret,id=missing cat /run/secrets/missing\n", dc.BuilderBuildKit)
+	assert.ErrorContains(t, err, "secret missing not found")
+
+	err = build("FROM golang\nRUN --mount=type=secret,id=token cat /run/secrets/token\n", dc.BuilderV1)
+	assert.ErrorIs(t, err, dc.ErrBuildKitRequired)
+}
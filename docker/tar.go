@@ -20,6 +20,12 @@ import (
 	"github.com/ory/dockertest/v3/docker/pkg/fileutils"
 )
 
+// CreateTarStream returns the build context BuildImage sends for the directory
+// srcPath when it is set as ContextDir, honoring its .dockerignore file.
+func CreateTarStream(srcPath, dockerfilePath string) (io.ReadCloser, error) {
+	return createTarStream(srcPath, dockerfilePath)
+}
+
 func createTarStream(srcPath, dockerfilePath string) (io.ReadCloser, error) {
 	srcPath, err := filepath.Abs(srcPath)
 	if err != nil {
@@ -4,29 +4,56 @@
 package dockertest
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"net"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
 	dc "github.com/ory/dockertest/v3/docker"
 	options "github.com/ory/dockertest/v3/docker/opts"
+	"github.com/ory/dockertest/v3/docker/pkg/jsonmessage"
 )
 
 var (
 	ErrNotInContainer = errors.New("not running in container")
 )
 
+// createLabel identifies a container without a name whose create request was cancelled.
+const createLabel = "org.ory.dockertest.create-id"
+
 // Pool represents a connection to the docker API and is used to create and remove docker images.
 type Pool struct {
 	Client  *dc.Client
 	MaxWait time.Duration
+
+	// LogDir is the directory RunT writes the output of the containers it starts to, see Pool.RunT.
+	LogDir string
+
+	// Progress receives the progress of the images the pool pulls and builds, e.g. TerminalProgress or
+	// LogProgress. It is called from one goroutine per pull or build. The progress of BuildKit builds is passed as
+	// it is printed by "docker build --progress=plain", with one message per line.
+	Progress func(jsonmessage.JSONMessage)
+
+	// tlsPath and tlsSkipVerify are the TLS material the client was created with, so that the reaper can connect
+	// the same way.
+	tlsPath       string
+	tlsSkipVerify bool
+
+	// mu guards reaper
+	mu     sync.Mutex
+	reaper *Reaper
+
+	engineMu sync.Mutex
+	engine   *Engine
 }
 
 // Network represents a docker network.
@@ -40,10 +67,29 @@ func (n *Network) Close() error {
 	return n.pool.RemoveNetwork(n)
 }
 
+// Volume represents a docker volume.
+type Volume struct {
+	pool   *Pool
+	Volume *dc.Volume
+}
+
+// Close removes volume by calling pool.RemoveVolume.
+func (v *Volume) Close() error {
+	return v.pool.RemoveVolume(v)
+}
+
 // Resource represents a docker container.
 type Resource struct {
 	pool      *Pool
 	Container *dc.Container
+
+	reuse  bool // started with RunOptions.Reuse
+	reused bool
+}
+
+// Reused reports whether the resource is a container that was already running, see RunOptions.Reuse.
+func (r *Resource) Reused() bool {
+	return r.reused
 }
 
 // GetPort returns a resource's published port. You can use it to connect to the service via localhost, e.g. tcp://localhost:1231/
@@ -57,7 +103,7 @@ func (r *Resource) GetPort(id string) string {
 		return ""
 	}
 
-	return m[0].HostPort
+	return preferredBinding(m).HostPort
 }
 
 // GetBoundIP returns a resource's published IP address.
@@ -71,11 +117,7 @@ func (r *Resource) GetBoundIP(id string) string {
 		return ""
 	}
 
-	ip := m[0].HostIP
-	if ip == "0.0.0.0" || ip == "" {
-		return "localhost"
-	}
-	return ip
+	return hostIP(m)
 }
 
 // GetHostPort returns a resource's published port with an address.
@@ -89,11 +131,28 @@ func (r *Resource) GetHostPort(portID string) string {
 		return ""
 	}
 
-	ip := m[0].HostIP
-	if ip == "0.0.0.0" || ip == "" {
-		ip = "localhost"
+	return net.JoinHostPort(hostIP(m), preferredBinding(m).HostPort)
+}
+
+// preferredBinding returns the IPv4 binding of a published port if there is one. Docker publishes ports on both
+// 0.0.0.0 and ::, in no particular order, while Podman publishes on IPv4 only.
+func preferredBinding(bindings []dc.PortBinding) dc.PortBinding {
+	for _, b := range bindings {
+		if ip := net.ParseIP(b.HostIP); ip == nil || ip.To4() != nil {
+			return b
+		}
 	}
-	return net.JoinHostPort(ip, m[0].HostPort)
+	return bindings[0]
+}
+
+// hostIP returns the address a published port can be reached at. Ports published on all interfaces, which Podman
+// reports with an empty address, are reached via localhost.
+func hostIP(bindings []dc.PortBinding) string {
+	ip := preferredBinding(bindings).HostIP
+	if ip == "0.0.0.0" || ip == "::" || ip == "" {
+		return "localhost"
+	}
+	return ip
 }
 
 type ExecOptions struct {
@@ -115,6 +174,12 @@ type ExecOptions struct {
 
 // Exec executes command within container.
 func (r *Resource) Exec(cmd []string, opts ExecOptions) (exitCode int, err error) {
+	return r.ExecContext(context.Background(), cmd, opts)
+}
+
+// ExecContext executes command within container. The context can be used to
+// abort waiting for the command, in which case the context's error is returned.
+func (r *Resource) ExecContext(ctx context.Context, cmd []string, opts ExecOptions) (exitCode int, err error) {
 	exec, err := r.pool.Client.CreateExec(dc.CreateExecOptions{
 		Container:    r.Container.ID,
 		Cmd:          cmd,
@@ -123,6 +188,7 @@ func (r *Resource) Exec(cmd []string, opts ExecOptions) (exitCode int, err error
 		AttachStdout: true,
 		AttachStdin:  opts.StdIn != nil,
 		Tty:          opts.TTY,
+		Context:      ctx,
 	})
 	if err != nil {
 		return -1, fmt.Errorf("Create exec failed: %w", err)
@@ -143,12 +209,17 @@ func (r *Resource) Exec(cmd []string, opts ExecOptions) (exitCode int, err error
 		OutputStream: opts.StdOut,
 		ErrorStream:  opts.StdErr,
 		Tty:          opts.TTY,
+		Context:      ctx,
 	})
+	if err == nil {
+		// a cancelled hijacked session may end without a read error
+		err = ctx.Err()
+	}
 	if err != nil {
 		return -1, fmt.Errorf("Start exec failed: %w", err)
 	}
 
-	inspectExec, err := r.pool.Client.InspectExec(exec.ID)
+	inspectExec, err := r.pool.Client.InspectExecWithContext(exec.ID, ctx)
 	if err != nil {
 		return -1, fmt.Errorf("Inspect exec failed: %w", err)
 	}
@@ -172,21 +243,26 @@ func (r *Resource) GetIPInNetwork(network *Network) string {
 
 // ConnectToNetwork connects container to network.
 func (r *Resource) ConnectToNetwork(network *Network) error {
+	return r.ConnectToNetworkContext(context.Background(), network)
+}
+
+// ConnectToNetworkContext connects container to network. The context can be used to cancel the requests.
+func (r *Resource) ConnectToNetworkContext(ctx context.Context, network *Network) error {
 	err := r.pool.Client.ConnectNetwork(
 		network.Network.ID,
-		dc.NetworkConnectionOptions{Container: r.Container.ID},
+		dc.NetworkConnectionOptions{Container: r.Container.ID, Context: ctx},
 	)
 	if err != nil {
 		return fmt.Errorf("Failed to connect container to network: %w", err)
 	}
 
 	// refresh internal representation
-	r.Container, err = r.pool.Client.InspectContainer(r.Container.ID)
+	r.Container, err = r.pool.Client.InspectContainerWithContext(r.Container.ID, ctx)
 	if err != nil {
 		return fmt.Errorf("Failed to refresh container information: %w", err)
 	}
 
-	network.Network, err = r.pool.Client.NetworkInfo(network.Network.ID)
+	network.Network, err = r.pool.Client.NetworkInfoWithContext(network.Network.ID, ctx)
 	if err != nil {
 		return fmt.Errorf("Failed to refresh network information: %w", err)
 	}
@@ -196,21 +272,26 @@ func (r *Resource) ConnectToNetwork(network *Network) error {
 
 // DisconnectFromNetwork disconnects container from network.
 func (r *Resource) DisconnectFromNetwork(network *Network) error {
+	return r.DisconnectFromNetworkContext(context.Background(), network)
+}
+
+// DisconnectFromNetworkContext disconnects container from network. The context can be used to cancel the requests.
+func (r *Resource) DisconnectFromNetworkContext(ctx context.Context, network *Network) error {
 	err := r.pool.Client.DisconnectNetwork(
 		network.Network.ID,
-		dc.NetworkConnectionOptions{Container: r.Container.ID},
+		dc.NetworkConnectionOptions{Container: r.Container.ID, Context: ctx},
 	)
 	if err != nil {
 		return fmt.Errorf("Failed to connect container to network: %w", err)
 	}
 
 	// refresh internal representation
-	r.Container, err = r.pool.Client.InspectContainer(r.Container.ID)
+	r.Container, err = r.pool.Client.InspectContainerWithContext(r.Container.ID, ctx)
 	if err != nil {
 		return fmt.Errorf("Failed to refresh container information: %w", err)
 	}
 
-	network.Network, err = r.pool.Client.NetworkInfo(network.Network.ID)
+	network.Network, err = r.pool.Client.NetworkInfoWithContext(network.Network.ID, ctx)
 	if err != nil {
 		return fmt.Errorf("Failed to refresh network information: %w", err)
 	}
@@ -233,6 +314,19 @@ func (r *Resource) Expire(seconds uint) error {
 	return nil
 }
 
+// Events streams the start, die, oom and health_status events of the resource's container, beginning with the ones
+// since the container was created, until ctx is done. See docker.Client.Events for the semantics of the channels.
+func (r *Resource) Events(ctx context.Context) (<-chan *dc.APIEvents, <-chan error) {
+	return r.pool.Client.Events(ctx, dc.EventsOptions{
+		Filters: map[string][]string{
+			"type":      {"container"},
+			"container": {r.Container.ID},
+			"event":     {"start", "die", "oom", "health_status"},
+		},
+		Since: r.Container.Created,
+	})
+}
+
 // NewTLSPool creates a new pool given an endpoint and the certificate path. This is required for endpoints that
 // require TLS communication.
 func NewTLSPool(endpoint, certpath string) (*Pool, error) {
@@ -246,14 +340,17 @@ func NewTLSPool(endpoint, certpath string) (*Pool, error) {
 	}
 
 	return &Pool{
-		Client: client,
+		Client:  client,
+		tlsPath: certpath,
 	}, nil
 }
 
 // NewPool creates a new pool. You can pass an empty string to use the default, which is taken from the environment
 // variable DOCKER_HOST and DOCKER_URL, or from docker-machine if the environment variable DOCKER_MACHINE_NAME is set,
-// or if neither is defined a sensible default for the operating system you are on.
-// TLS pools are automatically configured if the DOCKER_CERT_PATH environment variable exists.
+// or from the docker CLI context selected with DOCKER_CONTEXT or `docker context use`, or if neither is defined a
+// sensible default for the operating system you are on.
+// TLS pools are automatically configured if the DOCKER_CERT_PATH environment variable exists, or if the docker
+// context has TLS material.
 func NewPool(endpoint string) (*Pool, error) {
 	if endpoint == "" {
 		if os.Getenv("DOCKER_MACHINE_NAME") != "" {
@@ -262,12 +359,32 @@ func NewPool(endpoint string) (*Pool, error) {
 				return nil, fmt.Errorf("failed to create client from environment: %w", err)
 			}
 
-			return &Pool{Client: client}, nil
+			pool := &Pool{Client: client}
+			if os.Getenv("DOCKER_TLS_VERIFY") != "" {
+				pool.tlsPath = os.Getenv("DOCKER_CERT_PATH")
+				if pool.tlsPath == "" {
+					home, err := os.UserHomeDir()
+					if err != nil {
+						return nil, fmt.Errorf("failed to locate docker certificates: %w", err)
+					}
+					pool.tlsPath = filepath.Join(home, ".docker")
+				}
+			}
+			return pool, nil
 		}
 		if os.Getenv("DOCKER_HOST") != "" {
 			endpoint = os.Getenv("DOCKER_HOST")
 		} else if os.Getenv("DOCKER_URL") != "" {
 			endpoint = os.Getenv("DOCKER_URL")
+		} else if dockerCtx, err := currentDockerContext(); err != nil {
+			return nil, fmt.Errorf("Failed to resolve docker context: %w", err)
+		} else if dockerCtx != nil {
+			client, err := dockerCtx.newClient()
+			if err != nil {
+				return nil, fmt.Errorf("Failed to create client for docker context %q: %w", dockerCtx.Name, err)
+			}
+
+			return &Pool{Client: client, tlsPath: dockerCtx.TLSPath, tlsSkipVerify: dockerCtx.SkipTLSVerify}, nil
 		} else if runtime.GOOS == "windows" {
 			if _, err := os.Stat(`\\.\pipe\docker_engine`); err == nil {
 				endpoint = "npipe:////./pipe/docker_engine"
@@ -275,7 +392,7 @@ func NewPool(endpoint string) (*Pool, error) {
 				endpoint = "http://localhost:2375"
 			}
 		} else {
-			endpoint = "unix:///var/run/docker.sock"
+			endpoint = defaultSocket()
 		}
 	}
 
@@ -294,7 +411,7 @@ func NewPool(endpoint string) (*Pool, error) {
 }
 
 func shouldPreferTLS(endpoint string) bool {
-	return !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "unix://")
+	return !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "unix://") && !strings.HasPrefix(endpoint, "ssh://")
 }
 
 // RunOptions is used to pass in optional parameters when running a container.
@@ -316,13 +433,33 @@ type RunOptions struct {
 	WorkingDir   string
 	NetworkID    string
 	Networks     []*Network // optional networks to join
+	Aliases      []string   // network aliases on NetworkID and Networks
 	Labels       map[string]string
-	Auth         dc.AuthConfiguration
+	Auth         dc.AuthConfiguration // resolved from the docker config file and its credential helpers if empty
 	PortBindings map[dc.Port][]dc.PortBinding
 	Privileged   bool
 	User         string
 	Tty          bool
 	Platform     string
+	WaitFor      WaitStrategy // optional strategy to wait for before returning, see ForLog, ForPort, ForHTTP, ...
+
+	// Healthcheck overrides the HEALTHCHECK of the image, e.g.
+	//
+	//	&dc.HealthConfig{Test: []string{"CMD", "pg_isready"}, Interval: time.Second, Retries: 30}
+	//
+	// Use ForHealthy or Resource.WaitHealthy to wait until the container is healthy.
+	Healthcheck *dc.HealthConfig
+
+	// Files are written into the container before it starts, e.g. configuration files the image reads at boot:
+	//
+	//	Files: []dockertest.File{{Path: "/etc/nginx/nginx.conf", HostPath: "testdata/nginx.conf"}}
+	Files []File
+
+	// Reuse attaches to a running container that was started with the same configuration instead of creating a new
+	// one, which speeds up repeated local test runs. Purge leaves containers started with Reuse running, so that the
+	// next run can attach to them, use ForcePurge to remove them. Reused containers are not removed by the reaper
+	// either. Note that the image is not checked for updates once a container is reused.
+	Reuse bool
 }
 
 // BuildOptions is used to pass in optional parameters when building a container
@@ -331,27 +468,79 @@ type BuildOptions struct {
 	ContextDir string
 	BuildArgs  []dc.BuildArg
 	Platform   string
+
+	// Tag is the name the image is tagged with, e.g. "app:test", instead of RunOptions.Name. The container is run
+	// from the image tagged with it.
+	Tag string
+	// Target is the stage of a multi-stage Dockerfile to build.
+	Target string
+	Labels map[string]string
+
+	// NoCache builds the image without using the build cache, and Pull pulls newer versions of the base images.
+	// Both imply ForceRebuild.
+	NoCache bool
+	Pull    bool
+	// CacheFrom holds images to use as cache sources.
+	CacheFrom []string
+
+	// NetworkMode is the network the build steps run in, e.g. "host" or "none".
+	NetworkMode string
+	Ulimits     []dc.ULimit
+	// Memory limits the memory of the build steps in bytes.
+	Memory int64
+
+	// AuthConfigs holds the credentials for the registries the base images are pulled from.
+	AuthConfigs dc.AuthConfigurations
+
+	// BuildKit builds the image with BuildKit instead of the legacy builder. It is implied by Secrets and SSH.
+	BuildKit bool
+	// Secrets are mounted by RUN --mount=type=secret instructions, and SSH agents are forwarded to
+	// RUN --mount=type=ssh ones. The build digest covers the content of the secrets, but only the IDs of the SSH
+	// agents, see BuildDigestLabel.
+	Secrets []dc.BuildSecret
+	SSH     []dc.BuildSSH
+
+	// DockerfileContent is the content of the Dockerfile, which is added to the build context as Dockerfile, or
+	// "Dockerfile" if that is empty.
+	DockerfileContent string
+	// ContextFiles holds files by their slash separated path in the build context, which are added to the files of
+	// ContextFS or ContextDir.
+	ContextFiles map[string][]byte
+	// ContextFS is the build context, e.g. an embed.FS, instead of ContextDir.
+	//
+	// If any of DockerfileContent, ContextFiles and ContextFS is set, the build context is assembled in memory,
+	// excluding the files matched by its .dockerignore file.
+	ContextFS fs.FS
+
+	// ForceRebuild builds the image even if an image built from the same build context and options exists, see
+	// BuildDigestLabel.
+	ForceRebuild bool
 }
 
 // BuildAndRunWithBuildOptions builds and starts a docker container.
 // Optional modifier functions can be passed in order to change the hostconfig values not covered in RunOptions
 func (d *Pool) BuildAndRunWithBuildOptions(buildOpts *BuildOptions, runOpts *RunOptions, hcOpts ...func(*dc.HostConfig)) (*Resource, error) {
-	err := d.Client.BuildImage(dc.BuildImageOptions{
-		Name:         runOpts.Name,
-		Dockerfile:   buildOpts.Dockerfile,
-		OutputStream: io.Discard,
-		ContextDir:   buildOpts.ContextDir,
-		BuildArgs:    buildOpts.BuildArgs,
-		Platform:     buildOpts.Platform,
-	})
+	return d.BuildAndRunWithBuildOptionsContext(context.Background(), buildOpts, runOpts, hcOpts...)
+}
 
-	if err != nil {
+// BuildAndRunWithBuildOptionsContext builds and starts a docker container. The context can be used to cancel the
+// build as well as the subsequent run, see RunWithOptionsContext.
+// Optional modifier functions can be passed in order to change the hostconfig values not covered in RunOptions
+func (d *Pool) BuildAndRunWithBuildOptionsContext(ctx context.Context, buildOpts *BuildOptions, runOpts *RunOptions, hcOpts ...func(*dc.HostConfig)) (*Resource, error) {
+	image := runOpts.Name
+	if buildOpts.Tag != "" {
+		image = buildOpts.Tag
+	}
+	if err := d.buildImage(ctx, buildOpts, image); err != nil {
 		return nil, err
 	}
 
-	runOpts.Repository = runOpts.Name
+	runOpts.Repository = image
+	if buildOpts.Tag != "" {
+		runOpts.Repository, runOpts.Tag = dc.ParseRepositoryTag(buildOpts.Tag)
+	}
 
-	return d.RunWithOptions(runOpts, hcOpts...)
+	return d.RunWithOptionsContext(ctx, runOpts, hcOpts...)
 }
 
 // BuildAndRunWithOptions builds and starts a docker container.
@@ -375,7 +564,39 @@ func (d *Pool) BuildAndRun(name, dockerfilePath string, env []string) (*Resource
 //	 pool.RunWithOptions(&RunOptions{Repository: "mongo", Cmd: []string{"mongod", "--smallfiles"}}, func(hostConfig *dc.HostConfig) {
 //				hostConfig.ShmSize = shmemsize
 //			})
+//
+// If the container cannot be started, the error is a *RunError recording the phase that failed, which can be
+// matched against ErrImageNotFound, ErrPortConflict, ErrNameConflict, ErrPullAuth and ErrDaemonUnreachable.
 func (d *Pool) RunWithOptions(opts *RunOptions, hcOpts ...func(*dc.HostConfig)) (*Resource, error) {
+	return d.RunWithOptionsContext(context.Background(), opts, hcOpts...)
+}
+
+// RunWithOptionsContext starts a docker container. The context can be used to cancel pulling the image as well as
+// creating and starting the container. If starting the container fails or the context is cancelled after the
+// container has been created, the container and its anonymous volumes are removed again before the error is
+// returned.
+// Optional modifier functions can be passed in order to change the hostconfig values not covered in RunOptions
+func (d *Pool) RunWithOptionsContext(ctx context.Context, opts *RunOptions, hcOpts ...func(*dc.HostConfig)) (*Resource, error) {
+	createOpts, err := d.createContainerOptions(opts, hcOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Reuse {
+		r, ok, err := d.reuseContainer(ctx, opts, &createOpts)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return r, nil
+		}
+	}
+
+	return d.runContainer(ctx, opts, createOpts)
+}
+
+// createContainerOptions translates opts into the options used to create the container.
+func (d *Pool) createContainerOptions(opts *RunOptions, hcOpts ...func(*dc.HostConfig)) (dc.CreateContainerOptions, error) {
 	repository := opts.Repository
 	tag := opts.Tag
 	env := opts.Env
@@ -396,7 +617,7 @@ func (d *Pool) RunWithOptions(opts *RunOptions, hcOpts ...func(*dc.HostConfig))
 	for _, m := range opts.Mounts {
 		s, d, err := options.MountParser(m)
 		if err != nil {
-			return nil, err
+			return dc.CreateContainerOptions{}, err
 		}
 		mounts = append(mounts, dc.Mount{
 			Source:      s,
@@ -413,21 +634,10 @@ func (d *Pool) RunWithOptions(opts *RunOptions, hcOpts ...func(*dc.HostConfig))
 		EndpointsConfig: map[string]*dc.EndpointConfig{},
 	}
 	if opts.NetworkID != "" {
-		networkingConfig.EndpointsConfig[opts.NetworkID] = &dc.EndpointConfig{}
+		networkingConfig.EndpointsConfig[opts.NetworkID] = &dc.EndpointConfig{Aliases: opts.Aliases}
 	}
 	for _, network := range opts.Networks {
-		networkingConfig.EndpointsConfig[network.Network.ID] = &dc.EndpointConfig{}
-	}
-
-	_, err := d.Client.InspectImage(fmt.Sprintf("%s:%s", repository, tag))
-	if err != nil {
-		if err := d.Client.PullImage(dc.PullImageOptions{
-			Repository: repository,
-			Tag:        tag,
-			Platform:   opts.Platform,
-		}, opts.Auth); err != nil {
-			return nil, err
-		}
+		networkingConfig.EndpointsConfig[network.Network.ID] = &dc.EndpointConfig{Aliases: opts.Aliases}
 	}
 
 	hostConfig := dc.HostConfig{
@@ -446,7 +656,13 @@ func (d *Pool) RunWithOptions(opts *RunOptions, hcOpts ...func(*dc.HostConfig))
 		hostConfigOption(&hostConfig)
 	}
 
-	c, err := d.Client.CreateContainer(dc.CreateContainerOptions{
+	labels := opts.Labels
+	if !opts.Reuse && opts.Labels[SharedLabel] == "" {
+		// reused and shared containers outlive the session
+		labels = d.sessionLabels(labels)
+	}
+
+	return dc.CreateContainerOptions{
 		Name: opts.Name,
 		Config: &dc.Config{
 			Hostname:     opts.Hostname,
@@ -457,38 +673,159 @@ func (d *Pool) RunWithOptions(opts *RunOptions, hcOpts ...func(*dc.HostConfig))
 			Mounts:       mounts,
 			ExposedPorts: exp,
 			WorkingDir:   wd,
-			Labels:       opts.Labels,
+			Labels:       labels,
 			StopSignal:   "SIGWINCH", // to support timeouts
 			User:         opts.User,
 			Tty:          opts.Tty,
+			Healthcheck:  opts.Healthcheck,
 		},
 		HostConfig:       &hostConfig,
 		NetworkingConfig: &networkingConfig,
-	})
+	}, nil
+}
+
+// runContainer pulls the image if needed, then creates and starts the container described by createOpts.
+func (d *Pool) runContainer(ctx context.Context, opts *RunOptions, createOpts dc.CreateContainerOptions) (*Resource, error) {
+	tag := opts.Tag
+	if tag == "" {
+		tag = "latest"
+	}
+
+	_, err := d.Client.InspectImageWithContext(fmt.Sprintf("%s:%s", opts.Repository, tag), ctx)
 	if err != nil {
-		return nil, err
+		auth := opts.Auth
+		if auth == (dc.AuthConfiguration{}) {
+			auth = authFor(opts.Repository)
+		}
+		p := d.newProgress()
+		err := d.Client.PullImage(dc.PullImageOptions{
+			Repository:    opts.Repository,
+			Tag:           tag,
+			Platform:      opts.Platform,
+			OutputStream:  p,
+			RawJSONStream: true,
+			Context:       ctx,
+		}, auth)
+		if perr := p.Close(); err == nil {
+			err = perr
+		}
+		if err != nil {
+			return nil, &RunError{Phase: PhasePull, Err: err}
+		}
 	}
 
-	if err := d.Client.StartContainer(c.ID, nil); err != nil {
-		return nil, err
+	if createOpts.Config.StopSignal == "SIGWINCH" && d.engineOrDocker(ctx).Podman() {
+		// Podman treats SIGWINCH as a terminal resize, use the stop signal of the image instead
+		createOpts.Config.StopSignal = ""
+	}
+
+	createID := ""
+	if createOpts.Name == "" {
+		// an anonymous container can only be found by a label if the create is cancelled after the daemon handled it
+		if createID, err = newSessionID(); err != nil {
+			return nil, &RunError{Phase: PhaseCreate, Err: err}
+		}
+		labels := make(map[string]string, len(createOpts.Config.Labels)+1)
+		for k, v := range createOpts.Config.Labels {
+			labels[k] = v
+		}
+		labels[createLabel] = createID
+		createOpts.Config.Labels = labels
 	}
 
-	c, err = d.Client.InspectContainer(c.ID)
+	createOpts.Context = ctx
+	c, err := d.Client.CreateContainer(createOpts)
 	if err != nil {
-		return nil, err
+		runErr := &RunError{Phase: PhaseCreate, Err: err}
+		if ctx.Err() != nil {
+			d.removeCancelled(createOpts, createID, runErr)
+		}
+		return nil, runErr
+	}
+
+	if len(opts.Files) > 0 {
+		if err := d.writeFiles(ctx, c, opts.Files); err != nil {
+			return nil, d.rollback(c.ID, &RunError{Phase: PhaseFiles, Err: err})
+		}
+	}
+
+	if err := d.Client.StartContainerWithContext(c.ID, nil, ctx); err != nil {
+		return nil, d.rollback(c.ID, &RunError{Phase: PhaseStart, Err: err})
+	}
+
+	id := c.ID
+	c, err = d.Client.InspectContainerWithContext(id, ctx)
+	if err != nil {
+		return nil, d.rollback(id, &RunError{Phase: PhaseInspect, Err: err})
 	}
 
 	for _, network := range opts.Networks {
-		network.Network, err = d.Client.NetworkInfo(network.Network.ID)
+		network.Network, err = d.Client.NetworkInfoWithContext(network.Network.ID, ctx)
 		if err != nil {
-			return nil, err
+			return nil, d.rollback(id, &RunError{Phase: PhaseInspect, Err: err})
 		}
 	}
 
-	return &Resource{
+	r := &Resource{
 		pool:      d,
 		Container: c,
-	}, nil
+		reuse:     opts.Reuse,
+	}
+
+	if opts.WaitFor != nil {
+		if err := opts.WaitFor.WaitUntilReady(ctx, r); err != nil {
+			// the caller never gets hold of a container that did not become ready, so it would leak
+			return nil, d.rollback(id, &RunError{Phase: PhaseWait, Err: err})
+		}
+	}
+
+	return r, nil
+}
+
+// rollback removes the container with the given id along with its anonymous volumes, so that a failed
+// RunWithOptionsContext does not leave a half started container behind. The removal does not use the context of
+// the run, as it may be the reason for the failure. A failed removal is recorded in err.
+func (d *Pool) rollback(id string, err *RunError) error {
+	rmErr := d.Client.RemoveContainer(dc.RemoveContainerOptions{ID: id, Force: true, RemoveVolumes: true})
+	var noSuchContainer *dc.NoSuchContainer
+	if rmErr != nil && !errors.As(rmErr, &noSuchContainer) {
+		err.ContainerID = id
+		err.Rollback = rmErr
+	}
+
+	return err
+}
+
+// removeCancelled removes the container the daemon may have created although the context of the create
+// request was cancelled. The container is identified by its name, or by the createLabel stamped with createID
+// if it has none.
+func (d *Pool) removeCancelled(createOpts dc.CreateContainerOptions, createID string, err *RunError) {
+	var ids []string
+	if createOpts.Name != "" {
+		c, inspectErr := d.Client.InspectContainerWithContext(createOpts.Name, context.Background())
+		if inspectErr != nil {
+			return
+		}
+		// a container of the same name that existed before would have failed the create
+		if c.State.Status == "created" && c.Config.Image == createOpts.Config.Image {
+			ids = append(ids, c.ID)
+		}
+	} else {
+		containers, listErr := d.Client.ListContainers(dc.ListContainersOptions{
+			All:     true,
+			Filters: map[string][]string{"label": {createLabel + "=" + createID}},
+		})
+		if listErr != nil {
+			return
+		}
+		for _, c := range containers {
+			ids = append(ids, c.ID)
+		}
+	}
+
+	for _, id := range ids {
+		d.rollback(id, err)
+	}
 }
 
 // Run starts a docker container.
@@ -500,11 +837,18 @@ func (d *Pool) Run(repository, tag string, env []string) (*Resource, error) {
 
 // ContainerByName finds a container with the given name and returns it if present
 func (d *Pool) ContainerByName(containerName string) (*Resource, bool) {
+	return d.ContainerByNameContext(context.Background(), containerName)
+}
+
+// ContainerByNameContext finds a container with the given name and returns it if present.
+// The context can be used to cancel the lookup.
+func (d *Pool) ContainerByNameContext(ctx context.Context, containerName string) (*Resource, bool) {
 	containers, err := d.Client.ListContainers(dc.ListContainersOptions{
 		All: true,
 		Filters: map[string][]string{
 			"name": {containerName},
 		},
+		Context: ctx,
 	})
 
 	if err != nil {
@@ -515,7 +859,7 @@ func (d *Pool) ContainerByName(containerName string) (*Resource, bool) {
 		return nil, false
 	}
 
-	c, err := d.Client.InspectContainer(containers[0].ID)
+	c, err := d.Client.InspectContainerWithContext(containers[0].ID, ctx)
 	if err != nil {
 		return nil, false
 	}
@@ -528,11 +872,18 @@ func (d *Pool) ContainerByName(containerName string) (*Resource, bool) {
 
 // RemoveContainerByName find a container with the given name and removes it if present
 func (d *Pool) RemoveContainerByName(containerName string) error {
+	return d.RemoveContainerByNameContext(context.Background(), containerName)
+}
+
+// RemoveContainerByNameContext find a container with the given name and removes it if present.
+// The context can be used to cancel the requests.
+func (d *Pool) RemoveContainerByNameContext(ctx context.Context, containerName string) error {
 	containers, err := d.Client.ListContainers(dc.ListContainersOptions{
 		All: true,
 		Filters: map[string][]string{
 			"name": {containerName},
 		},
+		Context: ctx,
 	})
 	if err != nil {
 		return fmt.Errorf("Error while listing containers with name %s: %w", containerName, err)
@@ -546,6 +897,7 @@ func (d *Pool) RemoveContainerByName(containerName string) error {
 		ID:            containers[0].ID,
 		Force:         true,
 		RemoveVolumes: true,
+		Context:       ctx,
 	})
 	if err != nil {
 		return fmt.Errorf("Error while removing container with name %s: %w", containerName, err)
@@ -554,9 +906,31 @@ func (d *Pool) RemoveContainerByName(containerName string) error {
 	return nil
 }
 
-// Purge removes a container and linked volumes from docker.
+// Purge removes a container and linked volumes from docker. Containers started with RunOptions.Reuse are left
+// running.
 func (d *Pool) Purge(r *Resource) error {
-	if err := d.Client.RemoveContainer(dc.RemoveContainerOptions{ID: r.Container.ID, Force: true, RemoveVolumes: true}); err != nil {
+	return d.PurgeContext(context.Background(), r)
+}
+
+// PurgeContext removes a container and linked volumes from docker. Containers started with RunOptions.Reuse are
+// left running. The context can be used to cancel the removal.
+func (d *Pool) PurgeContext(ctx context.Context, r *Resource) error {
+	if r.reuse {
+		return nil
+	}
+
+	return d.ForcePurgeContext(ctx, r)
+}
+
+// ForcePurge removes a container and linked volumes from docker, even if it was started with RunOptions.Reuse.
+func (d *Pool) ForcePurge(r *Resource) error {
+	return d.ForcePurgeContext(context.Background(), r)
+}
+
+// ForcePurgeContext removes a container and linked volumes from docker, even if it was started with
+// RunOptions.Reuse. The context can be used to cancel the removal.
+func (d *Pool) ForcePurgeContext(ctx context.Context, r *Resource) error {
+	if err := d.Client.RemoveContainer(dc.RemoveContainerOptions{ID: r.Container.ID, Force: true, RemoveVolumes: true, Context: ctx}); err != nil {
 		return err
 	}
 
@@ -565,13 +939,20 @@ func (d *Pool) Purge(r *Resource) error {
 
 // Retry is an exponential backoff retry helper. You can use it to wait for e.g. mysql to boot up.
 func (d *Pool) Retry(op func() error) error {
+	return d.RetryContext(context.Background(), op)
+}
+
+// RetryContext is an exponential backoff retry helper. You can use it to wait for e.g. mysql to boot up.
+// It stops retrying as soon as the context is done and returns the context's error in that case.
+// It gives up after MaxWait, which is set to a minute if it is zero.
+func (d *Pool) RetryContext(ctx context.Context, op func() error) error {
 	if d.MaxWait == 0 {
 		d.MaxWait = time.Minute
 	}
 	bo := backoff.NewExponentialBackOff()
 	bo.MaxInterval = time.Second * 5
 	bo.MaxElapsedTime = d.MaxWait
-	if err := backoff.Retry(op, bo); err != nil {
+	if err := backoff.Retry(op, backoff.WithContext(bo, ctx)); err != nil {
 		if bo.NextBackOff() == backoff.Stop {
 			return fmt.Errorf("reached retry deadline: %w", err)
 		}
@@ -582,16 +963,37 @@ func (d *Pool) Retry(op func() error) error {
 	return nil
 }
 
+// maxWait returns MaxWait, or its default of a minute if it is zero.
+func (d *Pool) maxWait() time.Duration {
+	if d.MaxWait == 0 {
+		return time.Minute
+	}
+	return d.MaxWait
+}
+
 // CurrentContainer returns current container descriptor if this function called within running container.
 // It returns ErrNotInContainer as error if this function running not in container.
 func (d *Pool) CurrentContainer() (*Resource, error) {
+	return d.CurrentContainerContext(context.Background())
+}
+
+// CurrentContainerContext returns current container descriptor if this function called within running container.
+// It returns ErrNotInContainer as error if this function running not in container.
+// The context can be used to cancel the lookup.
+func (d *Pool) CurrentContainerContext(ctx context.Context) (*Resource, error) {
 	// docker daemon puts short container id into hostname
 	hostname, err := os.Hostname()
 	if err != nil {
 		return nil, fmt.Errorf("Get hostname failed: %w", err)
 	}
 
-	container, err := d.Client.InspectContainer(hostname)
+	container, err := d.Client.InspectContainerWithContext(hostname, ctx)
+	if _, ok := err.(*dc.NoSuchContainer); ok {
+		// the hostname may have been changed, or the engine does not set it to the container id
+		if id := containerIDFromProc(); id != "" {
+			container, err = d.Client.InspectContainerWithContext(id, ctx)
+		}
+	}
 	switch err.(type) {
 	case nil:
 		return &Resource{
@@ -607,11 +1009,19 @@ func (d *Pool) CurrentContainer() (*Resource, error) {
 
 // CreateNetwork creates docker network. It's useful for linking multiple containers.
 func (d *Pool) CreateNetwork(name string, opts ...func(config *dc.CreateNetworkOptions)) (*Network, error) {
+	return d.CreateNetworkContext(context.Background(), name, opts...)
+}
+
+// CreateNetworkContext creates docker network. It's useful for linking multiple containers.
+// The context can be used to cancel the creation.
+func (d *Pool) CreateNetworkContext(ctx context.Context, name string, opts ...func(config *dc.CreateNetworkOptions)) (*Network, error) {
 	var cfg dc.CreateNetworkOptions
 	cfg.Name = name
+	cfg.Context = ctx
 	for _, opt := range opts {
 		opt(&cfg)
 	}
+	cfg.Labels = d.sessionLabels(cfg.Labels)
 
 	network, err := d.Client.CreateNetwork(cfg)
 	if err != nil {
@@ -648,12 +1058,59 @@ func (d *Pool) NetworksByName(name string) ([]Network, error) {
 
 // RemoveNetwork disconnects containers and removes provided network.
 func (d *Pool) RemoveNetwork(network *Network) error {
+	return d.RemoveNetworkContext(context.Background(), network)
+}
+
+// RemoveNetworkContext disconnects containers and removes provided network.
+// The context can be used to cancel the requests.
+func (d *Pool) RemoveNetworkContext(ctx context.Context, network *Network) error {
 	for container := range network.Network.Containers {
 		_ = d.Client.DisconnectNetwork(
 			network.Network.ID,
-			dc.NetworkConnectionOptions{Container: container, Force: true},
+			dc.NetworkConnectionOptions{Container: container, Force: true, Context: ctx},
 		)
 	}
 
-	return d.Client.RemoveNetwork(network.Network.ID)
+	return d.Client.RemoveNetworkWithContext(network.Network.ID, ctx)
+}
+
+// CreateVolume creates docker volume. It's useful for sharing data between containers.
+func (d *Pool) CreateVolume(name string, opts ...func(config *dc.CreateVolumeOptions)) (*Volume, error) {
+	return d.CreateVolumeContext(context.Background(), name, opts...)
+}
+
+// CreateVolumeContext creates docker volume. It's useful for sharing data between containers.
+// The context can be used to cancel the creation.
+func (d *Pool) CreateVolumeContext(ctx context.Context, name string, opts ...func(config *dc.CreateVolumeOptions)) (*Volume, error) {
+	var cfg dc.CreateVolumeOptions
+	cfg.Name = name
+	cfg.Context = ctx
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	cfg.Labels = d.sessionLabels(cfg.Labels)
+
+	volume, err := d.Client.CreateVolume(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Volume{
+		pool:   d,
+		Volume: volume,
+	}, nil
+}
+
+// RemoveVolume removes provided volume.
+func (d *Pool) RemoveVolume(volume *Volume) error {
+	return d.RemoveVolumeContext(context.Background(), volume)
+}
+
+// RemoveVolumeContext removes provided volume. The context can be used to cancel the removal.
+func (d *Pool) RemoveVolumeContext(ctx context.Context, volume *Volume) error {
+	return d.Client.RemoveVolumeWithOptions(dc.RemoveVolumeOptions{
+		Name:    volume.Volume.Name,
+		Force:   true,
+		Context: ctx,
+	})
 }
@@ -5,7 +5,9 @@ package dockertest
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -18,6 +20,7 @@ import (
 	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/lib/pq"
 	dc "github.com/ory/dockertest/v3/docker"
+	"github.com/ory/dockertest/v3/fakedocker"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -25,22 +28,63 @@ import (
 var (
 	docker = os.Getenv("DOCKER_URL")
 	pool   *Pool
+
+	// fake is the server the suite runs against if no Docker daemon is reachable.
+	fake *fakedocker.Server
 )
 
 func TestMain(m *testing.M) {
+	RunReaper()
+
 	var err error
 	pool, err = NewPool(docker)
 	if err != nil {
 		log.Fatalf("Could not construct pool: %s", err)
 	}
 	err = pool.Client.Ping()
-	if err != nil {
+	if err != nil && docker != "" {
 		log.Fatalf("Could not connect to Docker: %s", err)
 	}
-	os.Exit(m.Run())
+	if err != nil {
+		log.Printf("Could not connect to Docker, running against fakedocker: %s", err)
+		fake = fakedocker.NewServer()
+		docker = fake.URL
+		pool, err = NewPool(docker)
+		if err != nil {
+			log.Fatalf("Could not construct pool: %s", err)
+		}
+	}
+
+	code := m.Run()
+	if fake != nil {
+		fake.Close()
+	}
+	os.Exit(code)
+}
+
+// newFakePool returns a pool backed by a fakedocker server of its own, for tests that script the daemon.
+func newFakePool(t *testing.T) (*fakedocker.Server, *Pool) {
+	fake := fakedocker.NewServer()
+	t.Cleanup(fake.Close)
+
+	pool, err := NewPool(fake.URL)
+	require.Nil(t, err)
+	require.Nil(t, pool.Client.Ping())
+	pool.MaxWait = 5 * time.Second
+	return fake, pool
+}
+
+// requireDocker skips tests that talk to the services running in their containers, which fakedocker only pretends
+// to run.
+func requireDocker(t *testing.T) {
+	t.Helper()
+	if fake != nil {
+		t.Skip("requires a Docker daemon")
+	}
 }
 
 func TestPostgres(t *testing.T) {
+	requireDocker(t)
 	resource, err := pool.Run("postgres", "9.5", []string{"POSTGRES_PASSWORD=secret"})
 	require.Nil(t, err)
 	assert.NotEmpty(t, resource.GetPort("5432/tcp"))
@@ -59,6 +103,7 @@ func TestPostgres(t *testing.T) {
 }
 
 func TestMongo(t *testing.T) {
+	requireDocker(t)
 	options := &RunOptions{
 		Repository: "mongo",
 		Tag:        "3.3.12",
@@ -88,6 +133,7 @@ func TestMongo(t *testing.T) {
 }
 
 func TestMysqlWithPlatform(t *testing.T) {
+	requireDocker(t)
 	resource, err := pool.RunWithOptions(&RunOptions{
 		Repository: "mysql",
 		Tag:        "5.7",
@@ -214,6 +260,7 @@ func TestBuildImage(t *testing.T) {
 }
 
 func TestBuildImageWithBuildArg(t *testing.T) {
+	requireDocker(t)
 	// Create Dockerfile in temp dir
 	dir := t.TempDir()
 
@@ -254,6 +301,7 @@ CMD sleep 10
 }
 
 func TestExpire(t *testing.T) {
+	requireDocker(t)
 	resource, err := pool.Run("postgres", "9.5", []string{"POSTGRES_PASSWORD=secret"})
 	require.Nil(t, err)
 	assert.NotEmpty(t, resource.GetPort("5432/tcp"))
@@ -339,6 +387,7 @@ func TestRemoveContainerByName(t *testing.T) {
 }
 
 func TestExec(t *testing.T) {
+	requireDocker(t)
 	resource, err := pool.Run("postgres", "9.5", []string{"POSTGRES_PASSWORD=secret"})
 	require.Nil(t, err)
 	assert.NotEmpty(t, resource.GetPort("5432/tcp"))
@@ -368,6 +417,7 @@ func TestExec(t *testing.T) {
 }
 
 func TestNetworking_on_start(t *testing.T) {
+	requireDocker(t)
 	network, err := pool.CreateNetwork("test-on-start")
 	require.Nil(t, err)
 	defer network.Close()
@@ -408,6 +458,7 @@ func TestNetworking_on_start(t *testing.T) {
 }
 
 func TestNetworking_after_start(t *testing.T) {
+	requireDocker(t)
 	network, err := pool.CreateNetwork("test-after-start")
 	require.Nil(t, err)
 	defer network.Close()
@@ -474,6 +525,7 @@ func TestClientRaceCondition(t *testing.T) {
 }
 
 func TestExecStatus(t *testing.T) {
+	requireDocker(t)
 	resource, err := pool.RunWithOptions(&RunOptions{
 		Repository: "alpine",
 		Tag:        "3.16",
@@ -488,3 +540,92 @@ func TestExecStatus(t *testing.T) {
 	require.Nil(t, err)
 	require.Equal(t, 42, exitCode)
 }
+
+func TestRunWithOptionsContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := pool.RunWithOptionsContext(ctx, &RunOptions{
+		Name:       "cancelled",
+		Repository: "alpine",
+		Tag:        "3.16",
+		Cmd:        []string{"tail", "-f", "/dev/null"},
+	})
+	require.ErrorIs(t, err, context.Canceled)
+
+	_, ok := pool.ContainerByName("cancelled")
+	require.False(t, ok)
+}
+
+func TestRunWithOptionsContextCancelledAfterCreate(t *testing.T) {
+	fake, pool := newFakePool(t)
+	fake.AddImage("busybox:latest")
+
+	for _, tc := range []struct {
+		pattern string
+		opts    RunOptions
+		phase   Phase
+	}{
+		{pattern: "/containers/create", opts: RunOptions{Repository: "busybox"}, phase: PhaseCreate},
+		{pattern: "/containers/create", opts: RunOptions{Repository: "busybox", Name: "cancelled"}, phase: PhaseCreate},
+		{
+			pattern: "/containers/*/archive",
+			opts:    RunOptions{Repository: "busybox", Files: []File{{Path: "/etc/app.conf", Content: []byte("port=8080\n")}}},
+			phase:   PhaseFiles,
+		},
+		{pattern: "/containers/*/start", opts: RunOptions{Repository: "busybox"}, phase: PhaseStart},
+	} {
+		ctx, cancel := context.WithCancel(context.Background())
+		// the daemon handles the request, but the caller gives up before it receives the response
+		restore := fake.After("", tc.pattern, func(r *http.Request) {
+			cancel()
+			<-r.Context().Done()
+		})
+		opts := tc.opts
+		_, err := pool.RunWithOptionsContext(ctx, &opts)
+		restore()
+		cancel()
+
+		var runErr *RunError
+		require.ErrorAs(t, err, &runErr, tc.pattern)
+		assert.Equal(t, tc.phase, runErr.Phase)
+		assert.Nil(t, runErr.Rollback)
+
+		containers, err := pool.Client.ListContainers(dc.ListContainersOptions{
+			All:     true,
+			Filters: map[string][]string{"label": {createLabel}},
+		})
+		require.Nil(t, err)
+		assert.Empty(t, containers, tc.pattern)
+		containers, err = pool.Client.ListContainers(dc.ListContainersOptions{All: true})
+		require.Nil(t, err)
+		assert.Empty(t, containers, tc.pattern)
+	}
+}
+
+func TestRetryContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	err := pool.RetryContext(ctx, func() error {
+		return errors.New("not yet")
+	})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestExecContext(t *testing.T) {
+	requireDocker(t)
+	resource, err := pool.RunWithOptions(&RunOptions{
+		Repository: "alpine",
+		Tag:        "3.16",
+		Cmd:        []string{"tail", "-f", "/dev/null"},
+	})
+	require.Nil(t, err)
+	defer resource.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, err = resource.ExecContext(ctx, []string{"/bin/sleep", "30"}, ExecOptions{})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
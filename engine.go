@@ -0,0 +1,143 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package dockertest
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	// EngineDocker is the name of the Docker engine.
+	EngineDocker = "docker"
+	// EnginePodman is the name of the Podman engine, which serves a Docker compatible API.
+	EnginePodman = "podman"
+)
+
+// Engine describes the container engine a pool talks to.
+type Engine struct {
+	// Name is EngineDocker or EnginePodman.
+	Name    string
+	Version string
+
+	// Rootless is set if the engine runs without root privileges.
+	Rootless bool
+}
+
+// Podman reports whether the engine is Podman.
+func (e Engine) Podman() bool {
+	return e.Name == EnginePodman
+}
+
+// Engine returns the container engine behind the pool's client, which is detected from its version and info the
+// first time it is needed.
+func (d *Pool) Engine() (Engine, error) {
+	return d.EngineContext(context.Background())
+}
+
+// EngineContext is like Engine. The context can be used to cancel the detection.
+func (d *Pool) EngineContext(ctx context.Context) (Engine, error) {
+	d.engineMu.Lock()
+	defer d.engineMu.Unlock()
+	if d.engine != nil {
+		return *d.engine, nil
+	}
+
+	version, err := d.Client.VersionWithContext(ctx)
+	if err != nil {
+		return Engine{}, fmt.Errorf("Failed to get engine version: %w", err)
+	}
+	info, err := d.Client.InfoWithContext(ctx)
+	if err != nil {
+		return Engine{}, fmt.Errorf("Failed to get engine info: %w", err)
+	}
+
+	e := Engine{Name: EngineDocker, Version: version.Get("Version")}
+	// Podman names itself in the platform and the components of its version
+	if strings.Contains(strings.ToLower(version.Get("Platform")+version.Get("Components")), "podman") {
+		e.Name = EnginePodman
+	}
+	for _, opt := range info.SecurityOptions {
+		if opt == "name=rootless" {
+			e.Rootless = true
+		}
+	}
+
+	d.engine = &e
+	return e, nil
+}
+
+// engineOrDocker returns the engine of the pool, assuming Docker if it cannot be detected, in which case the
+// subsequent requests fail anyway.
+func (d *Pool) engineOrDocker(ctx context.Context) Engine {
+	e, err := d.EngineContext(ctx)
+	if err != nil {
+		return Engine{Name: EngineDocker}
+	}
+	return e
+}
+
+// socketCandidates returns the sockets NewPool probes if no endpoint is configured, in order: the Docker socket,
+// the socket of rootless Docker, and the sockets of rootless and rootful Podman.
+func socketCandidates() []string {
+	candidates := []string{"/var/run/docker.sock"}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		candidates = append(candidates,
+			filepath.Join(dir, "docker.sock"),
+			filepath.Join(dir, "podman", "podman.sock"))
+	}
+	return append(candidates, "/run/podman/podman.sock")
+}
+
+// defaultSocket returns the endpoint of the first socket of socketCandidates that exists, or of the Docker socket if
+// none does.
+func defaultSocket() string {
+	for _, socket := range socketCandidates() {
+		if fi, err := os.Stat(socket); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			return "unix://" + socket
+		}
+	}
+	return "unix:///var/run/docker.sock"
+}
+
+var (
+	containerIDInCgroup       = regexp.MustCompile(`(?:docker|libpod)[-/]([0-9a-f]{64})`)
+	containerIDInMountinfo    = regexp.MustCompile(`/containers/(?:overlay-containers/)?([0-9a-f]{64})/`)
+	containerIDInContainerEnv = regexp.MustCompile(`^id="([0-9a-f]{64})"$`)
+)
+
+// containerIDFromProc finds the ID of the container the process runs in, for engines that do not set the hostname
+// to it, e.g. because the container was started with a custom hostname. Podman writes it to /run/.containerenv, and
+// both engines leave it in the cgroup and mount paths.
+func containerIDFromProc() string {
+	if id := scanFile("/run/.containerenv", containerIDInContainerEnv); id != "" {
+		return id
+	}
+	if id := scanFile("/proc/self/cgroup", containerIDInCgroup); id != "" {
+		return id
+	}
+	return scanFile("/proc/self/mountinfo", containerIDInMountinfo)
+}
+
+// scanFile returns the first submatch of re in the lines of the file at path, or an empty string.
+func scanFile(path string, re *regexp.Regexp) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if m := re.FindStringSubmatch(scanner.Text()); m != nil {
+			return m[1]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,83 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package dockertest
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/ory/dockertest/v3/fakedocker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPodman(t *testing.T) {
+	fake, pool := newFakePool(t)
+
+	engine, err := pool.Engine()
+	require.Nil(t, err)
+	assert.Equal(t, EngineDocker, engine.Name)
+	assert.False(t, engine.Rootless)
+
+	resource, err := pool.RunWithOptions(&RunOptions{Repository: "busybox", ExposedPorts: []string{"80/tcp"}})
+	require.Nil(t, err)
+	assert.Equal(t, "SIGWINCH", resource.Container.Config.StopSignal)
+
+	fake.EmulatePodman(true)
+	pool, err = NewPool(fake.URL)
+	require.Nil(t, err)
+
+	engine, err = pool.Engine()
+	require.Nil(t, err)
+	assert.Equal(t, EnginePodman, engine.Name)
+	assert.True(t, engine.Podman())
+	assert.True(t, engine.Rootless)
+
+	resource, err = pool.RunWithOptions(&RunOptions{Repository: "busybox", ExposedPorts: []string{"80/tcp"}})
+	require.Nil(t, err)
+	assert.Empty(t, resource.Container.Config.StopSignal)
+	assert.Equal(t, "localhost", resource.GetBoundIP("80/tcp"))
+	assert.Equal(t, "localhost:"+resource.GetPort("80/tcp"), resource.GetHostPort("80/tcp"))
+}
+
+func TestPodmanSocket(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sockets are probed on unix only")
+	}
+	if _, err := os.Stat("/var/run/docker.sock"); err == nil {
+		t.Skip("the Docker socket takes precedence over the Podman socket")
+	}
+	fake := fakedocker.NewServer()
+	t.Cleanup(fake.Close)
+	fake.EmulatePodman(true)
+
+	// unix socket paths are limited in length, so the runtime directory must be short
+	runtimeDir, err := os.MkdirTemp("", "xdg")
+	require.Nil(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(runtimeDir) })
+	require.Nil(t, os.Mkdir(filepath.Join(runtimeDir, "podman"), 0o700))
+	listener, err := net.Listen("unix", filepath.Join(runtimeDir, "podman", "podman.sock"))
+	require.Nil(t, err)
+	server := &http.Server{Handler: fake.Config.Handler}
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(func() { _ = server.Close() })
+
+	t.Setenv("XDG_RUNTIME_DIR", runtimeDir)
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+	t.Setenv("DOCKER_MACHINE_NAME", "")
+	t.Setenv("DOCKER_HOST", "")
+	t.Setenv("DOCKER_URL", "")
+	t.Setenv("DOCKER_CONTEXT", "")
+
+	pool, err := NewPool("")
+	require.Nil(t, err)
+	assert.Equal(t, "unix://"+filepath.Join(runtimeDir, "podman", "podman.sock"), pool.Client.Endpoint())
+	engine, err := pool.Engine()
+	require.Nil(t, err)
+	assert.True(t, engine.Podman())
+}
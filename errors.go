@@ -0,0 +1,147 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package dockertest
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	dc "github.com/ory/dockertest/v3/docker"
+	"github.com/ory/dockertest/v3/docker/pkg/jsonmessage"
+)
+
+// The errors RunWithOptions fails with can be told apart with errors.Is, e.g.
+//
+//	if errors.Is(err, dockertest.ErrPortConflict) {
+//		// pick another port
+//	}
+var (
+	// ErrImageNotFound means that the image does not exist locally or in its registry.
+	ErrImageNotFound = dc.ErrNoSuchImage
+
+	// ErrPortConflict means that a host port the container is bound to is already in use.
+	ErrPortConflict = dc.ErrPortAllocated
+
+	// ErrNameConflict means that a container with the requested name exists already.
+	ErrNameConflict = dc.ErrContainerAlreadyExists
+
+	// ErrPullAuth means that the registry refused to hand out the image, e.g. because of missing credentials.
+	ErrPullAuth = dc.ErrPullAccessDenied
+
+	// ErrDaemonUnreachable means that the Docker daemon could not be connected to.
+	ErrDaemonUnreachable = errors.New("docker daemon is unreachable")
+)
+
+// Phase is the step of starting a container that failed.
+type Phase string
+
+const (
+	PhasePull    Phase = "pull"
+	PhaseCreate  Phase = "create"
+	PhaseFiles   Phase = "files"
+	PhaseStart   Phase = "start"
+	PhaseInspect Phase = "inspect"
+	PhaseWait    Phase = "wait"
+)
+
+// RunError is returned by RunWithOptions if the container could not be started, or did not become ready as
+// decided by RunOptions.WaitFor. It records the phase that failed,
+// and the error of the Docker API, which is a *docker.Error in most cases:
+//
+//	var runErr *dockertest.RunError
+//	if errors.As(err, &runErr) && runErr.Phase == dockertest.PhasePull {
+//		// ...
+//	}
+//
+// A container that was created already is removed again. If that fails as well, Rollback holds the error and
+// ContainerID the container that was left behind. Both errors can be matched with errors.Is and errors.As, Err
+// taking precedence over Rollback.
+type RunError struct {
+	Phase Phase
+	Err   error
+
+	ContainerID string
+	Rollback    error
+}
+
+func (e *RunError) Error() string {
+	var msg string
+	switch e.Phase {
+	case PhasePull:
+		msg = fmt.Sprintf("Failed to pull image: %s", e.Err)
+	case PhaseFiles:
+		msg = fmt.Sprintf("Failed to write files into container: %s", e.Err)
+	case PhaseInspect:
+		msg = fmt.Sprintf("Failed to inspect container: %s", e.Err)
+	case PhaseWait:
+		msg = fmt.Sprintf("Container did not become ready: %s", e.Err)
+	default:
+		msg = fmt.Sprintf("Failed to %s container: %s", e.Phase, e.Err)
+	}
+	if e.Rollback != nil {
+		msg += fmt.Sprintf(" (removing container %s also failed: %s)", e.ContainerID, e.Rollback)
+	}
+	return msg
+}
+
+func (e *RunError) Unwrap() error {
+	return e.Err
+}
+
+// Is classifies the errors that do not come from docker.Error, such as errors reported within the progress of a
+// pull and errors connecting to the daemon, and matches the error of a failed rollback.
+func (e *RunError) Is(target error) bool {
+	if e.Rollback != nil && errors.Is(e.Rollback, target) {
+		return true
+	}
+	if target == ErrDaemonUnreachable {
+		return isDaemonUnreachable(e.Err)
+	}
+
+	var jerr *jsonmessage.JSONError
+	if errors.As(e.Err, &jerr) {
+		return target != nil && dc.ClassifyPullError(jerr.Code, jerr.Message) == target
+	}
+	return false
+}
+
+// As matches the error of a failed rollback, as Unwrap only returns Err. errors.As calls As before it unwraps
+// RunError, so Err is matched here first.
+func (e *RunError) As(target interface{}) bool {
+	if e.Err != nil && errors.As(e.Err, target) {
+		return true
+	}
+	return e.Rollback != nil && errors.As(e.Rollback, target)
+}
+
+func isDaemonUnreachable(err error) bool {
+	if errors.Is(err, dc.ErrConnectionRefused) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// BuildError is returned by BuildAndRunWithBuildOptions and Compose if a step of building Image failed. Output holds
+// the output of the step that failed, starting with the step itself, e.g. "Step 3/5 : RUN go build ./..." or, with
+// BuildKit, "[build 3/5] RUN go build ./...".
+type BuildError struct {
+	Image  string
+	Output string
+	Err    error
+}
+
+func (e *BuildError) Error() string {
+	msg := fmt.Sprintf("Failed to build image %s: %s", e.Image, e.Err)
+	if e.Output != "" {
+		msg += "\n" + strings.TrimRight(e.Output, "\n")
+	}
+	return msg
+}
+
+func (e *BuildError) Unwrap() error {
+	return e.Err
+}
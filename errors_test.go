@@ -0,0 +1,118 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package dockertest
+
+import (
+	"net/http"
+	"testing"
+
+	dc "github.com/ory/dockertest/v3/docker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunErrors(t *testing.T) {
+	fake, pool := newFakePool(t)
+
+	first, err := pool.RunWithOptions(&RunOptions{
+		Repository:   "busybox",
+		Name:         "taken",
+		PortBindings: map[dc.Port][]dc.PortBinding{"80/tcp": {{HostPort: "8080"}}},
+	})
+	require.Nil(t, err)
+
+	var runErr *RunError
+	_, err = pool.RunWithOptions(&RunOptions{Repository: "busybox", Name: "taken"})
+	require.ErrorIs(t, err, ErrNameConflict)
+	require.ErrorAs(t, err, &runErr)
+	assert.Equal(t, PhaseCreate, runErr.Phase)
+
+	_, err = pool.RunWithOptions(&RunOptions{
+		Repository:   "busybox",
+		PortBindings: map[dc.Port][]dc.PortBinding{"80/tcp": {{HostPort: "8080"}}},
+	})
+	require.ErrorIs(t, err, ErrPortConflict)
+	require.ErrorAs(t, err, &runErr)
+	assert.Equal(t, PhaseStart, runErr.Phase)
+	var apiErr *dc.Error
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusInternalServerError, apiErr.Status)
+
+	restore := fake.Fail(http.MethodPost, "/images/create", http.StatusNotFound, "manifest for private:latest not found: manifest unknown")
+	_, err = pool.Run("private", "latest", nil)
+	require.ErrorIs(t, err, ErrImageNotFound)
+	require.ErrorAs(t, err, &runErr)
+	assert.Equal(t, PhasePull, runErr.Phase)
+	restore()
+
+	restore = fake.Fail(http.MethodPost, "/images/create", http.StatusNotFound, "pull access denied for private, repository does not exist or may require 'docker login'")
+	_, err = pool.Run("private", "latest", nil)
+	require.ErrorIs(t, err, ErrPullAuth)
+	assert.NotErrorIs(t, err, ErrImageNotFound)
+	restore()
+
+	require.Nil(t, pool.Purge(first))
+
+	fake.Close()
+	_, err = pool.Run("busybox", "latest", nil)
+	require.ErrorIs(t, err, ErrDaemonUnreachable)
+}
+
+func TestRollback(t *testing.T) {
+	fake, pool := newFakePool(t)
+
+	restore := fake.Fail(http.MethodPost, "/containers/*/start", http.StatusInternalServerError, "cannot start")
+	_, err := pool.Run("busybox", "latest", nil)
+	require.Error(t, err)
+	containers, err := pool.Client.ListContainers(dc.ListContainersOptions{All: true})
+	require.Nil(t, err)
+	assert.Empty(t, containers)
+
+	restoreRemove := fake.Fail(http.MethodDelete, "/containers/*", http.StatusInternalServerError, "removal already in progress")
+	_, err = pool.Run("busybox", "latest", nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot start")
+	assert.Contains(t, err.Error(), "removal already in progress")
+
+	var runErr *RunError
+	require.ErrorAs(t, err, &runErr)
+	assert.Equal(t, PhaseStart, runErr.Phase)
+	_, ok := fake.Container(runErr.ContainerID)
+	assert.True(t, ok)
+
+	var apiErr *dc.Error
+	require.ErrorAs(t, runErr.Rollback, &apiErr)
+	assert.Equal(t, "removal already in progress", apiErr.Message)
+
+	// the error that caused the rollback takes precedence
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, "cannot start", apiErr.Message)
+
+	restore()
+	restoreRemove()
+	require.Nil(t, pool.Client.RemoveContainer(dc.RemoveContainerOptions{ID: runErr.ContainerID, Force: true}))
+}
+
+func TestRunErrorAs(t *testing.T) {
+	err := error(&RunError{
+		Phase:       PhaseCreate,
+		Err:         &dc.Error{Status: http.StatusConflict, Message: "name in use"},
+		ContainerID: "abc",
+		Rollback:    &dc.Error{Status: http.StatusInternalServerError, Message: "removal already in progress"},
+	})
+
+	var apiErr *dc.Error
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusConflict, apiErr.Status)
+
+	var noSuchContainer *dc.NoSuchContainer
+	err = &RunError{
+		Phase:       PhaseStart,
+		Err:         &dc.Error{Status: http.StatusInternalServerError, Message: "cannot start"},
+		ContainerID: "abc",
+		Rollback:    &dc.NoSuchContainer{ID: "abc"},
+	}
+	require.ErrorAs(t, err, &noSuchContainer)
+	assert.Equal(t, "abc", noSuchContainer.ID)
+}
@@ -0,0 +1,49 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package dockertest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ory/dockertest/v3/fakedocker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResourceEvents(t *testing.T) {
+	fake, pool := newFakePool(t)
+	fake.SetBehavior("busybox", fakedocker.Behavior{Health: "healthy"})
+
+	other, err := pool.Run("busybox", "latest", nil)
+	require.Nil(t, err)
+	resource, err := pool.Run("busybox", "latest", nil)
+	require.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	events, errs := resource.Events(ctx)
+
+	require.Nil(t, fake.Exit(other.Container.ID, 1))
+	require.Nil(t, fake.Exit(resource.Container.ID, 2))
+
+	var actions []string
+	for len(actions) < 3 {
+		select {
+		case e := <-events:
+			require.Equal(t, resource.Container.ID, e.Actor.ID)
+			actions = append(actions, e.Action)
+		case err := <-errs:
+			t.Fatalf("event stream failed: %s", err)
+		case <-ctx.Done():
+			t.Fatalf("received only %v", actions)
+		}
+	}
+	assert.Equal(t, []string{"start", "health_status: healthy", "die"}, actions)
+
+	cancel()
+	for range events {
+	}
+}
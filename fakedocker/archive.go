@@ -0,0 +1,230 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package fakedocker
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ory/dockertest/v3/docker/types"
+)
+
+// File is a file, directory or symbolic link in the filesystem of a container.
+type File struct {
+	// Mode holds the type and permission bits, e.g. os.ModeDir|0o755.
+	Mode       os.FileMode
+	Data       []byte
+	LinkTarget string
+	UID, GID   int
+	ModTime    time.Time
+}
+
+// newFilesystem returns the filesystem every container starts with.
+func newFilesystem() map[string]*File {
+	fs := map[string]*File{}
+	for dir, perm := range map[string]os.FileMode{"/": 0o755, "/etc": 0o755, "/root": 0o700, "/tmp": 0o777 | os.ModeSticky, "/var": 0o755} {
+		fs[dir] = &File{Mode: os.ModeDir | perm, ModTime: now()}
+	}
+	return fs
+}
+
+// File returns a copy of the file at the absolute path p in the container with the given ID or name.
+func (s *Server) File(idOrName, p string) (File, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.findContainer(idOrName)
+	if !ok {
+		return File{}, false
+	}
+	f, ok := c.files[path.Clean(p)]
+	if !ok {
+		return File{}, false
+	}
+	return f.copy(), true
+}
+
+// WriteFile creates or replaces the file at the absolute path p in the container with the given ID or name, along
+// with its missing parent directories.
+func (s *Server) WriteFile(idOrName, p string, f File) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.findContainer(idOrName)
+	if !ok {
+		return fmt.Errorf("no such container: %s", idOrName)
+	}
+	if f.ModTime.IsZero() {
+		f.ModTime = now()
+	}
+	c.mkdirAll(path.Dir(path.Clean(p)))
+	f = f.copy()
+	c.files[path.Clean(p)] = &f
+	return nil
+}
+
+func (f File) copy() File {
+	f.Data = append([]byte(nil), f.Data...)
+	return f
+}
+
+// mkdirAll creates the directory dir and its missing parents. The caller must hold s.mu.
+func (c *container) mkdirAll(dir string) {
+	for ; dir != "/"; dir = path.Dir(dir) {
+		if _, ok := c.files[dir]; !ok {
+			c.files[dir] = &File{Mode: os.ModeDir | 0o755, ModTime: now()}
+		}
+	}
+}
+
+func (s *Server) containerArchive(w http.ResponseWriter, r *http.Request, idOrName string) {
+	p := r.URL.Query().Get("path")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.findContainer(idOrName)
+	if !ok {
+		writeError(w, http.StatusNotFound, "No such container: "+idOrName)
+		return
+	}
+	f, ok := c.files[path.Clean(path.Join("/", p))]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Could not find the file %s in container %s", p, idOrName))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodHead, http.MethodGet:
+		stat, _ := json.Marshal(types.ContainerPathStat{
+			Name:       path.Base(p),
+			Size:       int64(len(f.Data)),
+			Mode:       f.Mode,
+			Mtime:      f.ModTime,
+			LinkTarget: f.LinkTarget,
+		})
+		w.Header().Set("X-Docker-Container-Path-Stat", base64.StdEncoding.EncodeToString(stat))
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-tar")
+		w.WriteHeader(http.StatusOK)
+		_ = c.writeArchive(w, path.Clean(path.Join("/", p)), path.Base(p))
+	case http.MethodPut:
+		if !f.Mode.IsDir() {
+			writeError(w, http.StatusBadRequest, "extraction point is not a directory")
+			return
+		}
+		noOverwrite := r.URL.Query().Get("noOverwriteDirNonDir")
+		if err := c.extractArchive(r.Body, path.Clean(path.Join("/", p)), noOverwrite == "1" || noOverwrite == "true"); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	default:
+		writeError(w, http.StatusNotFound, "page not found")
+	}
+}
+
+// writeArchive writes the file at p and, if it is a directory, everything below it to w as a tar archive, with
+// entry names starting with name. The caller must hold s.mu.
+func (c *container) writeArchive(w io.Writer, p, name string) error {
+	var paths []string
+	for fp := range c.files {
+		if fp == p || strings.HasPrefix(fp, strings.TrimSuffix(p, "/")+"/") {
+			paths = append(paths, fp)
+		}
+	}
+	sort.Strings(paths)
+
+	tw := tar.NewWriter(w)
+	for _, fp := range paths {
+		f := c.files[fp]
+		// names are not cleaned, so that copying the contents of a directory ("dir/.") yields "./file"
+		entryName := name
+		if rel := strings.TrimPrefix(strings.TrimPrefix(fp, p), "/"); rel != "" {
+			entryName += "/" + rel
+		}
+		hdr := &tar.Header{
+			Name:    entryName,
+			Mode:    int64(f.Mode.Perm()),
+			Uid:     f.UID,
+			Gid:     f.GID,
+			ModTime: f.ModTime,
+		}
+		switch {
+		case f.Mode.IsDir():
+			hdr.Typeflag, hdr.Name = tar.TypeDir, hdr.Name+"/"
+		case f.Mode&os.ModeSymlink != 0:
+			hdr.Typeflag, hdr.Linkname = tar.TypeSymlink, f.LinkTarget
+		default:
+			hdr.Typeflag, hdr.Size = tar.TypeReg, int64(len(f.Data))
+		}
+		if f.Mode&os.ModeSticky != 0 {
+			hdr.Mode |= 0o1000
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(f.Data); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// extractArchive extracts the tar archive read from r into the directory dir. The caller must hold s.mu.
+func (c *container) extractArchive(r io.Reader, dir string, noOverwriteDirNonDir bool) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		target := path.Join(dir, hdr.Name)
+		if target != dir && !strings.HasPrefix(target, strings.TrimSuffix(dir, "/")+"/") {
+			return fmt.Errorf("invalid archive entry %q", hdr.Name)
+		}
+		f := &File{Mode: hdr.FileInfo().Mode(), UID: hdr.Uid, GID: hdr.Gid, ModTime: hdr.ModTime}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+		case tar.TypeSymlink:
+			f.LinkTarget = hdr.Linkname
+		case tar.TypeReg, tar.TypeRegA:
+			var buf bytes.Buffer
+			if _, err := io.Copy(&buf, tr); err != nil {
+				return err
+			}
+			f.Data = buf.Bytes()
+		default:
+			continue
+		}
+
+		if existing, ok := c.files[target]; ok && noOverwriteDirNonDir {
+			if existing.Mode.IsDir() && !f.Mode.IsDir() {
+				return fmt.Errorf("cannot overwrite directory %q with non-directory %q", target, hdr.Name)
+			}
+			if !existing.Mode.IsDir() && f.Mode.IsDir() {
+				return fmt.Errorf("cannot overwrite non-directory %q with directory %q", target, hdr.Name)
+			}
+		}
+		c.mkdirAll(path.Dir(target))
+		c.files[target] = f
+	}
+}
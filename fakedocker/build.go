@@ -0,0 +1,250 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package fakedocker
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	dc "github.com/ory/dockertest/v3/docker"
+	"github.com/ory/dockertest/v3/docker/pkg/jsonmessage"
+)
+
+// Build is an image build the server ran.
+type Build struct {
+	Tags        []string
+	Dockerfile  string
+	BuildArgs   map[string]string
+	Labels      map[string]string
+	Target      string
+	NoCache     bool
+	Pull        bool
+	CacheFrom   []string
+	NetworkMode string
+	// Version is "2" for BuildKit builds, which receive Secrets and the answers of SSH agents to a request for
+	// identities by ID from their session.
+	Version string
+	Secrets map[string][]byte
+	SSH     map[string][]byte
+
+	// Context holds the regular files of the build context by their slash separated path.
+	Context map[string][]byte
+
+	ImageID string
+}
+
+// Builds returns the builds the server ran, in order.
+func (s *Server) Builds() []Build {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Build{}, s.builds...)
+}
+
+// failingRun matches RUN instructions that exit with a non-zero code, which fail the build.
+var failingRun = regexp.MustCompile(`^RUN\s.*\bexit\s+([1-9][0-9]*)\b`)
+
+// echo matches the echo commands of RUN instructions, whose output the server prints.
+var echo = regexp.MustCompile(`\becho\s+([^;&|]*)`)
+
+// buildImage builds an image by walking through the instructions of the Dockerfile without running any of them.
+// RUN instructions print what they echo, and those containing "exit N" fail with code N. BuildKit builds mount the
+// secrets and SSH agents of RUN --mount flags from their session.
+func (s *Server) buildImage(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	b := Build{
+		Tags:        q["t"],
+		Dockerfile:  q.Get("dockerfile"),
+		BuildArgs:   map[string]string{},
+		Labels:      map[string]string{},
+		Target:      q.Get("target"),
+		NoCache:     q.Get("nocache") == "1",
+		Pull:        q.Get("pull") == "1",
+		NetworkMode: q.Get("networkmode"),
+		Version:     q.Get("version"),
+		Secrets:     map[string][]byte{},
+		SSH:         map[string][]byte{},
+		Context:     map[string][]byte{},
+	}
+	if b.Dockerfile == "" {
+		b.Dockerfile = "Dockerfile"
+	}
+	if args := q.Get("buildargs"); args != "" {
+		if err := json.Unmarshal([]byte(args), &b.BuildArgs); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid buildargs: "+err.Error())
+			return
+		}
+	}
+	if cacheFrom := q.Get("cachefrom"); cacheFrom != "" {
+		if err := json.Unmarshal([]byte(cacheFrom), &b.CacheFrom); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid cachefrom: "+err.Error())
+			return
+		}
+	}
+	if labels := q.Get("labels"); labels != "" {
+		if err := json.Unmarshal([]byte(labels), &b.Labels); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid labels: "+err.Error())
+			return
+		}
+	}
+
+	tr := tar.NewReader(r.Body)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid build context: "+err.Error())
+			return
+		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid build context: "+err.Error())
+			return
+		}
+		b.Context[path.Clean(hdr.Name)] = data
+	}
+
+	dockerfile, ok := b.Context[path.Clean(b.Dockerfile)]
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Cannot locate specified Dockerfile: "+b.Dockerfile)
+		return
+	}
+	steps := instructions(dockerfile)
+	if b.Target != "" {
+		var ok bool
+		if steps, ok = untilStage(steps, b.Target); !ok {
+			writeError(w, http.StatusInternalServerError, "failed to reach build target "+b.Target+" in Dockerfile")
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(w)
+	if b.Version == "2" {
+		if !s.buildKit(enc, &b, steps, q.Get("session")) {
+			return
+		}
+	} else if !legacyBuild(enc, steps) {
+		return
+	}
+
+	img := &dc.Image{
+		ID:           "sha256:" + newID(),
+		Created:      now(),
+		Config:       &dc.Config{Labels: b.Labels},
+		Architecture: "amd64",
+		OS:           "linux",
+	}
+	b.ImageID = img.ID
+
+	s.mu.Lock()
+	for _, tag := range b.Tags {
+		img.RepoTags = append(img.RepoTags, normalizeImage(tag))
+		s.images[normalizeImage(tag)] = img
+	}
+	if len(b.Tags) == 0 {
+		s.images[img.ID] = img
+	}
+	s.builds = append(s.builds, b)
+	s.mu.Unlock()
+
+	aux, _ := json.Marshal(map[string]string{"ID": img.ID})
+	if b.Version == "2" {
+		_ = enc.Encode(jsonmessage.JSONMessage{ID: "moby.image.id", Aux: (*json.RawMessage)(&aux)})
+		return
+	}
+	_ = enc.Encode(jsonmessage.JSONMessage{Aux: (*json.RawMessage)(&aux)})
+	_ = enc.Encode(jsonmessage.JSONMessage{Stream: fmt.Sprintf("Successfully built %s\n", strings.TrimPrefix(img.ID, "sha256:")[:12])})
+	for _, tag := range img.RepoTags {
+		_ = enc.Encode(jsonmessage.JSONMessage{Stream: fmt.Sprintf("Successfully tagged %s\n", tag)})
+	}
+}
+
+// stageName matches FROM instructions that name their stage.
+var stageName = regexp.MustCompile(`(?i)^FROM\s.*\sAS\s+(\S+)$`)
+
+// untilStage returns the instructions up to the end of the stage named target.
+func untilStage(steps []string, target string) ([]string, bool) {
+	found := false
+	for i, step := range steps {
+		if !strings.HasPrefix(strings.ToUpper(step), "FROM ") {
+			continue
+		}
+		if found {
+			return steps[:i], true
+		}
+		if m := stageName.FindStringSubmatch(step); m != nil && strings.EqualFold(m[1], target) {
+			found = true
+		}
+	}
+	return steps, found
+}
+
+// legacyBuild walks through the steps like the legacy builder, and reports whether they succeeded.
+func legacyBuild(enc *json.Encoder, steps []string) bool {
+	fail := func(code int, msg string) bool {
+		_ = enc.Encode(jsonmessage.JSONMessage{
+			Error:        &jsonmessage.JSONError{Code: code, Message: msg},
+			ErrorMessage: msg,
+		})
+		return false
+	}
+
+	for i, step := range steps {
+		_ = enc.Encode(jsonmessage.JSONMessage{Stream: fmt.Sprintf("Step %d/%d : %s\n", i+1, len(steps), step)})
+		if strings.HasPrefix(step, "RUN ") {
+			if mount.MatchString(step) {
+				return fail(0, "the --mount option requires BuildKit. Refer to https://docs.docker.com/go/buildkit/ to learn how to build images with BuildKit enabled")
+			}
+			_ = enc.Encode(jsonmessage.JSONMessage{Stream: fmt.Sprintf(" ---> Running in %s\n", newID()[:12])})
+			for _, m := range echo.FindAllStringSubmatch(step, -1) {
+				_ = enc.Encode(jsonmessage.JSONMessage{Stream: strings.Trim(strings.TrimSpace(m[1]), `"'`) + "\n"})
+			}
+		}
+		if m := failingRun.FindStringSubmatch(step); m != nil {
+			code, _ := strconv.Atoi(m[1])
+			return fail(code, fmt.Sprintf("The command '/bin/sh -c %s' returned a non-zero code: %d", strings.TrimSpace(step[len("RUN"):]), code))
+		}
+		_ = enc.Encode(jsonmessage.JSONMessage{Stream: fmt.Sprintf(" ---> %s\n", newID()[:12])})
+	}
+	return true
+}
+
+// instructions returns the instructions of a Dockerfile, without comments and with continued lines joined.
+func instructions(dockerfile []byte) []string {
+	var steps []string
+	var current strings.Builder
+	scanner := bufio.NewScanner(bytes.NewReader(dockerfile))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasSuffix(line, "\\") {
+			current.WriteString(strings.TrimSuffix(line, "\\"))
+			continue
+		}
+		current.WriteString(line)
+		steps = append(steps, current.String())
+		current.Reset()
+	}
+	if current.Len() > 0 {
+		steps = append(steps, current.String())
+	}
+	return steps
+}
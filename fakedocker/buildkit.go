@@ -0,0 +1,336 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package fakedocker
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http2"
+
+	"github.com/ory/dockertest/v3/docker/pkg/jsonmessage"
+)
+
+// sshAgentRequest asks an SSH agent for its identities (SSH_AGENTC_REQUEST_IDENTITIES), which is what the server
+// sends through forwarded agents.
+var sshAgentRequest = []byte{0, 0, 0, 1, 11}
+
+// mount matches the --mount flags of RUN instructions.
+var mount = regexp.MustCompile(`--mount=(\S+)`)
+
+// buildSession is a BuildKit session a client opened, which the server calls for secrets and SSH agents.
+type buildSession struct {
+	methods map[string]bool
+	cc      *http2.ClientConn
+}
+
+// session accepts a BuildKit session: the client takes over the connection and serves gRPC over HTTP/2 on it.
+func (s *Server) session(w http.ResponseWriter, r *http.Request) {
+	id := r.Header.Get("X-Docker-Expose-Session-Uuid")
+	if r.Header.Get("Upgrade") != "h2c" || id == "" {
+		writeError(w, http.StatusBadRequest, "session requires an h2c upgrade and a session ID")
+		return
+	}
+	methods := map[string]bool{}
+	for _, m := range r.Header.Values("X-Docker-Expose-Session-Grpc-Method") {
+		methods[m] = true
+	}
+
+	conn, rw, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	_, _ = rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: h2c\r\n\r\n")
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return
+	}
+	cc, err := (&http2.Transport{AllowHTTP: true}).NewClientConn(conn)
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	s.mu.Lock()
+	s.sessions[id] = &buildSession{methods: methods, cc: cc}
+	s.mu.Unlock()
+}
+
+// buildKit builds an image like buildImage, but reports the progress as BuildKit traces and provides the secrets
+// and SSH agents RUN instructions mount from the session of the build. The caller must have written the header.
+func (s *Server) buildKit(enc *json.Encoder, b *Build, steps []string, sessionID string) bool {
+	s.mu.Lock()
+	sess := s.sessions[sessionID]
+	s.mu.Unlock()
+
+	for i, step := range steps {
+		digest := "sha256:" + newID()
+		name := fmt.Sprintf("[%d/%d] %s", i+1, len(steps), step)
+		started := now()
+		encodeTrace(enc, traceVertex(digest, name, started, time.Time{}, ""))
+
+		fail := func(msg string) bool {
+			encodeTrace(enc, traceVertex(digest, name, started, now(), msg))
+			_ = enc.Encode(jsonmessage.JSONMessage{
+				Error:        &jsonmessage.JSONError{Message: msg},
+				ErrorMessage: msg,
+			})
+			return false
+		}
+
+		if strings.HasPrefix(step, "RUN ") {
+			for _, m := range mount.FindAllStringSubmatch(step, -1) {
+				if err := s.mount(b, sess, m[1]); err != nil {
+					return fail(err.Error())
+				}
+			}
+			for _, m := range echo.FindAllStringSubmatch(step, -1) {
+				out := strings.Trim(strings.TrimSpace(m[1]), `"'`) + "\n"
+				encodeTrace(enc, traceLog(digest, []byte(out)))
+			}
+			if m := failingRun.FindStringSubmatch(step); m != nil {
+				code, _ := strconv.Atoi(m[1])
+				command := strings.TrimSpace(mount.ReplaceAllString(step[len("RUN"):], ""))
+				return fail(fmt.Sprintf("process \"/bin/sh -c %s\" did not complete successfully: exit code: %d", command, code))
+			}
+		}
+		encodeTrace(enc, traceVertex(digest, name, started, now(), ""))
+	}
+	return true
+}
+
+// mount provides the secret or SSH agent described by the options of a --mount flag to the build.
+func (s *Server) mount(b *Build, sess *buildSession, opts string) error {
+	kind, id := "", ""
+	for _, opt := range strings.Split(opts, ",") {
+		k, v := opt, ""
+		if i := strings.IndexByte(opt, '='); i >= 0 {
+			k, v = opt[:i], opt[i+1:]
+		}
+		switch k {
+		case "type":
+			kind = v
+		case "id":
+			id = v
+		}
+	}
+
+	switch kind {
+	case "secret":
+		if sess == nil {
+			return errors.New("no active session for secret " + id)
+		}
+		resp, err := sess.call("/moby.buildkit.secrets.v1.Secrets/GetSecret", nil, protoBytes(nil, 1, []byte(id)))
+		if err != nil {
+			return fmt.Errorf("secret %s: %w", id, err)
+		}
+		s.mu.Lock()
+		b.Secrets[id] = field(resp, 1)
+		s.mu.Unlock()
+	case "ssh":
+		if id == "" {
+			id = "default"
+		}
+		if sess == nil {
+			return errors.New("no active session for ssh forward key " + id)
+		}
+		if _, err := sess.call("/moby.sshforward.v1.SSH/CheckAgent", nil, protoBytes(nil, 1, []byte(id))); err != nil {
+			return fmt.Errorf("ssh forward key %s: %w", id, err)
+		}
+		answer, err := sess.forwardAgent(id)
+		if err != nil {
+			return fmt.Errorf("ssh forward key %s: %w", id, err)
+		}
+		s.mu.Lock()
+		b.SSH[id] = answer
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+// call calls the unary method of the session with the protocol buffers message req and returns the response.
+func (bs *buildSession) call(method string, header http.Header, req []byte) ([]byte, error) {
+	if !bs.methods[method] {
+		return nil, fmt.Errorf("method %s is not exposed by the session", method)
+	}
+	resp, err := bs.roundTrip(method, header, bytes.NewReader(grpcFrame(req)))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if err := grpcStatus(resp); err != nil {
+		return nil, err
+	}
+	if len(body) < 5 {
+		return nil, errors.New("missing response message")
+	}
+	return body[5:], nil
+}
+
+// forwardAgent sends sshAgentRequest through the agent forwarded as id and returns the answer of the agent.
+func (bs *buildSession) forwardAgent(id string) ([]byte, error) {
+	const method = "/moby.sshforward.v1.SSH/ForwardAgent"
+	if !bs.methods[method] {
+		return nil, fmt.Errorf("method %s is not exposed by the session", method)
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		_, _ = pw.Write(grpcFrame(protoBytes(nil, 1, sshAgentRequest)))
+	}()
+	resp, err := bs.roundTrip(method, http.Header{"Buildkit.ssh.id": {id}}, pr)
+	if err != nil {
+		pw.Close()
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// the answer is a length-prefixed message, which may span several messages of the stream
+	var answer []byte
+	for len(answer) < 4 || len(answer) < 4+int(binary.BigEndian.Uint32(answer)) {
+		var hdr [5]byte
+		if _, err := io.ReadFull(resp.Body, hdr[:]); err != nil {
+			pw.Close()
+			_, _ = io.Copy(io.Discard, resp.Body)
+			if serr := grpcStatus(resp); serr != nil {
+				return nil, serr
+			}
+			return nil, err
+		}
+		msg := make([]byte, binary.BigEndian.Uint32(hdr[1:]))
+		if _, err := io.ReadFull(resp.Body, msg); err != nil {
+			pw.Close()
+			return nil, err
+		}
+		answer = append(answer, field(msg, 1)...)
+	}
+
+	pw.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return answer, grpcStatus(resp)
+}
+
+func (bs *buildSession) roundTrip(method string, header http.Header, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, "http://session"+method, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("Te", "trailers")
+	return bs.cc.RoundTrip(req)
+}
+
+// grpcStatus returns the error a gRPC call failed with, once its response body is read.
+func grpcStatus(resp *http.Response) error {
+	status := resp.Trailer.Get("Grpc-Status")
+	if status == "" {
+		status = resp.Header.Get("Grpc-Status")
+	}
+	if status == "0" {
+		return nil
+	}
+	msg := resp.Trailer.Get("Grpc-Message")
+	if msg == "" {
+		msg = resp.Header.Get("Grpc-Message")
+	}
+	return fmt.Errorf("rpc error: code = %s desc = %s", status, msg)
+}
+
+func grpcFrame(msg []byte) []byte {
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	return append(frame, msg...)
+}
+
+// encodeTrace writes the moby.buildkit.v1.StatusResponse holding the given fields as a BuildKit trace.
+func encodeTrace(enc *json.Encoder, fields ...[]byte) {
+	aux, _ := json.Marshal(base64.StdEncoding.EncodeToString(bytes.Join(fields, nil)))
+	_ = enc.Encode(jsonmessage.JSONMessage{ID: "moby.buildkit.trace", Aux: (*json.RawMessage)(&aux)})
+}
+
+// traceVertex returns the vertexes field of a StatusResponse. started and completed are left out if zero.
+func traceVertex(digest, name string, started, completed time.Time, err string) []byte {
+	var v []byte
+	v = protoBytes(v, 1, []byte(digest))
+	v = protoBytes(v, 3, []byte(name))
+	if !started.IsZero() {
+		v = protoBytes(v, 5, timestamp(started))
+	}
+	if !completed.IsZero() {
+		v = protoBytes(v, 6, timestamp(completed))
+	}
+	if err != "" {
+		v = protoBytes(v, 7, []byte(err))
+	}
+	return protoBytes(nil, 1, v)
+}
+
+// traceLog returns the logs field of a StatusResponse holding stdout of the vertex.
+func traceLog(digest string, data []byte) []byte {
+	var l []byte
+	l = protoBytes(l, 1, []byte(digest))
+	l = protoBytes(l, 2, timestamp(now()))
+	l = protoVarint(l, 3, 1)
+	l = protoBytes(l, 4, data)
+	return protoBytes(nil, 3, l)
+}
+
+// timestamp encodes t as a google.protobuf.Timestamp.
+func timestamp(t time.Time) []byte {
+	return protoVarint(protoVarint(nil, 1, uint64(t.Unix())), 2, uint64(t.Nanosecond()))
+}
+
+func protoBytes(b []byte, num int, v []byte) []byte {
+	b = uvarint(b, uint64(num)<<3|2)
+	b = uvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func protoVarint(b []byte, num int, v uint64) []byte {
+	return uvarint(uvarint(b, uint64(num)<<3), v)
+}
+
+func uvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+// field returns the length-delimited field num of the protocol buffers message b, which must not hold fields of
+// other types.
+func field(b []byte, num int) []byte {
+	var v []byte
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return v
+		}
+		l, m := binary.Uvarint(b[n:])
+		if m <= 0 || l > uint64(len(b)-n-m) {
+			return v
+		}
+		if int(key>>3) == num {
+			v = b[n+m : n+m+int(l)]
+		}
+		b = b[n+m+int(l):]
+	}
+	return v
+}
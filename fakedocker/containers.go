@@ -0,0 +1,747 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package fakedocker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	dc "github.com/ory/dockertest/v3/docker"
+	"github.com/ory/dockertest/v3/docker/pkg/stdcopy"
+)
+
+// container is a container and the state the server keeps alongside it.
+type container struct {
+	dc.Container
+
+	behavior Behavior
+	logs     []logEntry
+	// exited is closed and replaced whenever the container stops.
+	exited chan struct{}
+	// logged is closed and replaced whenever the container writes to its logs.
+	logged chan struct{}
+	files  map[string]*File
+	stats  []dc.Stats
+	// measured is closed and replaced whenever statistics are added to stats.
+	measured chan struct{}
+}
+
+type logEntry struct {
+	stream stdcopy.StdType
+	data   string
+	time   time.Time
+}
+
+// Container returns a copy of the container with the given ID or name, as it would be returned by an inspect call.
+func (s *Server) Container(idOrName string) (*dc.Container, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.findContainer(idOrName)
+	if !ok {
+		return nil, false
+	}
+	return c.inspect(), true
+}
+
+// Exit stops the running container with the given ID or name as if its main process exited with code.
+func (s *Server) Exit(idOrName string, code int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.findContainer(idOrName)
+	if !ok {
+		return fmt.Errorf("no such container: %s", idOrName)
+	}
+	if !c.State.Running {
+		return fmt.Errorf("container %s is not running", idOrName)
+	}
+	s.stop(c, code)
+	return nil
+}
+
+// Print writes stdout and stderr to the logs of the running container with the given ID or name, as if its main
+// process printed them. Clients following the logs receive them right away.
+func (s *Server) Print(idOrName, stdout, stderr string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.findContainer(idOrName)
+	if !ok {
+		return fmt.Errorf("no such container: %s", idOrName)
+	}
+	if !c.State.Running {
+		return fmt.Errorf("container %s is not running", idOrName)
+	}
+	c.print(stdout, stderr)
+	return nil
+}
+
+// print appends stdout and stderr to the logs of c, and wakes up the clients following them. The caller must hold
+// s.mu.
+func (c *container) print(stdout, stderr string) {
+	if stdout != "" {
+		c.logs = append(c.logs, logEntry{stream: stdcopy.Stdout, data: stdout, time: now()})
+	}
+	if stderr != "" {
+		c.logs = append(c.logs, logEntry{stream: stdcopy.Stderr, data: stderr, time: now()})
+	}
+	close(c.logged)
+	c.logged = make(chan struct{})
+}
+
+// AddStats adds resource usage statistics to the running container with the given ID or name. Clients streaming its
+// statistics receive them right away, and a single request returns the latest ones. Read defaults to the current
+// time, and PreRead and PreCPUStats to the previous statistics.
+func (s *Server) AddStats(idOrName string, stats ...dc.Stats) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.findContainer(idOrName)
+	if !ok {
+		return fmt.Errorf("no such container: %s", idOrName)
+	}
+	if !c.State.Running {
+		return fmt.Errorf("container %s is not running", idOrName)
+	}
+	for _, st := range stats {
+		if st.Read.IsZero() {
+			st.Read = now()
+		}
+		if n := len(c.stats); n > 0 {
+			if st.PreRead.IsZero() {
+				st.PreRead = c.stats[n-1].Read
+			}
+			if st.PreCPUStats.SystemCPUUsage == 0 {
+				st.PreCPUStats = c.stats[n-1].CPUStats
+			}
+		}
+		c.stats = append(c.stats, st)
+	}
+	close(c.measured)
+	c.measured = make(chan struct{})
+	return nil
+}
+
+// SetHealth changes the health status of the running container with the given ID or name, as if its healthcheck
+// had run with the given results, which are appended to its health log.
+func (s *Server) SetHealth(idOrName, status string, probes ...dc.HealthCheck) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.findContainer(idOrName)
+	if !ok {
+		return fmt.Errorf("no such container: %s", idOrName)
+	}
+	if !c.State.Running {
+		return fmt.Errorf("container %s is not running", idOrName)
+	}
+
+	c.State.Health.Log = append(c.State.Health.Log, probes...)
+	if status == "unhealthy" {
+		c.State.Health.FailingStreak += len(probes)
+	} else {
+		c.State.Health.FailingStreak = 0
+	}
+	if c.State.Health.Status != status {
+		c.State.Health.Status = status
+		s.emit("container", "health_status: "+status, c.ID, containerAttributes(c, nil))
+	}
+	return nil
+}
+
+// findContainer looks up a container by ID, unique ID prefix or name. The caller must hold s.mu.
+func (s *Server) findContainer(idOrName string) (*container, bool) {
+	if c, ok := s.containers[idOrName]; ok {
+		return c, true
+	}
+
+	name := "/" + strings.TrimPrefix(idOrName, "/")
+	var found *container
+	for _, c := range s.containers {
+		if c.Name == name {
+			return c, true
+		}
+		if idOrName != "" && strings.HasPrefix(c.ID, idOrName) {
+			if found != nil {
+				return nil, false
+			}
+			found = c
+		}
+	}
+	return found, found != nil
+}
+
+// inspect returns a deep enough copy of c to be handed out without holding s.mu.
+func (c *container) inspect() *dc.Container {
+	b, _ := json.Marshal(c.Container)
+	var out dc.Container
+	_ = json.Unmarshal(b, &out)
+	return &out
+}
+
+func (s *Server) routeContainers(w http.ResponseWriter, r *http.Request, parts []string) {
+	switch {
+	case len(parts) == 1 && parts[0] == "json" && r.Method == http.MethodGet:
+		s.listContainers(w, r)
+	case len(parts) == 1 && parts[0] == "create" && r.Method == http.MethodPost:
+		s.createContainer(w, r)
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		s.removeContainer(w, r, parts[0])
+	case len(parts) == 2 && parts[1] == "json" && r.Method == http.MethodGet:
+		s.inspectContainer(w, r, parts[0])
+	case len(parts) == 2 && parts[1] == "start" && r.Method == http.MethodPost:
+		s.startContainer(w, r, parts[0])
+	case len(parts) == 2 && (parts[1] == "stop" || parts[1] == "kill") && r.Method == http.MethodPost:
+		s.stopContainer(w, r, parts[0], parts[1])
+	case len(parts) == 2 && parts[1] == "wait" && r.Method == http.MethodPost:
+		s.waitContainer(w, r, parts[0])
+	case len(parts) == 2 && parts[1] == "logs" && r.Method == http.MethodGet:
+		s.containerLogs(w, r, parts[0])
+	case len(parts) == 2 && parts[1] == "archive":
+		s.containerArchive(w, r, parts[0])
+	case len(parts) == 2 && parts[1] == "stats" && r.Method == http.MethodGet:
+		s.containerStats(w, r, parts[0])
+	case len(parts) == 2 && parts[1] == "exec" && r.Method == http.MethodPost:
+		s.createExec(w, r, parts[0])
+	default:
+		writeError(w, http.StatusNotFound, "page not found")
+	}
+}
+
+func (s *Server) listContainers(w http.ResponseWriter, r *http.Request) {
+	filters, err := parseFilters(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	all := r.URL.Query().Get("all")
+	showAll := all == "1" || all == "true"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := []dc.APIContainers{}
+	for _, c := range s.containers {
+		if !showAll && !c.State.Running && len(filters["status"]) == 0 {
+			continue
+		}
+		if !matchLabels(c.Config.Labels, filters["label"]) ||
+			!matchAny(filters["id"], func(f string) bool { return strings.HasPrefix(c.ID, f) }) ||
+			!matchAny(filters["status"], func(f string) bool { return f == c.State.Status }) ||
+			!matchAny(filters["ancestor"], func(f string) bool { return normalizeImage(f) == c.Config.Image }) ||
+			!matchAny(filters["name"], func(f string) bool {
+				re, err := regexp.Compile(f)
+				return err == nil && re.MatchString(c.Name)
+			}) ||
+			!matchAny(filters["network"], func(f string) bool {
+				for name, n := range c.NetworkSettings.Networks {
+					if name == f || n.NetworkID == f {
+						return true
+					}
+				}
+				return false
+			}) {
+			continue
+		}
+
+		networks := map[string]dc.ContainerNetwork{}
+		for name, n := range c.NetworkSettings.Networks {
+			networks[name] = n
+		}
+		list = append(list, dc.APIContainers{
+			ID:       c.ID,
+			Image:    c.Config.Image,
+			Command:  strings.Join(append(append([]string{}, c.Config.Entrypoint...), c.Config.Cmd...), " "),
+			Created:  c.Created.Unix(),
+			State:    c.State.Status,
+			Status:   c.State.String(),
+			Ports:    c.NetworkSettings.PortMappingAPI(),
+			Names:    []string{c.Name},
+			Labels:   c.Config.Labels,
+			Networks: dc.NetworkList{Networks: networks},
+		})
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) createContainer(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		*dc.Config
+		HostConfig       *dc.HostConfig
+		NetworkingConfig *dc.NetworkingConfig
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if body.Config == nil {
+		body.Config = &dc.Config{}
+	}
+	if body.HostConfig == nil {
+		body.HostConfig = &dc.HostConfig{}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	image := normalizeImage(body.Config.Image)
+	img, ok := s.images[image]
+	if !ok {
+		writeError(w, http.StatusNotFound, "No such image: "+body.Config.Image)
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		s.nextName++
+		name = fmt.Sprintf("fake_container_%d", s.nextName)
+	}
+	name = "/" + strings.TrimPrefix(name, "/")
+	for _, other := range s.containers {
+		if other.Name == name {
+			writeError(w, http.StatusConflict, fmt.Sprintf("Conflict. The container name %q is already in use by container %q.", name, other.ID))
+			return
+		}
+	}
+
+	config := *body.Config
+	config.Image = image
+	if config.Labels == nil {
+		config.Labels = map[string]string{}
+	}
+
+	c := &container{
+		Container: dc.Container{
+			ID:              newID(),
+			Created:         now(),
+			Config:          &config,
+			State:           dc.State{Status: "created"},
+			Image:           img.ID,
+			Name:            name,
+			Driver:          "overlay2",
+			HostConfig:      body.HostConfig,
+			NetworkSettings: &dc.NetworkSettings{Networks: map[string]dc.ContainerNetwork{}},
+		},
+		behavior: s.behavior(image),
+		exited:   make(chan struct{}),
+		logged:   make(chan struct{}),
+		measured: make(chan struct{}),
+		files:    newFilesystem(),
+	}
+	if len(config.Entrypoint) > 0 {
+		c.Path, c.Args = config.Entrypoint[0], append(append([]string{}, config.Entrypoint[1:]...), config.Cmd...)
+	} else if len(config.Cmd) > 0 {
+		c.Path, c.Args = config.Cmd[0], config.Cmd[1:]
+	}
+
+	var endpoints map[string]*dc.EndpointConfig
+	if body.NetworkingConfig != nil {
+		endpoints = body.NetworkingConfig.EndpointsConfig
+	}
+	if len(endpoints) == 0 {
+		mode := body.HostConfig.NetworkMode
+		if mode == "" || mode == "default" {
+			mode = "bridge"
+		}
+		if mode != "host" && mode != "none" && !strings.HasPrefix(mode, "container:") {
+			endpoints = map[string]*dc.EndpointConfig{mode: nil}
+		}
+	}
+	for idOrName, endpoint := range endpoints {
+		n, ok := s.findNetwork(idOrName)
+		if !ok {
+			writeError(w, http.StatusNotFound, "network "+idOrName+" not found")
+			return
+		}
+		s.connect(c, n, endpoint)
+	}
+
+	s.containers[c.ID] = c
+	s.emit("container", "create", c.ID, containerAttributes(c, nil))
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"Id": c.ID, "Warnings": []string{}})
+}
+
+func (s *Server) inspectContainer(w http.ResponseWriter, _ *http.Request, idOrName string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.findContainer(idOrName)
+	if !ok {
+		writeError(w, http.StatusNotFound, "No such container: "+idOrName)
+		return
+	}
+	writeJSON(w, http.StatusOK, c.Container)
+}
+
+func (s *Server) startContainer(w http.ResponseWriter, _ *http.Request, idOrName string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.findContainer(idOrName)
+	if !ok {
+		writeError(w, http.StatusNotFound, "No such container: "+idOrName)
+		return
+	}
+	if c.State.Running {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	ports, err := s.publishPorts(c)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.NetworkSettings.Ports = ports
+	c.State = dc.State{
+		Status:    "running",
+		Running:   true,
+		Pid:       1000 + len(s.containers),
+		StartedAt: now(),
+	}
+	if c.behavior.Health != "" {
+		c.State.Health.Status = c.behavior.Health
+	} else if hc := c.Config.Healthcheck; hc != nil && len(hc.Test) > 0 && hc.Test[0] != "NONE" {
+		c.State.Health.Status = "healthy"
+	}
+	c.print(c.behavior.Stdout, c.behavior.Stderr)
+	s.emit("container", "start", c.ID, containerAttributes(c, nil))
+	if c.State.Health.Status != "" {
+		s.emit("container", "health_status: "+c.State.Health.Status, c.ID, containerAttributes(c, nil))
+	}
+
+	if c.behavior.Exit {
+		s.stop(c, c.behavior.ExitCode)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// publishPorts binds the exposed ports of c to host ports, as requested by its port bindings or, with
+// PublishAllPorts, to free ports. Like the daemon, it fails if a requested host port is bound by another running
+// container. The caller must hold s.mu.
+func (s *Server) publishPorts(c *container) (map[dc.Port][]dc.PortBinding, error) {
+	ports := map[dc.Port][]dc.PortBinding{}
+	for p := range c.Config.ExposedPorts {
+		ports[p] = nil
+	}
+	for p := range c.HostConfig.PortBindings {
+		ports[p] = nil
+	}
+
+	for p := range ports {
+		bindings := c.HostConfig.PortBindings[p]
+		if len(bindings) == 0 && !c.HostConfig.PublishAllPorts {
+			continue
+		}
+		if len(bindings) == 0 {
+			bindings = []dc.PortBinding{{}}
+		}
+		for _, b := range bindings {
+			if b.HostIP == "" && !s.podman {
+				b.HostIP = "0.0.0.0"
+			}
+			if b.HostPort == "" {
+				b.HostPort = strconv.Itoa(s.nextPort)
+				s.nextPort++
+			} else if s.portInUse(b.HostPort) {
+				return nil, fmt.Errorf("driver failed programming external connectivity on endpoint %s (%s): Bind for %s:%s failed: port is already allocated",
+					strings.TrimPrefix(c.Name, "/"), c.ID, b.HostIP, b.HostPort)
+			}
+			ports[p] = append(ports[p], b)
+		}
+	}
+	return ports, nil
+}
+
+// portInUse reports whether a running container has published hostPort. The caller must hold s.mu.
+func (s *Server) portInUse(hostPort string) bool {
+	for _, c := range s.containers {
+		if !c.State.Running {
+			continue
+		}
+		for _, bindings := range c.NetworkSettings.Ports {
+			for _, b := range bindings {
+				if b.HostPort == hostPort {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// stop marks c as exited with code, and removes it if it was started with AutoRemove. The caller must hold s.mu.
+func (s *Server) stop(c *container, code int) {
+	c.State.Running = false
+	c.State.Status = "exited"
+	c.State.ExitCode = code
+	c.State.Pid = 0
+	c.State.FinishedAt = now()
+
+	s.emit("container", "die", c.ID, containerAttributes(c, map[string]string{"exitCode": strconv.Itoa(code)}))
+	close(c.exited)
+	c.exited = make(chan struct{})
+
+	if c.HostConfig.AutoRemove {
+		s.remove(c)
+	}
+}
+
+// remove deletes c along with its execs and network endpoints. The caller must hold s.mu.
+func (s *Server) remove(c *container) {
+	for _, n := range s.networks {
+		if _, ok := n.Containers[c.ID]; ok {
+			delete(n.Containers, c.ID)
+			s.emit("network", "disconnect", n.ID, map[string]string{"name": n.Name, "type": n.Driver, "container": c.ID})
+		}
+	}
+	for id, e := range s.execs {
+		if e.ContainerID == c.ID {
+			delete(s.execs, id)
+		}
+	}
+	delete(s.containers, c.ID)
+	s.emit("container", "destroy", c.ID, containerAttributes(c, nil))
+}
+
+func (s *Server) stopContainer(w http.ResponseWriter, _ *http.Request, idOrName, action string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.findContainer(idOrName)
+	if !ok {
+		writeError(w, http.StatusNotFound, "No such container: "+idOrName)
+		return
+	}
+	if !c.State.Running {
+		if action == "kill" {
+			writeError(w, http.StatusConflict, "Container "+idOrName+" is not running")
+			return
+		}
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if action == "kill" {
+		s.emit("container", "kill", c.ID, containerAttributes(c, map[string]string{"signal": "9"}))
+		s.stop(c, 137)
+	} else {
+		s.emit("container", "kill", c.ID, containerAttributes(c, map[string]string{"signal": "15"}))
+		s.stop(c, 143)
+		s.emit("container", "stop", c.ID, containerAttributes(c, nil))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) waitContainer(w http.ResponseWriter, r *http.Request, idOrName string) {
+	s.mu.Lock()
+	c, ok := s.findContainer(idOrName)
+	if !ok {
+		s.mu.Unlock()
+		writeError(w, http.StatusNotFound, "No such container: "+idOrName)
+		return
+	}
+	running, exited := c.State.Running, c.exited
+	s.mu.Unlock()
+
+	if running {
+		select {
+		case <-exited:
+		case <-r.Context().Done():
+			return
+		case <-s.closed:
+			writeError(w, http.StatusServiceUnavailable, "server is shutting down")
+			return
+		}
+	}
+
+	s.mu.Lock()
+	code := c.State.ExitCode
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]interface{}{"StatusCode": code})
+}
+
+func (s *Server) removeContainer(w http.ResponseWriter, r *http.Request, idOrName string) {
+	force := r.URL.Query().Get("force")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.findContainer(idOrName)
+	if !ok {
+		writeError(w, http.StatusNotFound, "No such container: "+idOrName)
+		return
+	}
+	if c.State.Running {
+		if force != "1" && force != "true" {
+			writeError(w, http.StatusConflict, "You cannot remove a running container "+c.ID+". Stop the container before attempting removal or force remove")
+			return
+		}
+		s.emit("container", "kill", c.ID, containerAttributes(c, map[string]string{"signal": "9"}))
+		autoRemove := c.HostConfig.AutoRemove
+		c.HostConfig.AutoRemove = false
+		s.stop(c, 137)
+		c.HostConfig.AutoRemove = autoRemove
+	}
+	s.remove(c)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) containerLogs(w http.ResponseWriter, r *http.Request, idOrName string) {
+	q := r.URL.Query()
+	stdout, stderr := q.Get("stdout") == "1", q.Get("stderr") == "1"
+	follow := q.Get("follow") == "1"
+	timestamps := q.Get("timestamps") == "1"
+
+	s.mu.Lock()
+	c, ok := s.findContainer(idOrName)
+	if !ok {
+		s.mu.Unlock()
+		writeError(w, http.StatusNotFound, "No such container: "+idOrName)
+		return
+	}
+	logs := append([]logEntry{}, c.logs...)
+	seen := len(c.logs)
+	tty := c.Config.Tty
+	running, exited, logged := c.State.Running, c.exited, c.logged
+	s.mu.Unlock()
+
+	if tail := q.Get("tail"); tail != "" && tail != "all" {
+		if n, err := strconv.Atoi(tail); err == nil {
+			logs = tailLines(logs, n)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.docker.raw-stream")
+	w.WriteHeader(http.StatusOK)
+	out, errOut := io.Writer(w), io.Writer(w)
+	if !tty {
+		out, errOut = stdcopy.NewStdWriter(w, stdcopy.Stdout), stdcopy.NewStdWriter(w, stdcopy.Stderr)
+	}
+	write := func(logs []logEntry) {
+		if timestamps {
+			logs = splitLines(logs)
+		}
+		for _, l := range logs {
+			data := l.data
+			if timestamps {
+				data = l.time.Format(time.RFC3339Nano) + " " + data
+			}
+			switch {
+			case l.stream == stdcopy.Stdout && stdout:
+				_, _ = io.WriteString(out, data)
+			case l.stream == stdcopy.Stderr && stderr:
+				_, _ = io.WriteString(errOut, data)
+			}
+		}
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+	write(logs)
+
+	if !follow || !running {
+		return
+	}
+	for done := false; !done; {
+		select {
+		case <-logged:
+		case <-exited:
+			// the logs written right before the container stopped are still sent
+			done = true
+		case <-r.Context().Done():
+			return
+		case <-s.closed:
+			return
+		}
+
+		s.mu.Lock()
+		logs = append([]logEntry{}, c.logs[seen:]...)
+		seen, logged = len(c.logs), c.logged
+		s.mu.Unlock()
+		write(logs)
+	}
+}
+
+func (s *Server) containerStats(w http.ResponseWriter, r *http.Request, idOrName string) {
+	stream := r.URL.Query().Get("stream") != "0" && r.URL.Query().Get("stream") != "false"
+
+	s.mu.Lock()
+	c, ok := s.findContainer(idOrName)
+	if !ok {
+		s.mu.Unlock()
+		writeError(w, http.StatusNotFound, "No such container: "+idOrName)
+		return
+	}
+	stats := append([]dc.Stats{}, c.stats...)
+	seen := len(c.stats)
+	exited, measured := c.exited, c.measured
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(w)
+	if !stream {
+		latest := dc.Stats{Read: now()}
+		if len(stats) > 0 {
+			latest = stats[len(stats)-1]
+		}
+		_ = enc.Encode(latest)
+		return
+	}
+
+	for {
+		for _, st := range stats {
+			_ = enc.Encode(st)
+		}
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+
+		select {
+		case <-measured:
+		case <-exited:
+			return
+		case <-r.Context().Done():
+			return
+		case <-s.closed:
+			return
+		}
+
+		s.mu.Lock()
+		stats = append([]dc.Stats{}, c.stats[seen:]...)
+		seen, measured = len(c.stats), c.measured
+		s.mu.Unlock()
+	}
+}
+
+// splitLines returns the entries of logs split into single lines.
+func splitLines(logs []logEntry) []logEntry {
+	var lines []logEntry
+	for _, l := range logs {
+		for _, line := range strings.SplitAfter(l.data, "\n") {
+			if line != "" {
+				lines = append(lines, logEntry{stream: l.stream, data: line, time: l.time})
+			}
+		}
+	}
+	return lines
+}
+
+// tailLines returns the entries holding the last n lines of logs.
+func tailLines(logs []logEntry, n int) []logEntry {
+	lines := splitLines(logs)
+	if n < len(lines) {
+		lines = lines[len(lines)-n:]
+	}
+	return lines
+}
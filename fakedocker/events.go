@@ -0,0 +1,173 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package fakedocker
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	dc "github.com/ory/dockertest/v3/docker"
+)
+
+// emit records an event and sends it to all listeners. The caller must hold s.mu.
+func (s *Server) emit(typ, action, id string, attributes map[string]string) {
+	t := now()
+	e := dc.APIEvents{
+		Action:   action,
+		Type:     typ,
+		Actor:    dc.APIActor{ID: id, Attributes: attributes},
+		Time:     t.Unix(),
+		TimeNano: t.UnixNano(),
+	}
+	if typ == "container" || typ == "image" {
+		e.Status = action
+		e.ID = id
+		e.From = attributes["image"]
+	} else {
+		e.Status = typ + ":" + action
+	}
+
+	s.events = append(s.events, e)
+	for l := range s.listeners {
+		select {
+		case l <- e:
+		default:
+			// a listener that does not keep up misses events, like with a real daemon
+		}
+	}
+}
+
+// containerAttributes returns the event attributes of c: its labels, name and image. The caller must hold s.mu.
+func containerAttributes(c *container, extra map[string]string) map[string]string {
+	attributes := map[string]string{
+		"name":  strings.TrimPrefix(c.Name, "/"),
+		"image": c.Config.Image,
+	}
+	for k, v := range c.Config.Labels {
+		attributes[k] = v
+	}
+	for k, v := range extra {
+		attributes[k] = v
+	}
+	return attributes
+}
+
+func matchEvent(e dc.APIEvents, filters map[string][]string) bool {
+	return matchAny(filters["type"], func(f string) bool { return f == e.Type }) &&
+		matchAny(filters["event"], func(f string) bool { return f == e.Action || strings.HasPrefix(e.Action, f+":") }) &&
+		matchAny(filters["container"], func(f string) bool {
+			return e.Type == "container" && (strings.HasPrefix(e.Actor.ID, f) || e.Actor.Attributes["name"] == f)
+		}) &&
+		matchAny(filters["image"], func(f string) bool { return e.Actor.Attributes["image"] == f }) &&
+		matchAny(filters["network"], func(f string) bool {
+			return e.Type == "network" && (e.Actor.ID == f || e.Actor.Attributes["name"] == f)
+		}) &&
+		matchAny(filters["volume"], func(f string) bool { return e.Type == "volume" && e.Actor.ID == f }) &&
+		matchLabels(e.Actor.Attributes, filters["label"])
+}
+
+// handleEvents streams events as JSON objects. Past events are sent if since is set, and the stream ends at until,
+// if set, or when the client disconnects.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	filters, err := parseFilters(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	since, err := parseEventTime(r.URL.Query().Get("since"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	until, err := parseEventTime(r.URL.Query().Get("until"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	l := make(chan dc.APIEvents, 256)
+	s.mu.Lock()
+	var past []dc.APIEvents
+	if !since.IsZero() {
+		for _, e := range s.events {
+			if e.TimeNano >= since.UnixNano() && (until.IsZero() || e.TimeNano <= until.UnixNano()) {
+				past = append(past, e)
+			}
+		}
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, l)
+		s.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	send := func(e dc.APIEvents) bool {
+		if !matchEvent(e, filters) {
+			return true
+		}
+		if err := enc.Encode(e); err != nil {
+			return false
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return true
+	}
+
+	for _, e := range past {
+		if !send(e) {
+			return
+		}
+	}
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	var deadline <-chan time.Time
+	if !until.IsZero() {
+		timer := time.NewTimer(time.Until(until))
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	for {
+		select {
+		case e := <-l:
+			if !until.IsZero() && e.TimeNano > until.UnixNano() {
+				return
+			}
+			if !send(e) {
+				return
+			}
+		case <-deadline:
+			return
+		case <-r.Context().Done():
+			return
+		case <-s.closed:
+			return
+		}
+	}
+}
+
+// parseEventTime parses the since and until parameters, which are Unix timestamps with optional fractional seconds.
+func parseEventTime(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	seconds, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, int64(seconds*float64(time.Second))), nil
+}
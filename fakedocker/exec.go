@@ -0,0 +1,171 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package fakedocker
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	dc "github.com/ory/dockertest/v3/docker"
+	"github.com/ory/dockertest/v3/docker/pkg/stdcopy"
+)
+
+type execInstance struct {
+	dc.ExecInspect
+
+	cmd []string
+}
+
+func (s *Server) routeExec(w http.ResponseWriter, r *http.Request, parts []string) {
+	switch {
+	case len(parts) == 2 && parts[1] == "start" && r.Method == http.MethodPost:
+		s.startExec(w, r, parts[0])
+	case len(parts) == 2 && parts[1] == "json" && r.Method == http.MethodGet:
+		s.inspectExec(w, r, parts[0])
+	case len(parts) == 2 && parts[1] == "resize" && r.Method == http.MethodPost:
+		w.WriteHeader(http.StatusOK)
+	default:
+		writeError(w, http.StatusNotFound, "page not found")
+	}
+}
+
+func (s *Server) createExec(w http.ResponseWriter, r *http.Request, idOrName string) {
+	var opts dc.CreateExecOptions
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.findContainer(idOrName)
+	if !ok {
+		writeError(w, http.StatusNotFound, "No such container: "+idOrName)
+		return
+	}
+	if !c.State.Running {
+		writeError(w, http.StatusConflict, "Container "+c.ID+" is not running")
+		return
+	}
+	if len(opts.Cmd) == 0 {
+		writeError(w, http.StatusBadRequest, "No exec command specified")
+		return
+	}
+
+	e := &execInstance{
+		ExecInspect: dc.ExecInspect{
+			ID:          newID(),
+			OpenStdin:   opts.AttachStdin,
+			OpenStdout:  opts.AttachStdout,
+			OpenStderr:  opts.AttachStderr,
+			ContainerID: c.ID,
+			ProcessConfig: dc.ExecProcessConfig{
+				User:       opts.User,
+				Privileged: opts.Privileged,
+				Tty:        opts.Tty,
+				EntryPoint: opts.Cmd[0],
+				Arguments:  opts.Cmd[1:],
+			},
+		},
+		cmd: opts.Cmd,
+	}
+	s.execs[e.ID] = e
+	c.ExecIDs = append(c.ExecIDs, e.ID)
+	s.emit("container", "exec_create: "+strings.Join(opts.Cmd, " "), c.ID, containerAttributes(c, map[string]string{"execID": e.ID}))
+
+	writeJSON(w, http.StatusCreated, map[string]string{"Id": e.ID})
+}
+
+// startExec runs the command right away. Unless detached, its output is sent over the hijacked connection the same
+// way the daemon does it.
+func (s *Server) startExec(w http.ResponseWriter, r *http.Request, id string) {
+	var opts struct {
+		Detach bool
+		Tty    bool
+	}
+	_ = json.NewDecoder(r.Body).Decode(&opts)
+
+	s.mu.Lock()
+	e, ok := s.execs[id]
+	if !ok {
+		s.mu.Unlock()
+		writeError(w, http.StatusNotFound, "No such exec instance: "+id)
+		return
+	}
+	c, ok := s.containers[e.ContainerID]
+	if !ok || !c.State.Running {
+		s.mu.Unlock()
+		writeError(w, http.StatusConflict, "Container "+e.ContainerID+" is not running")
+		return
+	}
+
+	handler := c.behavior.Exec
+	s.mu.Unlock()
+
+	// the handler may call back into the server
+	var result ExecResult
+	if handler != nil {
+		result = handler(e.cmd)
+	}
+
+	s.mu.Lock()
+	e.ExitCode = result.ExitCode
+	e.Running = false
+	s.emit("container", "exec_start: "+strings.Join(e.cmd, " "), c.ID,
+		containerAttributes(c, map[string]string{"execID": e.ID}))
+	s.emit("container", "exec_die", c.ID,
+		containerAttributes(c, map[string]string{"execID": e.ID, "exitCode": strconv.Itoa(result.ExitCode)}))
+	tty := e.ProcessConfig.Tty || opts.Tty
+	s.mu.Unlock()
+
+	if opts.Detach {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "connection cannot be hijacked")
+		return
+	}
+	conn, buf, err := hj.Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	contentType := "application/vnd.docker.multiplexed-stream"
+	if tty {
+		contentType = "application/vnd.docker.raw-stream"
+	}
+	_, _ = io.WriteString(buf, "HTTP/1.1 101 UPGRADED\r\nContent-Type: "+contentType+"\r\nConnection: Upgrade\r\nUpgrade: tcp\r\n\r\n")
+
+	out, errOut := io.Writer(buf), io.Writer(buf)
+	if !tty {
+		out, errOut = stdcopy.NewStdWriter(buf, stdcopy.Stdout), stdcopy.NewStdWriter(buf, stdcopy.Stderr)
+	}
+	if e.OpenStdout && result.Stdout != "" {
+		_, _ = io.WriteString(out, result.Stdout)
+	}
+	if e.OpenStderr && result.Stderr != "" {
+		_, _ = io.WriteString(errOut, result.Stderr)
+	}
+	_ = buf.Flush()
+}
+
+func (s *Server) inspectExec(w http.ResponseWriter, _ *http.Request, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.execs[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "No such exec instance: "+id)
+		return
+	}
+	writeJSON(w, http.StatusOK, e.ExecInspect)
+}
@@ -0,0 +1,182 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package fakedocker
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	dc "github.com/ory/dockertest/v3/docker"
+	"github.com/ory/dockertest/v3/docker/pkg/jsonmessage"
+)
+
+// addImage stores image unless it exists already. The caller must hold s.mu.
+func (s *Server) addImage(image string) *dc.Image {
+	image = normalizeImage(image)
+	if img, ok := s.images[image]; ok {
+		return img
+	}
+
+	img := &dc.Image{
+		ID:           "sha256:" + newID(),
+		RepoTags:     []string{image},
+		Created:      now(),
+		Config:       &dc.Config{},
+		Architecture: "amd64",
+		OS:           "linux",
+	}
+	s.images[image] = img
+	return img
+}
+
+// findImage looks up an image by reference or ID. The caller must hold s.mu.
+func (s *Server) findImage(name string) (*dc.Image, bool) {
+	if img, ok := s.images[normalizeImage(name)]; ok {
+		return img, true
+	}
+	for _, img := range s.images {
+		if img.ID == name || strings.TrimPrefix(img.ID, "sha256:") == name {
+			return img, true
+		}
+	}
+	return nil, false
+}
+
+// routeImages handles the image endpoints. Image names may contain slashes, so rest is the path after /images
+// rather than its segments.
+func (s *Server) routeImages(w http.ResponseWriter, r *http.Request, rest string) {
+	switch {
+	case rest == "/json" && r.Method == http.MethodGet:
+		s.listImages(w, r)
+	case rest == "/create" && r.Method == http.MethodPost:
+		s.pullImage(w, r)
+	case strings.HasSuffix(rest, "/json") && r.Method == http.MethodGet:
+		s.inspectImage(w, r, strings.TrimSuffix(strings.TrimPrefix(rest, "/"), "/json"))
+	case r.Method == http.MethodDelete:
+		s.removeImage(w, r, strings.TrimPrefix(rest, "/"))
+	default:
+		writeError(w, http.StatusNotFound, "page not found")
+	}
+}
+
+func (s *Server) listImages(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := []dc.APIImages{}
+	for _, img := range s.images {
+		list = append(list, dc.APIImages{
+			ID:       img.ID,
+			RepoTags: img.RepoTags,
+			Created:  img.Created.Unix(),
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].RepoTags[0] < list[j].RepoTags[0] })
+	writeJSON(w, http.StatusOK, list)
+}
+
+// RequireAuth makes pulls of repository fail unless they carry the username and password, or the identity token,
+// of auth.
+func (s *Server) RequireAuth(repository string, auth dc.AuthConfiguration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.auths[repository] = auth
+}
+
+// pullImage pulls any image that is asked for, as if the registry had every image.
+func (s *Server) pullImage(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	image := q.Get("fromImage")
+	if image == "" {
+		writeError(w, http.StatusBadRequest, "fromImage is required")
+		return
+	}
+	if tag := q.Get("tag"); tag != "" {
+		image += ":" + tag
+	}
+
+	s.mu.Lock()
+	repository, _ := splitImage(image)
+	if want, ok := s.auths[repository]; ok && !authorized(r, want) {
+		s.mu.Unlock()
+		writeError(w, http.StatusNotFound, "pull access denied for "+repository+
+			", repository does not exist or may require 'docker login': denied: requested access to the resource is denied")
+		return
+	}
+	img := s.addImage(image)
+	s.emit("image", "pull", normalizeImage(image), map[string]string{"name": normalizeImage(image)})
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(w)
+	layer := strings.TrimPrefix(img.ID, "sha256:")[:12]
+	_ = enc.Encode(jsonmessage.JSONMessage{Status: "Pulling from " + image})
+	_ = enc.Encode(jsonmessage.JSONMessage{ID: layer, Status: "Pulling fs layer"})
+	for _, current := range []int64{512, 1024} {
+		_ = enc.Encode(jsonmessage.JSONMessage{
+			ID:       layer,
+			Status:   "Downloading",
+			Progress: &jsonmessage.JSONProgress{Current: current, Total: 1024},
+		})
+	}
+	_ = enc.Encode(jsonmessage.JSONMessage{ID: layer, Status: "Pull complete"})
+	_ = enc.Encode(jsonmessage.JSONMessage{Status: "Digest: " + img.ID})
+	_ = enc.Encode(jsonmessage.JSONMessage{Status: "Status: Downloaded newer image for " + normalizeImage(image)})
+}
+
+// authorized reports whether the X-Registry-Auth header of r holds the credentials of want.
+func authorized(r *http.Request, want dc.AuthConfiguration) bool {
+	data, err := base64.URLEncoding.DecodeString(r.Header.Get("X-Registry-Auth"))
+	if err != nil {
+		return false
+	}
+	var got dc.AuthConfiguration
+	if err := json.Unmarshal(data, &got); err != nil {
+		return false
+	}
+	if want.IdentityToken != "" {
+		return got.IdentityToken == want.IdentityToken
+	}
+	return got.Username == want.Username && got.Password == want.Password
+}
+
+func (s *Server) inspectImage(w http.ResponseWriter, _ *http.Request, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	img, ok := s.findImage(name)
+	if !ok {
+		writeError(w, http.StatusNotFound, "No such image: "+name)
+		return
+	}
+	writeJSON(w, http.StatusOK, img)
+}
+
+func (s *Server) removeImage(w http.ResponseWriter, _ *http.Request, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	img, ok := s.findImage(name)
+	if !ok {
+		writeError(w, http.StatusNotFound, "No such image: "+name)
+		return
+	}
+	for _, c := range s.containers {
+		if c.Image == img.ID {
+			writeError(w, http.StatusConflict, "conflict: unable to remove image "+name+", it is being used by container "+c.ID)
+			return
+		}
+	}
+	for ref, other := range s.images {
+		if other == img {
+			delete(s.images, ref)
+			s.emit("image", "delete", img.ID, map[string]string{"name": ref})
+		}
+	}
+	writeJSON(w, http.StatusOK, []map[string]string{{"Deleted": img.ID}})
+}
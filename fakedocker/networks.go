@@ -0,0 +1,230 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package fakedocker
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	dc "github.com/ory/dockertest/v3/docker"
+)
+
+// findNetwork looks up a network by ID, unique ID prefix or name. The caller must hold s.mu.
+func (s *Server) findNetwork(idOrName string) (*dc.Network, bool) {
+	if n, ok := s.networks[idOrName]; ok {
+		return n, true
+	}
+
+	var found *dc.Network
+	for _, n := range s.networks {
+		if n.Name == idOrName {
+			return n, true
+		}
+		if idOrName != "" && strings.HasPrefix(n.ID, idOrName) {
+			if found != nil {
+				return nil, false
+			}
+			found = n
+		}
+	}
+	return found, found != nil
+}
+
+// connect attaches c to n and assigns it an address. The caller must hold s.mu.
+func (s *Server) connect(c *container, n *dc.Network, endpoint *dc.EndpointConfig) {
+	ip := fmt.Sprintf("172.17.%d.%d", s.nextIP/254%256, s.nextIP%254+1)
+	s.nextIP++
+
+	settings := dc.ContainerNetwork{
+		NetworkID:   n.ID,
+		EndpointID:  newID(),
+		IPAddress:   ip,
+		IPPrefixLen: 16,
+		MacAddress:  fmt.Sprintf("02:42:ac:11:%02x:%02x", s.nextIP/256%256, s.nextIP%256),
+	}
+	if endpoint != nil {
+		settings.Aliases = endpoint.Aliases
+		if endpoint.IPAMConfig != nil && endpoint.IPAMConfig.IPv4Address != "" {
+			settings.IPAddress = endpoint.IPAMConfig.IPv4Address
+		}
+	}
+
+	c.NetworkSettings.Networks[n.Name] = settings
+	if n.Name == "bridge" {
+		c.NetworkSettings.IPAddress = settings.IPAddress
+		c.NetworkSettings.IPPrefixLen = settings.IPPrefixLen
+		c.NetworkSettings.MacAddress = settings.MacAddress
+	}
+	n.Containers[c.ID] = dc.Endpoint{
+		Name:        strings.TrimPrefix(c.Name, "/"),
+		ID:          settings.EndpointID,
+		MacAddress:  settings.MacAddress,
+		IPv4Address: fmt.Sprintf("%s/%d", settings.IPAddress, settings.IPPrefixLen),
+	}
+	s.emit("network", "connect", n.ID, map[string]string{"name": n.Name, "type": n.Driver, "container": c.ID})
+}
+
+func (s *Server) routeNetworks(w http.ResponseWriter, r *http.Request, parts []string) {
+	switch {
+	case len(parts) == 0 && r.Method == http.MethodGet:
+		s.listNetworks(w, r)
+	case len(parts) == 1 && parts[0] == "create" && r.Method == http.MethodPost:
+		s.createNetwork(w, r)
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		s.inspectNetwork(w, r, parts[0])
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		s.removeNetwork(w, r, parts[0])
+	case len(parts) == 2 && (parts[1] == "connect" || parts[1] == "disconnect") && r.Method == http.MethodPost:
+		s.connectNetwork(w, r, parts[0], parts[1] == "connect")
+	default:
+		writeError(w, http.StatusNotFound, "page not found")
+	}
+}
+
+func (s *Server) listNetworks(w http.ResponseWriter, r *http.Request) {
+	filters, err := parseFilters(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := []dc.Network{}
+	for _, n := range s.networks {
+		if !matchLabels(n.Labels, filters["label"]) ||
+			!matchAny(filters["name"], func(f string) bool { return strings.Contains(n.Name, f) }) ||
+			!matchAny(filters["id"], func(f string) bool { return strings.HasPrefix(n.ID, f) }) ||
+			!matchAny(filters["driver"], func(f string) bool { return n.Driver == f }) {
+			continue
+		}
+		list = append(list, *n)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) createNetwork(w http.ResponseWriter, r *http.Request) {
+	var opts dc.CreateNetworkOptions
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, n := range s.networks {
+		if n.Name == opts.Name {
+			writeError(w, http.StatusConflict, "network with name "+opts.Name+" already exists")
+			return
+		}
+	}
+
+	n := &dc.Network{
+		Name:       opts.Name,
+		ID:         newID(),
+		Scope:      "local",
+		Driver:     opts.Driver,
+		Containers: map[string]dc.Endpoint{},
+		Options:    map[string]string{},
+		Internal:   opts.Internal,
+		EnableIPv6: opts.EnableIPv6,
+		Labels:     opts.Labels,
+	}
+	if n.Driver == "" {
+		n.Driver = "bridge"
+	}
+	if opts.IPAM != nil {
+		n.IPAM = *opts.IPAM
+	}
+	if n.Labels == nil {
+		n.Labels = map[string]string{}
+	}
+	for k, v := range opts.Options {
+		n.Options[k] = fmt.Sprint(v)
+	}
+
+	s.networks[n.ID] = n
+	s.emit("network", "create", n.ID, map[string]string{"name": n.Name, "type": n.Driver})
+	writeJSON(w, http.StatusCreated, map[string]string{"Id": n.ID, "Warning": ""})
+}
+
+func (s *Server) inspectNetwork(w http.ResponseWriter, _ *http.Request, idOrName string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, ok := s.findNetwork(idOrName)
+	if !ok {
+		writeError(w, http.StatusNotFound, "network "+idOrName+" not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, n)
+}
+
+func (s *Server) removeNetwork(w http.ResponseWriter, _ *http.Request, idOrName string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, ok := s.findNetwork(idOrName)
+	if !ok {
+		writeError(w, http.StatusNotFound, "network "+idOrName+" not found")
+		return
+	}
+	if n.Name == "bridge" {
+		writeError(w, http.StatusForbidden, "bridge is a pre-defined network and cannot be removed")
+		return
+	}
+	if len(n.Containers) > 0 {
+		writeError(w, http.StatusForbidden, "error while removing network: network "+n.Name+" id "+n.ID+" has active endpoints")
+		return
+	}
+
+	delete(s.networks, n.ID)
+	s.emit("network", "destroy", n.ID, map[string]string{"name": n.Name, "type": n.Driver})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) connectNetwork(w http.ResponseWriter, r *http.Request, idOrName string, connect bool) {
+	var opts dc.NetworkConnectionOptions
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, ok := s.findNetwork(idOrName)
+	if !ok {
+		writeError(w, http.StatusNotFound, "network "+idOrName+" not found")
+		return
+	}
+	c, ok := s.findContainer(opts.Container)
+	if !ok {
+		writeError(w, http.StatusNotFound, "No such container: "+opts.Container)
+		return
+	}
+
+	_, connected := n.Containers[c.ID]
+	switch {
+	case connect && connected:
+		writeError(w, http.StatusForbidden, "endpoint with name "+strings.TrimPrefix(c.Name, "/")+" already exists in network "+n.Name)
+		return
+	case connect:
+		s.connect(c, n, opts.EndpointConfig)
+	case !connected:
+		writeError(w, http.StatusForbidden, "container "+c.ID+" is not connected to network "+n.Name)
+		return
+	default:
+		delete(n.Containers, c.ID)
+		delete(c.NetworkSettings.Networks, n.Name)
+		s.emit("network", "disconnect", n.ID, map[string]string{"name": n.Name, "type": n.Driver, "container": c.ID})
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,451 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+// Package fakedocker provides an in-memory implementation of the Docker Engine API for unit tests. It implements
+// the endpoints used by dockertest, so that code built on top of a dockertest.Pool can be tested without a Docker
+// daemon:
+//
+//	fake := fakedocker.NewServer()
+//	defer fake.Close()
+//
+//	fake.SetBehavior("postgres:11", fakedocker.Behavior{Stdout: "database system is ready to accept connections\n"})
+//	pool, err := dockertest.NewPool(fake.URL)
+//
+// Containers do not run anything. What they print, when they exit and how commands executed within them behave is
+// scripted with SetBehavior, failures of single endpoints can be injected with Fail, and After runs code at a given
+// point of a test, e.g. right after a container has been created.
+package fakedocker
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	dc "github.com/ory/dockertest/v3/docker"
+)
+
+// APIVersion is the Docker Engine API version reported by the server.
+const APIVersion = "1.41"
+
+// Behavior scripts how the containers of an image behave.
+type Behavior struct {
+	// Stdout and Stderr are written to the container's logs when it starts.
+	Stdout string
+	Stderr string
+
+	// Exit makes the container exit with ExitCode right after it started. Otherwise it keeps running until it is
+	// stopped, killed or removed, or until Server.Exit is called.
+	Exit     bool
+	ExitCode int
+
+	// Health is reported as the health status of the container, e.g. "starting" or "unhealthy". By default
+	// containers with a healthcheck are healthy once they started.
+	Health string
+
+	// Exec handles commands executed within the container. By default they print nothing and exit with code 0.
+	Exec func(cmd []string) ExecResult
+}
+
+// ExecResult is the outcome of a command executed within a container.
+type ExecResult struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+}
+
+// Server is an in-memory Docker Engine API server. Use its URL as the endpoint of a dockertest.Pool or a
+// docker.Client.
+type Server struct {
+	*httptest.Server
+
+	mu         sync.Mutex
+	images     map[string]*dc.Image
+	containers map[string]*container
+	execs      map[string]*execInstance
+	networks   map[string]*dc.Network
+	volumes    map[string]*dc.Volume
+	behaviors  map[string]Behavior
+	auths      map[string]dc.AuthConfiguration
+	builds     []Build
+	sessions   map[string]*buildSession
+	failures   []*failure
+	hooks      []*hook
+	events     []dc.APIEvents
+	listeners  map[chan dc.APIEvents]struct{}
+	nextPort   int
+	nextIP     int
+	nextName   int
+	podman     bool
+	rootless   bool
+
+	// closed ends long running requests such as event streams, which would otherwise block Close.
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+type failure struct {
+	method  string
+	pattern string
+	status  int
+	message string
+}
+
+type hook struct {
+	method  string
+	pattern string
+	f       func(r *http.Request)
+}
+
+// matches reports whether a request with the given method and path, without the API version, matches method and
+// pattern as described by Fail.
+func matches(method, pattern string, r *http.Request, p string) bool {
+	if method != "" && method != r.Method {
+		return false
+	}
+	ok, _ := path.Match(pattern, p)
+	return ok
+}
+
+var versionPrefix = regexp.MustCompile(`^/v[0-9.]+/`)
+
+// NewServer starts a server with a default "bridge" network and no images.
+func NewServer() *Server {
+	s := &Server{
+		images:     map[string]*dc.Image{},
+		containers: map[string]*container{},
+		execs:      map[string]*execInstance{},
+		networks:   map[string]*dc.Network{},
+		volumes:    map[string]*dc.Volume{},
+		behaviors:  map[string]Behavior{},
+		auths:      map[string]dc.AuthConfiguration{},
+		sessions:   map[string]*buildSession{},
+		listeners:  map[chan dc.APIEvents]struct{}{},
+		nextPort:   32768,
+		nextIP:     2,
+		closed:     make(chan struct{}),
+	}
+
+	bridge := &dc.Network{
+		Name:       "bridge",
+		ID:         newID(),
+		Scope:      "local",
+		Driver:     "bridge",
+		Containers: map[string]dc.Endpoint{},
+		Labels:     map[string]string{},
+	}
+	s.networks[bridge.ID] = bridge
+
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Close ends all streaming requests and shuts the server down.
+func (s *Server) Close() {
+	s.closeOnce.Do(func() { close(s.closed) })
+	s.mu.Lock()
+	for _, sess := range s.sessions {
+		sess.cc.Close()
+	}
+	s.mu.Unlock()
+	s.Server.Close()
+}
+
+// SetBehavior scripts the containers created from image from now on. image is matched against the image a
+// container is created from, either with its tag ("postgres:11") or without it ("postgres", any tag).
+func (s *Server) SetBehavior(image string, b Behavior) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.behaviors[image] = b
+}
+
+// Fail makes every request matching method and pattern fail with status and message, until the returned function
+// is called. The pattern is matched with path.Match against the request path without the API version, e.g.
+// "/containers/*/start" or "/images/create". An empty method matches any method.
+func (s *Server) Fail(method, pattern string, status int, message string) (restore func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f := &failure{method: method, pattern: pattern, status: status, message: message}
+	s.failures = append(s.failures, f)
+
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for i, g := range s.failures {
+			if g == f {
+				s.failures = append(s.failures[:i], s.failures[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// After calls f once a request matching method and pattern (see Fail) has been handled, before its response is
+// sent, until the returned function is called. It can e.g. cancel the context of the client after a container has
+// been created. The responses of hooked requests are buffered, so streaming and hijacked requests cannot be hooked.
+func (s *Server) After(method, pattern string, f func(r *http.Request)) (restore func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	h := &hook{method: method, pattern: pattern, f: f}
+	s.hooks = append(s.hooks, h)
+
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for i, g := range s.hooks {
+			if g == h {
+				s.hooks = append(s.hooks[:i], s.hooks[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// EmulatePodman makes the server identify itself as Podman, optionally running rootless, and report published
+// ports the way Podman does.
+func (s *Server) EmulatePodman(rootless bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.podman = true
+	s.rootless = rootless
+}
+
+// AddImage makes image available as if it had been pulled before.
+func (s *Server) AddImage(image string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.addImage(image)
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	p := "/" + strings.TrimPrefix(versionPrefix.ReplaceAllString(r.URL.Path, "/"), "/")
+
+	s.mu.Lock()
+	for _, f := range s.failures {
+		if matches(f.method, f.pattern, r, p) {
+			s.mu.Unlock()
+			writeError(w, f.status, f.message)
+			return
+		}
+	}
+	var hooks []*hook
+	for _, h := range s.hooks {
+		if matches(h.method, h.pattern, r, p) {
+			hooks = append(hooks, h)
+		}
+	}
+	s.mu.Unlock()
+
+	if len(hooks) == 0 {
+		s.route(w, r, p)
+		return
+	}
+
+	rec := httptest.NewRecorder()
+	s.route(rec, r, p)
+	for _, h := range hooks {
+		h.f(r)
+	}
+	for k, v := range rec.Header() {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(rec.Code)
+	_, _ = rec.Body.WriteTo(w)
+}
+
+// route passes a request to the handler of its path p, which does not include the API version.
+func (s *Server) route(w http.ResponseWriter, r *http.Request, p string) {
+	parts := strings.Split(strings.Trim(p, "/"), "/")
+	switch parts[0] {
+	case "_ping":
+		w.Header().Set("API-Version", APIVersion)
+		_, _ = w.Write([]byte("OK"))
+	case "version":
+		s.handleVersion(w, r)
+	case "info":
+		s.handleInfo(w, r)
+	case "containers":
+		s.routeContainers(w, r, parts[1:])
+	case "exec":
+		s.routeExec(w, r, parts[1:])
+	case "images":
+		s.routeImages(w, r, strings.TrimPrefix(p, "/images"))
+	case "networks":
+		s.routeNetworks(w, r, parts[1:])
+	case "volumes":
+		s.routeVolumes(w, r, parts[1:])
+	case "events":
+		s.handleEvents(w, r)
+	case "build":
+		if r.Method != http.MethodPost {
+			writeError(w, http.StatusNotFound, "page not found")
+			return
+		}
+		s.buildImage(w, r)
+	case "session":
+		if r.Method != http.MethodPost {
+			writeError(w, http.StatusNotFound, "page not found")
+			return
+		}
+		s.session(w, r)
+	default:
+		writeError(w, http.StatusNotFound, "page not found")
+	}
+}
+
+func (s *Server) handleVersion(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	engine := "Engine"
+	if s.podman {
+		engine = "Podman Engine"
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"Platform":      map[string]string{"Name": "fakedocker"},
+		"Components":    []map[string]string{{"Name": engine, "Version": "fakedocker"}},
+		"ApiVersion":    APIVersion,
+		"MinAPIVersion": "1.12",
+		"Version":       "fakedocker",
+		"Os":            "linux",
+		"Arch":          "amd64",
+	})
+}
+
+func (s *Server) handleInfo(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	securityOptions := []string{"name=seccomp,profile=default"}
+	if s.rootless {
+		securityOptions = append(securityOptions, "name=rootless")
+	}
+
+	running := 0
+	for _, c := range s.containers {
+		if c.State.Running {
+			running++
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"ID":                "fakedocker",
+		"Name":              "fakedocker",
+		"Containers":        len(s.containers),
+		"ContainersRunning": running,
+		"Images":            len(s.images),
+		"ServerVersion":     "fakedocker",
+		"OperatingSystem":   "fakedocker",
+		"OSType":            "linux",
+		"Architecture":      "x86_64",
+		"SecurityOptions":   securityOptions,
+	})
+}
+
+// behavior returns the behavior scripted for image. The caller must hold s.mu.
+func (s *Server) behavior(image string) Behavior {
+	if b, ok := s.behaviors[image]; ok {
+		return b
+	}
+	repository, _ := splitImage(image)
+	if b, ok := s.behaviors[repository]; ok {
+		return b
+	}
+	return Behavior{}
+}
+
+// parseFilters decodes the filters query parameter, which comes either as map[string][]string or, from older
+// clients, as map[string]map[string]bool.
+func parseFilters(r *http.Request) (map[string][]string, error) {
+	raw := r.URL.Query().Get("filters")
+	if raw == "" {
+		return nil, nil
+	}
+
+	var filters map[string][]string
+	if err := json.Unmarshal([]byte(raw), &filters); err == nil {
+		return filters, nil
+	}
+
+	var legacy map[string]map[string]bool
+	if err := json.Unmarshal([]byte(raw), &legacy); err != nil {
+		return nil, fmt.Errorf("invalid filters: %s", raw)
+	}
+	filters = map[string][]string{}
+	for k, values := range legacy {
+		for v, ok := range values {
+			if ok {
+				filters[k] = append(filters[k], v)
+			}
+		}
+	}
+	return filters, nil
+}
+
+// matchLabels reports whether labels satisfy all "key" and "key=value" filters.
+func matchLabels(labels map[string]string, filters []string) bool {
+	for _, f := range filters {
+		kv := strings.SplitN(f, "=", 2)
+		v, ok := labels[kv[0]]
+		if !ok || (len(kv) == 2 && v != kv[1]) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchAny reports whether filters is empty or match returns true for one of them.
+func matchAny(filters []string, match func(f string) bool) bool {
+	if len(filters) == 0 {
+		return true
+	}
+	for _, f := range filters {
+		if match(f) {
+			return true
+		}
+	}
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"message": message})
+}
+
+func newID() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// splitImage splits an image reference into repository and tag, defaulting the tag to "latest".
+func splitImage(image string) (repository, tag string) {
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[:i], image[i+1:]
+	}
+	return image, "latest"
+}
+
+func normalizeImage(image string) string {
+	repository, tag := splitImage(image)
+	return repository + ":" + tag
+}
+
+func now() time.Time {
+	return time.Now().UTC()
+}
@@ -0,0 +1,164 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package fakedocker_test
+
+import (
+	"bytes"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ory/dockertest/v3"
+	dc "github.com/ory/dockertest/v3/docker"
+	"github.com/ory/dockertest/v3/fakedocker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newPool(t *testing.T) (*fakedocker.Server, *dockertest.Pool) {
+	fake := fakedocker.NewServer()
+	t.Cleanup(fake.Close)
+
+	pool, err := dockertest.NewPool(fake.URL)
+	require.Nil(t, err)
+	require.Nil(t, pool.Client.Ping())
+	pool.MaxWait = 5 * time.Second
+	return fake, pool
+}
+
+func TestRunWithOptions(t *testing.T) {
+	fake, pool := newPool(t)
+	fake.SetBehavior("postgres", fakedocker.Behavior{
+		Stdout: "database system is ready to accept connections\n",
+		Exec: func(cmd []string) fakedocker.ExecResult {
+			if cmd[0] == "pg_isready" {
+				return fakedocker.ExecResult{Stdout: "accepting connections\n"}
+			}
+			return fakedocker.ExecResult{Stderr: "command not found\n", ExitCode: 127}
+		},
+	})
+
+	resource, err := pool.RunWithOptions(&dockertest.RunOptions{
+		Repository:   "postgres",
+		Tag:          "9.5",
+		ExposedPorts: []string{"5432/tcp"},
+		Labels:       map[string]string{"app": "test"},
+		WaitFor:      dockertest.ForLog(regexp.MustCompile("ready to accept connections"), 1),
+	})
+	require.Nil(t, err)
+	assert.NotEmpty(t, resource.GetPort("5432/tcp"))
+	assert.True(t, resource.Container.State.Running)
+
+	var stdout bytes.Buffer
+	exitCode, err := resource.Exec([]string{"pg_isready"}, dockertest.ExecOptions{StdOut: &stdout})
+	require.Nil(t, err)
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, "accepting connections\n", stdout.String())
+
+	exitCode, err = resource.Exec([]string{"psql"}, dockertest.ExecOptions{})
+	require.Nil(t, err)
+	assert.Equal(t, 127, exitCode)
+
+	found, ok := pool.ContainerByName(strings.TrimPrefix(resource.Container.Name, "/"))
+	require.True(t, ok)
+	assert.Equal(t, resource.Container.ID, found.Container.ID)
+
+	require.Nil(t, pool.Purge(resource))
+	_, ok = fake.Container(resource.Container.ID)
+	assert.False(t, ok)
+}
+
+func TestExit(t *testing.T) {
+	fake, pool := newPool(t)
+	fake.SetBehavior("busybox:latest", fakedocker.Behavior{Stderr: "boom\n", Exit: true, ExitCode: 3})
+
+	resource, err := pool.Run("busybox", "", nil)
+	require.Nil(t, err)
+
+	exitCode, err := pool.Client.WaitContainer(resource.Container.ID)
+	require.Nil(t, err)
+	assert.Equal(t, 3, exitCode)
+
+	var stderr bytes.Buffer
+	require.Nil(t, pool.Client.Logs(dc.LogsOptions{
+		Container:   resource.Container.ID,
+		ErrorStream: &stderr,
+		Stderr:      true,
+	}))
+	assert.Equal(t, "boom\n", stderr.String())
+
+	running, err := pool.Run("busybox", "1", nil)
+	require.Nil(t, err)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = fake.Exit(running.Container.ID, 42)
+	}()
+	exitCode, err = pool.Client.WaitContainer(running.Container.ID)
+	require.Nil(t, err)
+	assert.Equal(t, 42, exitCode)
+}
+
+func TestFail(t *testing.T) {
+	fake, pool := newPool(t)
+
+	restore := fake.Fail(http.MethodPost, "/containers/*/start", http.StatusInternalServerError, "cannot start")
+	_, err := pool.Run("busybox", "latest", nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot start")
+
+	restore()
+	_, err = pool.Run("busybox", "latest", nil)
+	require.Nil(t, err)
+}
+
+func TestNetworksAndVolumes(t *testing.T) {
+	_, pool := newPool(t)
+
+	network, err := pool.CreateNetwork("test-network")
+	require.Nil(t, err)
+	volume, err := pool.CreateVolume("test-volume")
+	require.Nil(t, err)
+
+	resource, err := pool.RunWithOptions(&dockertest.RunOptions{
+		Repository: "busybox",
+		Networks:   []*dockertest.Network{network},
+		Mounts:     []string{"test-volume:/data"},
+	})
+	require.Nil(t, err)
+	assert.NotEmpty(t, resource.GetIPInNetwork(network))
+
+	networks, err := pool.NetworksByName("test-network")
+	require.Nil(t, err)
+	require.Len(t, networks, 1)
+	assert.Contains(t, networks[0].Network.Containers, resource.Container.ID)
+
+	require.Nil(t, pool.Purge(resource))
+	require.Nil(t, pool.RemoveNetwork(network))
+	require.Nil(t, pool.RemoveVolume(volume))
+}
+
+func TestEvents(t *testing.T) {
+	_, pool := newPool(t)
+
+	events := make(chan *dc.APIEvents, 16)
+	require.Nil(t, pool.Client.AddEventListener(events))
+	defer pool.Client.RemoveEventListener(events)
+
+	resource, err := pool.Run("busybox", "latest", nil)
+	require.Nil(t, err)
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case e := <-events:
+			if e.Action == "start" && e.Actor.ID == resource.Container.ID {
+				return
+			}
+		case <-timeout:
+			t.Fatal("did not receive start event")
+		}
+	}
+}
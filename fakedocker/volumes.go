@@ -0,0 +1,138 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package fakedocker
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	dc "github.com/ory/dockertest/v3/docker"
+)
+
+func (s *Server) routeVolumes(w http.ResponseWriter, r *http.Request, parts []string) {
+	switch {
+	case len(parts) == 0 && r.Method == http.MethodGet:
+		s.listVolumes(w, r)
+	case len(parts) == 1 && parts[0] == "create" && r.Method == http.MethodPost:
+		s.createVolume(w, r)
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		s.inspectVolume(w, r, parts[0])
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		s.removeVolume(w, r, parts[0])
+	default:
+		writeError(w, http.StatusNotFound, "page not found")
+	}
+}
+
+func (s *Server) listVolumes(w http.ResponseWriter, r *http.Request) {
+	filters, err := parseFilters(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := []dc.Volume{}
+	for _, v := range s.volumes {
+		if !matchLabels(v.Labels, filters["label"]) ||
+			!matchAny(filters["name"], func(f string) bool { return strings.Contains(v.Name, f) }) ||
+			!matchAny(filters["driver"], func(f string) bool { return v.Driver == f }) ||
+			!matchAny(filters["dangling"], func(f string) bool { return (f == "true" || f == "1") == !s.volumeInUse(v.Name) }) {
+			continue
+		}
+		list = append(list, *v)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	writeJSON(w, http.StatusOK, map[string]interface{}{"Volumes": list, "Warnings": nil})
+}
+
+func (s *Server) createVolume(w http.ResponseWriter, r *http.Request) {
+	var opts dc.CreateVolumeOptions
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if v, ok := s.volumes[opts.Name]; ok && opts.Name != "" {
+		// like the daemon, creating an existing volume returns it
+		writeJSON(w, http.StatusCreated, v)
+		return
+	}
+
+	v := &dc.Volume{
+		Name:    opts.Name,
+		Driver:  opts.Driver,
+		Labels:  opts.Labels,
+		Options: opts.DriverOpts,
+	}
+	if v.Name == "" {
+		v.Name = newID()
+	}
+	if v.Driver == "" {
+		v.Driver = "local"
+	}
+	if v.Labels == nil {
+		v.Labels = map[string]string{}
+	}
+	v.Mountpoint = "/var/lib/docker/volumes/" + v.Name + "/_data"
+
+	s.volumes[v.Name] = v
+	s.emit("volume", "create", v.Name, map[string]string{"driver": v.Driver})
+	writeJSON(w, http.StatusCreated, v)
+}
+
+func (s *Server) inspectVolume(w http.ResponseWriter, _ *http.Request, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.volumes[name]
+	if !ok {
+		writeError(w, http.StatusNotFound, "get "+name+": no such volume")
+		return
+	}
+	writeJSON(w, http.StatusOK, v)
+}
+
+func (s *Server) removeVolume(w http.ResponseWriter, _ *http.Request, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.volumes[name]
+	if !ok {
+		writeError(w, http.StatusNotFound, "get "+name+": no such volume")
+		return
+	}
+	if s.volumeInUse(name) {
+		writeError(w, http.StatusConflict, "remove "+name+": volume is in use")
+		return
+	}
+
+	delete(s.volumes, name)
+	s.emit("volume", "destroy", v.Name, map[string]string{"driver": v.Driver})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// volumeInUse reports whether a container mounts the named volume. The caller must hold s.mu.
+func (s *Server) volumeInUse(name string) bool {
+	for _, c := range s.containers {
+		for _, bind := range c.HostConfig.Binds {
+			if strings.SplitN(bind, ":", 2)[0] == name {
+				return true
+			}
+		}
+		for _, m := range c.HostConfig.Mounts {
+			if m.Type == "volume" && m.Source == name {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,156 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package dockertest
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	dc "github.com/ory/dockertest/v3/docker"
+)
+
+// File is a file RunWithOptions writes into the container after creating and before starting it, see
+// RunOptions.Files. Unlike a bind mount it works with remote daemons and Docker-in-Docker.
+type File struct {
+	// Path is the absolute path of the file in the container. Missing parent directories are created.
+	Path string
+
+	// Content is the content of the file, unless HostPath is set.
+	Content []byte
+	// HostPath is the path of a file on the host to read the content from.
+	HostPath string
+
+	// Mode holds the permissions of the file, 0644 if zero.
+	Mode os.FileMode
+	// UID and GID own the file, which is owned by root by default.
+	UID, GID int
+
+	// Template renders the content with text/template, with a *FileTemplateData describing the container, e.g.
+	//
+	//	listen_addresses = '{{ .Hostname }}'
+	Template bool
+}
+
+// FileTemplateData is passed to the templates of RunOptions.Files. It describes the container that was created.
+type FileTemplateData struct {
+	ID       string
+	Name     string
+	Hostname string
+	Env      map[string]string
+
+	// Aliases holds the network aliases of the container on all networks it is connected to, and Networks the
+	// aliases on each network by name.
+	Aliases  []string
+	Networks map[string][]string
+}
+
+// writeFiles writes files into the created container c as a single archive. Their content is read and rendered
+// first, so that nothing is written if one of them fails.
+func (d *Pool) writeFiles(ctx context.Context, c *dc.Container, files []File) error {
+	var data *FileTemplateData
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, f := range files {
+		if !path.IsAbs(f.Path) {
+			return fmt.Errorf("path of file %q is not absolute", f.Path)
+		}
+
+		content := f.Content
+		if f.HostPath != "" {
+			var err error
+			if content, err = os.ReadFile(f.HostPath); err != nil {
+				return err
+			}
+		}
+
+		if f.Template {
+			if data == nil {
+				inspected, err := d.Client.InspectContainerWithContext(c.ID, ctx)
+				if err != nil {
+					return err
+				}
+				data = newFileTemplateData(inspected)
+			}
+			tmpl, err := template.New(f.Path).Option("missingkey=error").Parse(string(content))
+			if err != nil {
+				return fmt.Errorf("invalid template for %s: %w", f.Path, err)
+			}
+			var rendered bytes.Buffer
+			if err := tmpl.Execute(&rendered, data); err != nil {
+				return fmt.Errorf("failed to render template for %s: %w", f.Path, err)
+			}
+			content = rendered.Bytes()
+		}
+
+		mode := f.Mode.Perm()
+		if mode == 0 {
+			mode = 0o644
+		}
+		err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     strings.TrimPrefix(path.Clean(f.Path), "/"),
+			Mode:     int64(mode),
+			Size:     int64(len(content)),
+			Uid:      f.UID,
+			Gid:      f.GID,
+			ModTime:  time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := tw.Write(content); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	return d.Client.UploadToContainer(c.ID, dc.UploadToContainerOptions{
+		InputStream:          &buf,
+		Path:                 "/",
+		NoOverwriteDirNonDir: true,
+		Context:              ctx,
+	})
+}
+
+func newFileTemplateData(c *dc.Container) *FileTemplateData {
+	data := &FileTemplateData{
+		ID:       c.ID,
+		Name:     strings.TrimPrefix(c.Name, "/"),
+		Env:      map[string]string{},
+		Networks: map[string][]string{},
+	}
+	if c.Config != nil {
+		data.Hostname = c.Config.Hostname
+		for _, kv := range c.Config.Env {
+			if i := strings.IndexByte(kv, '='); i > 0 {
+				data.Env[kv[:i]] = kv[i+1:]
+			}
+		}
+	}
+
+	if c.NetworkSettings != nil {
+		seen := map[string]bool{}
+		for name, n := range c.NetworkSettings.Networks {
+			data.Networks[name] = n.Aliases
+			for _, alias := range n.Aliases {
+				if !seen[alias] {
+					seen[alias] = true
+					data.Aliases = append(data.Aliases, alias)
+				}
+			}
+		}
+		sort.Strings(data.Aliases)
+	}
+	return data
+}
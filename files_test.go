@@ -0,0 +1,99 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package dockertest
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunWithFiles(t *testing.T) {
+	fake, pool := newFakePool(t)
+	network, err := pool.CreateNetwork("files-network")
+	require.Nil(t, err)
+
+	hostFile := filepath.Join(t.TempDir(), "pg_hba.conf")
+	require.Nil(t, os.WriteFile(hostFile, []byte("host all all all trust\n"), 0o600))
+
+	resource, err := pool.RunWithOptions(&RunOptions{
+		Repository: "postgres",
+		Name:       "files-db",
+		Env:        []string{"POSTGRES_USER=app"},
+		Networks:   []*Network{network},
+		Aliases:    []string{"db", "postgres"},
+		Files: []File{
+			{Path: "/etc/postgresql/pg_hba.conf", HostPath: hostFile, Mode: 0o640, UID: 999, GID: 999},
+			{Path: "/docker-entrypoint-initdb.d/init.sql", Content: []byte("CREATE TABLE t (id int);\n")},
+			{
+				Path:     "/etc/app.conf",
+				Content:  []byte("name={{ .Name }} user={{ .Env.POSTGRES_USER }} aliases={{ range .Aliases }}{{ . }},{{ end }}\n"),
+				Template: true,
+			},
+		},
+	})
+	require.Nil(t, err)
+
+	f, ok := fake.File(resource.Container.ID, "/etc/postgresql/pg_hba.conf")
+	require.True(t, ok)
+	assert.Equal(t, "host all all all trust\n", string(f.Data))
+	assert.Equal(t, os.FileMode(0o640), f.Mode)
+	assert.Equal(t, 999, f.UID)
+	f, ok = fake.File(resource.Container.ID, "/docker-entrypoint-initdb.d/init.sql")
+	require.True(t, ok)
+	assert.Equal(t, os.FileMode(0o644), f.Mode)
+	assert.Equal(t, 0, f.UID)
+	f, ok = fake.File(resource.Container.ID, "/etc/app.conf")
+	require.True(t, ok)
+	assert.Equal(t, "name=files-db user=app aliases=db,postgres,\n", string(f.Data))
+
+	_, err = pool.RunWithOptions(&RunOptions{
+		Repository: "postgres",
+		Name:       "broken-template",
+		Files:      []File{{Path: "/etc/app.conf", Content: []byte("{{ .Env.MISSING }}"), Template: true}},
+	})
+	var runErr *RunError
+	require.ErrorAs(t, err, &runErr)
+	assert.Equal(t, PhaseFiles, runErr.Phase)
+	_, ok = fake.Container("broken-template")
+	assert.False(t, ok)
+}
+
+func TestRunWithReuseHostFiles(t *testing.T) {
+	_, pool := newFakePool(t)
+	hostFile := filepath.Join(t.TempDir(), "pg_hba.conf")
+	require.Nil(t, os.WriteFile(hostFile, []byte("host all all all trust\n"), 0o600))
+	opts := func() *RunOptions {
+		return &RunOptions{
+			Repository: "postgres",
+			Reuse:      true,
+			Files:      []File{{Path: "/etc/postgresql/pg_hba.conf", HostPath: hostFile}},
+		}
+	}
+
+	first, err := pool.RunWithOptions(opts())
+	require.Nil(t, err)
+	second, err := pool.RunWithOptions(opts())
+	require.Nil(t, err)
+	assert.True(t, second.Reused())
+
+	// the container is identified by the content of the file, not its path
+	require.Nil(t, os.WriteFile(hostFile, []byte("host all all all md5\n"), 0o600))
+	changed, err := pool.RunWithOptions(opts())
+	require.Nil(t, err)
+	assert.False(t, changed.Reused())
+	assert.NotEqual(t, first.Container.ID, changed.Container.ID)
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	require.Nil(t, os.Chmod(hostFile, 0o644))
+	chmodded, err := pool.RunWithOptions(opts())
+	require.Nil(t, err)
+	assert.False(t, chmodded.Reused())
+}
@@ -17,6 +17,7 @@ require (
 	github.com/opencontainers/runc v1.1.7
 	github.com/sirupsen/logrus v1.9.2
 	github.com/stretchr/testify v1.8.3
+	golang.org/x/net v0.10.0
 	golang.org/x/sys v0.8.0
 	gotest.tools/v3 v3.3.0
 )
@@ -37,6 +38,7 @@ require (
 	github.com/xeipuuv/gojsonreference v0.0.0-20180127040603-bd5ef7bd5415 // indirect
 	github.com/xeipuuv/gojsonschema v1.2.0 // indirect
 	golang.org/x/mod v0.9.0 // indirect
+	golang.org/x/text v0.9.0 // indirect
 	golang.org/x/tools v0.7.0 // indirect
 	gopkg.in/yaml.v2 v2.3.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
@@ -0,0 +1,141 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package dockertest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	dc "github.com/ory/dockertest/v3/docker"
+)
+
+// healthPollInterval is how often WaitHealthy inspects the container if the event stream fails.
+const healthPollInterval = 500 * time.Millisecond
+
+// ErrNoHealthcheck is returned by WaitHealthy if neither the image nor RunOptions.Healthcheck define a healthcheck.
+var ErrNoHealthcheck = errors.New("container has no healthcheck")
+
+// HealthError is returned by WaitHealthy if the container did not become healthy. Log holds the results of the
+// most recent probes, as recorded by Docker.
+type HealthError struct {
+	// Status is the health status of the container, or "exited" if it exited.
+	Status string
+	Log    []dc.HealthCheck
+
+	// Err is the reason for giving up before the container was reported unhealthy, e.g. context.DeadlineExceeded.
+	Err error
+}
+
+func (e *HealthError) Error() string {
+	var b strings.Builder
+	if e.Err != nil {
+		fmt.Fprintf(&b, "Container did not become healthy: %s (status %s)", e.Err, e.Status)
+	} else {
+		fmt.Fprintf(&b, "Container is %s", e.Status)
+	}
+	for _, check := range e.Log {
+		fmt.Fprintf(&b, "\n\tprobe at %s exited with %d: %s",
+			check.Start.Format(time.RFC3339), check.ExitCode, strings.TrimSpace(check.Output))
+	}
+	return b.String()
+}
+
+func (e *HealthError) Unwrap() error {
+	return e.Err
+}
+
+// WaitHealthy blocks until the Docker HEALTHCHECK reports the container as healthy. It follows the container's
+// health_status events, and polls its state if the events cannot be streamed. If the container becomes unhealthy,
+// exits, or ctx is done first, the error is a *HealthError holding the probe log.
+func (r *Resource) WaitHealthy(ctx context.Context) error {
+	since := time.Now()
+	done, err := r.checkHealth(ctx)
+	if done || err != nil {
+		return err
+	}
+
+	// the events since the state was inspected are replayed, so that no status change is missed
+	events, errs := r.pool.Client.Events(ctx, dc.EventsOptions{
+		Filters: map[string][]string{
+			"type":      {"container"},
+			"container": {r.Container.ID},
+			"event":     {"health_status", "die"},
+		},
+		Since: since,
+	})
+
+	var poll <-chan time.Time
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+		case <-errs:
+			events, errs = nil, nil
+			ticker := time.NewTicker(healthPollInterval)
+			defer ticker.Stop()
+			poll = ticker.C
+			continue
+		case <-poll:
+		case <-ctx.Done():
+			return r.healthError(ctx.Err())
+		}
+
+		if done, err := r.checkHealth(ctx); done || err != nil {
+			return err
+		}
+	}
+}
+
+// checkHealth inspects the container and reports whether waiting for it to become healthy is over, along with the
+// error to return if it did not.
+func (r *Resource) checkHealth(ctx context.Context) (bool, error) {
+	c, err := r.pool.Client.InspectContainerWithContext(r.Container.ID, ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return true, r.healthError(ctx.Err())
+		}
+		return true, fmt.Errorf("Failed to inspect container: %w", err)
+	}
+
+	health := c.State.Health
+	switch {
+	case health.Status == "healthy":
+		return true, nil
+	case health.Status == "" && !hasHealthcheck(c.Config):
+		return true, ErrNoHealthcheck
+	case health.Status == "unhealthy":
+		return true, &HealthError{Status: health.Status, Log: health.Log}
+	case !c.State.Running:
+		return true, &HealthError{Status: "exited", Log: health.Log}
+	}
+	return false, nil
+}
+
+// healthError reports the health of the container after waiting was given up because of err. It inspects the
+// container once more without the context of the wait, which is done already.
+func (r *Resource) healthError(err error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	herr := &HealthError{Status: "unknown", Err: err}
+	if c, inspectErr := r.pool.Client.InspectContainerWithContext(r.Container.ID, ctx); inspectErr == nil {
+		herr.Status = c.State.Health.Status
+		herr.Log = c.State.Health.Log
+	}
+	return herr
+}
+
+// hasHealthcheck reports whether config, which includes the healthcheck of the image, defines a healthcheck.
+func hasHealthcheck(config *dc.Config) bool {
+	if config == nil || config.Healthcheck == nil || len(config.Healthcheck.Test) == 0 {
+		return false
+	}
+	return config.Healthcheck.Test[0] != "NONE"
+}
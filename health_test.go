@@ -0,0 +1,68 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package dockertest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	dc "github.com/ory/dockertest/v3/docker"
+	"github.com/ory/dockertest/v3/fakedocker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWaitHealthy(t *testing.T) {
+	fake, pool := newFakePool(t)
+	fake.SetBehavior("postgres", fakedocker.Behavior{Health: "starting"})
+
+	resource, err := pool.RunWithOptions(&RunOptions{
+		Repository:  "postgres",
+		Healthcheck: &dc.HealthConfig{Test: []string{"CMD", "pg_isready"}, Interval: time.Second, Retries: 3},
+	})
+	require.Nil(t, err)
+	assert.Equal(t, []string{"CMD", "pg_isready"}, resource.Container.Config.Healthcheck.Test)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = fake.SetHealth(resource.Container.ID, "healthy", dc.HealthCheck{Output: "accepting connections"})
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.Nil(t, resource.WaitHealthy(ctx))
+
+	unhealthy, err := pool.RunWithOptions(&RunOptions{
+		Repository:  "postgres",
+		Healthcheck: &dc.HealthConfig{Test: []string{"CMD", "pg_isready"}},
+	})
+	require.Nil(t, err)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = fake.SetHealth(unhealthy.Container.ID, "unhealthy", dc.HealthCheck{ExitCode: 2, Output: "no response"})
+	}()
+	err = unhealthy.WaitHealthy(ctx)
+	var healthErr *HealthError
+	require.ErrorAs(t, err, &healthErr)
+	assert.Equal(t, "unhealthy", healthErr.Status)
+	require.Len(t, healthErr.Log, 1)
+	assert.Equal(t, "no response", healthErr.Log[0].Output)
+	assert.Contains(t, err.Error(), "no response")
+
+	short, cancelShort := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancelShort()
+	starting, err := pool.RunWithOptions(&RunOptions{
+		Repository:  "postgres",
+		Healthcheck: &dc.HealthConfig{Test: []string{"CMD", "pg_isready"}},
+	})
+	require.Nil(t, err)
+	err = starting.WaitHealthy(short)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.ErrorAs(t, err, &healthErr)
+	assert.Equal(t, "starting", healthErr.Status)
+
+	plain, err := pool.Run("busybox", "latest", nil)
+	require.Nil(t, err)
+	require.ErrorIs(t, plain.WaitHealthy(ctx), ErrNoHealthcheck)
+}
@@ -0,0 +1,145 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package dockertest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	dc "github.com/ory/dockertest/v3/docker"
+)
+
+const (
+	// StreamStdout is the stream of a Line the container wrote to its standard output.
+	StreamStdout = "stdout"
+	// StreamStderr is the stream of a Line the container wrote to its standard error.
+	StreamStderr = "stderr"
+)
+
+// Line is a line of output of a container.
+type Line struct {
+	// Stream is StreamStdout or StreamStderr. The output of containers started with RunOptions.Tty is not
+	// multiplexed, so all of it is reported as StreamStdout.
+	Stream string
+	// Time is when the container wrote the line, as recorded by the daemon.
+	Time time.Time
+	// Text is the line without its line ending.
+	Text string
+}
+
+// FollowLogs calls handler with every line of output of the container, from its start on, until the container stops
+// or ctx is done. The handler is called from a single goroutine. A last line without a line ending is passed to it
+// once the output ends.
+//
+//	err := resource.FollowLogs(ctx, func(l dockertest.Line) {
+//		t.Logf("%s %s: %s", l.Time.Format(time.RFC3339), l.Stream, l.Text)
+//	})
+func (r *Resource) FollowLogs(ctx context.Context, handler func(Line)) error {
+	return r.readLogs(ctx, true, handler)
+}
+
+// readLogs passes the lines of output of the container to handler, and keeps following it if follow is set.
+func (r *Resource) readLogs(ctx context.Context, follow bool, handler func(Line)) error {
+	stdout := &lineWriter{stream: StreamStdout, handler: handler}
+	stderr := &lineWriter{stream: StreamStderr, handler: handler}
+
+	err := r.pool.Client.Logs(dc.LogsOptions{
+		Context:      ctx,
+		Container:    r.Container.ID,
+		OutputStream: stdout,
+		ErrorStream:  stderr,
+		Stdout:       true,
+		Stderr:       true,
+		Follow:       follow,
+		Timestamps:   true,
+		RawTerminal:  r.Container.Config != nil && r.Container.Config.Tty,
+	})
+	stdout.flush()
+	stderr.flush()
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to read logs of container %s: %w", r.Container.ID, err)
+	}
+	return nil
+}
+
+// WaitForLog blocks until lines of output of the container matched pattern at least occurrences times, counting the
+// output since the container started. Each line is matched on its own, so the pattern cannot span several lines.
+// It returns an error if the container stops before, or ctx is done.
+func (r *Resource) WaitForLog(ctx context.Context, pattern *regexp.Regexp, occurrences int) error {
+	if occurrences < 1 {
+		occurrences = 1
+	}
+
+	followCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var matched int
+	err := r.FollowLogs(followCtx, func(l Line) {
+		if matched >= occurrences {
+			return
+		}
+		matched += len(pattern.FindAllStringIndex(l.Text, -1))
+		if matched >= occurrences {
+			cancel()
+		}
+	})
+
+	switch {
+	case matched >= occurrences:
+		return nil
+	case err == nil:
+		return fmt.Errorf("Container stopped after log pattern %q matched %d of %d times", pattern, matched, occurrences)
+	default:
+		return fmt.Errorf("log pattern %q matched %d of %d times: %w", pattern, matched, occurrences, err)
+	}
+}
+
+// lineWriter is an io.Writer that splits the output of a stream into lines, and passes each complete line to
+// handler.
+type lineWriter struct {
+	stream  string
+	handler func(Line)
+
+	buf []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.emit(string(w.buf[:i]))
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// flush passes the rest of the output, which does not end with a line ending, to handler.
+func (w *lineWriter) flush() {
+	if len(w.buf) > 0 {
+		w.emit(string(w.buf))
+		w.buf = nil
+	}
+}
+
+// emit passes a line, prefixed with the timestamp the daemon added, to handler.
+func (w *lineWriter) emit(text string) {
+	l := Line{Stream: w.stream, Text: strings.TrimSuffix(text, "\r")}
+	if i := strings.IndexByte(l.Text, ' '); i > 0 {
+		if ts, err := time.Parse(time.RFC3339Nano, l.Text[:i]); err == nil {
+			l.Time, l.Text = ts, l.Text[i+1:]
+		}
+	}
+	w.handler(l)
+}
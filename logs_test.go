@@ -0,0 +1,82 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package dockertest
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/ory/dockertest/v3/fakedocker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFollowLogs(t *testing.T) {
+	fake, pool := newFakePool(t)
+	fake.SetBehavior("busybox", fakedocker.Behavior{Stdout: "starting\nready\n", Stderr: "warning\r\n"})
+
+	for _, tty := range []bool{false, true} {
+		t.Run(fmt.Sprintf("tty=%t", tty), func(t *testing.T) {
+			resource, err := pool.RunWithOptions(&RunOptions{Repository: "busybox", Tty: tty})
+			require.Nil(t, err)
+
+			go func() {
+				time.Sleep(50 * time.Millisecond)
+				_ = fake.Print(resource.Container.ID, "partial", "")
+				_ = fake.Exit(resource.Container.ID, 0)
+			}()
+			var lines []Line
+			require.Nil(t, resource.FollowLogs(context.Background(), func(l Line) {
+				lines = append(lines, l)
+			}))
+
+			require.Len(t, lines, 4)
+			var texts, streams []string
+			for _, l := range lines {
+				texts = append(texts, l.Text)
+				streams = append(streams, l.Stream)
+				assert.WithinDuration(t, time.Now(), l.Time, time.Minute)
+			}
+			assert.Equal(t, []string{"starting", "ready", "warning", "partial"}, texts)
+			if tty {
+				assert.Equal(t, []string{"stdout", "stdout", "stdout", "stdout"}, streams)
+			} else {
+				assert.Equal(t, []string{"stdout", "stdout", "stderr", "stdout"}, streams)
+			}
+		})
+	}
+}
+
+func TestWaitForLog(t *testing.T) {
+	fake, pool := newFakePool(t)
+	fake.SetBehavior("postgres", fakedocker.Behavior{Stdout: "database system is ready to accept connections\n"})
+
+	resource, err := pool.Run("postgres", "latest", nil)
+	require.Nil(t, err)
+	ready := regexp.MustCompile("ready to accept connections")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.Nil(t, resource.WaitForLog(ctx, ready, 1))
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = fake.Print(resource.Container.ID, "database system is ready to accept connections\n", "")
+	}()
+	require.Nil(t, resource.WaitForLog(ctx, ready, 2))
+
+	short, cancelShort := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancelShort()
+	err = resource.WaitForLog(short, ready, 3)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Contains(t, err.Error(), "matched 2 of 3 times")
+
+	require.Nil(t, fake.Exit(resource.Container.ID, 1))
+	err = resource.WaitForLog(ctx, ready, 3)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Container stopped")
+}
@@ -0,0 +1,228 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package dockertest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	dc "github.com/ory/dockertest/v3/docker"
+	"github.com/ory/dockertest/v3/docker/pkg/jsonmessage"
+)
+
+// TerminalProgress returns a Pool.Progress hook that renders pulls and builds to out like the docker CLI, see
+// jsonmessage.DisplayJSONMessagesStream. If isTerminal is set, out is the terminal with the file descriptor fd and
+// progress bars are updated in place:
+//
+//	pool.Progress = dockertest.TerminalProgress(os.Stderr, os.Stderr.Fd(), true)
+func TerminalProgress(out io.Writer, fd uintptr, isTerminal bool) func(jsonmessage.JSONMessage) {
+	var mu sync.Mutex
+	display := jsonmessage.NewDisplayer(out, fd, isTerminal)
+	return func(msg jsonmessage.JSONMessage) {
+		if msg.Error != nil || msg.ErrorMessage != "" || msg.Aux != nil {
+			// errors are returned by the pull or build
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		_ = display.Display(msg)
+	}
+}
+
+// LogProgress returns a Pool.Progress hook that logs pulls and builds to t, which is usually a *testing.T. Updates
+// of progress bars are left out.
+func LogProgress(t interface {
+	Helper()
+	Log(args ...interface{})
+}) func(jsonmessage.JSONMessage) {
+	return func(msg jsonmessage.JSONMessage) {
+		t.Helper()
+		switch {
+		case msg.Error != nil, msg.ErrorMessage != "", msg.Aux != nil, msg.Progress != nil && msg.Progress.Current > 0:
+		case msg.Stream != "":
+			t.Log(strings.TrimRight(msg.Stream, "\n"))
+		case msg.ID != "":
+			t.Log(fmt.Sprintf("%s: %s", msg.ID, msg.Status))
+		case msg.Status != "":
+			t.Log(msg.Status)
+		}
+	}
+}
+
+// progress decodes the JSON messages of a pull or build written to it and hands them to Pool.Progress. It keeps the
+// output of the current build step and the error reported within the messages.
+type progress struct {
+	pw   *io.PipeWriter
+	done chan struct{}
+
+	// set once done is closed
+	step  strings.Builder
+	trace trace
+	err   *jsonmessage.JSONError
+}
+
+// newProgress returns a progress to pass as OutputStream of a pull or build with RawJSONStream set. It has to be
+// closed once the pull or build returns.
+func (d *Pool) newProgress() *progress {
+	pr, pw := io.Pipe()
+	p := &progress{pw: pw, done: make(chan struct{})}
+	go func() {
+		defer close(p.done)
+		// unblocks the client if the stream is malformed
+		defer io.Copy(io.Discard, pr) //nolint:errcheck
+
+		dec := json.NewDecoder(pr)
+		for {
+			var msg jsonmessage.JSONMessage
+			if err := dec.Decode(&msg); err != nil {
+				return
+			}
+
+			msgs := []jsonmessage.JSONMessage{msg}
+			if msg.ID == dc.BuildKitTraceID && msg.Aux != nil {
+				status, err := dc.ParseSolveStatus(*msg.Aux)
+				if err != nil {
+					continue
+				}
+				msgs = p.trace.messages(status)
+			}
+
+			for _, msg := range msgs {
+				if d.Progress != nil {
+					d.Progress(msg)
+				}
+
+				switch {
+				case msg.Error != nil:
+					p.err = msg.Error
+				case msg.ErrorMessage != "":
+					p.err = &jsonmessage.JSONError{Message: msg.ErrorMessage}
+				case strings.HasPrefix(msg.Stream, "Step "):
+					p.step.Reset()
+					fallthrough
+				default:
+					p.step.WriteString(msg.Stream)
+				}
+			}
+		}
+	}()
+	return p
+}
+
+func (p *progress) Write(b []byte) (int, error) {
+	return p.pw.Write(b)
+}
+
+// Close waits for the messages to be decoded and returns the error reported within them, if any.
+func (p *progress) Close() error {
+	p.pw.Close()
+	<-p.done
+	if p.err == nil {
+		return nil
+	}
+	return p.err
+}
+
+// output returns the output of the build step that failed, or the last one. It must be called after Close.
+func (p *progress) output() string {
+	if p.trace.failed != "" {
+		return p.trace.failed
+	}
+	return p.step.String()
+}
+
+// trace renders the progress of BuildKit builds as messages like "docker build --progress=plain" prints them, with
+// the vertexes numbered in order of appearance.
+type trace struct {
+	vertexes map[string]*vertex
+
+	// failed is the output of the vertex that failed
+	failed string
+}
+
+type vertex struct {
+	num                int
+	name               string
+	started, completed bool
+	logs               strings.Builder
+}
+
+func (t *trace) vertex(digest string) *vertex {
+	if t.vertexes == nil {
+		t.vertexes = map[string]*vertex{}
+	}
+	v, ok := t.vertexes[digest]
+	if !ok {
+		v = &vertex{num: len(t.vertexes) + 1}
+		t.vertexes[digest] = v
+	}
+	return v
+}
+
+func (t *trace) messages(s *dc.SolveStatus) []jsonmessage.JSONMessage {
+	var msgs []jsonmessage.JSONMessage
+	stream := func(v *vertex, format string, args ...interface{}) {
+		msgs = append(msgs, jsonmessage.JSONMessage{Stream: fmt.Sprintf("#%d ", v.num) + fmt.Sprintf(format, args...) + "\n"})
+	}
+
+	for _, dv := range s.Vertexes {
+		v := t.vertex(dv.Digest)
+		v.name = dv.Name
+		if dv.Started != nil && !v.started {
+			v.started = true
+			stream(v, "%s", v.name)
+		}
+		if dv.Cached && !v.completed {
+			v.completed = true
+			stream(v, "CACHED")
+		}
+	}
+
+	for _, st := range s.Statuses {
+		v := t.vertex(st.Vertex)
+		msg := jsonmessage.JSONMessage{ID: fmt.Sprintf("#%d %s", v.num, st.ID), Status: st.Name}
+		if st.Completed != nil {
+			msg.Status = "done"
+		} else if st.Total > 0 || st.Current > 0 {
+			msg.Progress = &jsonmessage.JSONProgress{Current: st.Current, Total: st.Total}
+		}
+		msgs = append(msgs, msg)
+	}
+
+	for _, l := range s.Logs {
+		v := t.vertex(l.Vertex)
+		for _, line := range strings.SplitAfter(string(l.Data), "\n") {
+			if line == "" {
+				continue
+			}
+			v.logs.WriteString(line)
+			stream(v, "%s", strings.TrimSuffix(line, "\n"))
+		}
+	}
+
+	for _, w := range s.Warnings {
+		stream(t.vertex(w.Vertex), "WARN: %s", w.Short)
+	}
+
+	for _, dv := range s.Vertexes {
+		v := t.vertex(dv.Digest)
+		if dv.Completed == nil || v.completed {
+			continue
+		}
+		v.completed = true
+		if dv.Error == "" {
+			stream(v, "DONE")
+			continue
+		}
+		stream(v, "ERROR: %s", dv.Error)
+		if t.failed == "" {
+			t.failed = v.name + "\n" + v.logs.String()
+		}
+	}
+	return msgs
+}
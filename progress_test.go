@@ -0,0 +1,104 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package dockertest
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/ory/dockertest/v3/docker/pkg/jsonmessage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgress(t *testing.T) {
+	fake, pool := newFakePool(t)
+
+	var mu sync.Mutex
+	var msgs []jsonmessage.JSONMessage
+	pool.Progress = func(msg jsonmessage.JSONMessage) {
+		mu.Lock()
+		defer mu.Unlock()
+		msgs = append(msgs, msg)
+	}
+
+	_, err := pool.RunWithOptions(&RunOptions{Repository: "redis", Tag: "7"})
+	require.Nil(t, err)
+	mu.Lock()
+	var statuses []string
+	for _, msg := range msgs {
+		if msg.ID != "" {
+			statuses = append(statuses, msg.Status)
+		}
+		if msg.Progress != nil {
+			assert.Equal(t, int64(1024), msg.Progress.Total)
+		}
+	}
+	mu.Unlock()
+	assert.Equal(t, []string{"Pulling fs layer", "Downloading", "Downloading", "Pull complete"}, statuses)
+
+	_, err = pool.BuildAndRunWithBuildOptions(&BuildOptions{
+		DockerfileContent: "FROM golang\nRUN echo downloading\nRUN echo compiling && exit 2\nRUN echo done\n",
+	}, &RunOptions{Name: "broken-build"})
+	var buildErr *BuildError
+	require.ErrorAs(t, err, &buildErr)
+	assert.Equal(t, "broken-build", buildErr.Image)
+	assert.Contains(t, buildErr.Output, "Step 3/4 : RUN echo compiling && exit 2\n")
+	assert.Contains(t, buildErr.Output, "compiling\n")
+	assert.NotContains(t, buildErr.Output, "downloading")
+	assert.Contains(t, err.Error(), "returned a non-zero code: 2")
+	assert.Contains(t, err.Error(), "compiling")
+	assert.Empty(t, fake.Builds())
+
+	mu.Lock()
+	last := msgs[len(msgs)-1]
+	mu.Unlock()
+	require.NotNil(t, last.Error)
+	assert.Equal(t, 2, last.Error.Code)
+
+	var out bytes.Buffer
+	pool.Progress = TerminalProgress(&out, 0, false)
+	_, err = pool.RunWithOptions(&RunOptions{Repository: "postgres", Tag: "16"})
+	require.Nil(t, err)
+	assert.Contains(t, out.String(), ": Pull complete\n")
+	assert.Contains(t, out.String(), "Status: Downloaded newer image for postgres:16\n")
+	assert.NotContains(t, out.String(), "Downloading")
+
+	// progress bars are updated in place on terminals, the escape sequences fall back to ANSI for unknown ones
+	t.Setenv("TERM", "dockertest-unknown")
+	out.Reset()
+	pool.Progress = TerminalProgress(&out, 0, true)
+	_, err = pool.RunWithOptions(&RunOptions{Repository: "postgres", Tag: "17"})
+	require.Nil(t, err)
+	assert.Contains(t, out.String(), "Downloading")
+	assert.Contains(t, out.String(), "\x1b[1A")
+
+	var logged logRecorder
+	pool.Progress = LogProgress(&logged)
+	_, err = pool.BuildAndRunWithBuildOptions(&BuildOptions{
+		DockerfileContent: "FROM golang\nRUN echo logged to the test\n",
+	}, &RunOptions{Name: "logged-build"})
+	require.Nil(t, err)
+	assert.Contains(t, logged.lines(), "Step 2/2 : RUN echo logged to the test")
+}
+
+// logRecorder records what LogProgress logs.
+type logRecorder struct {
+	mu     sync.Mutex
+	logged []string
+}
+
+func (r *logRecorder) Helper() {}
+func (r *logRecorder) Log(args ...interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.logged = append(r.logged, fmt.Sprint(args...))
+}
+func (r *logRecorder) lines() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.logged...)
+}
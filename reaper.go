@@ -0,0 +1,288 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package dockertest
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	dc "github.com/ory/dockertest/v3/docker"
+)
+
+// SessionLabel is the label the reaper uses to find the containers, networks and volumes created by a pool.
+const SessionLabel = "org.ory.dockertest.session"
+
+const (
+	reaperSessionEnv       = "DOCKERTEST_REAPER_SESSION"
+	reaperEndpointEnv      = "DOCKERTEST_REAPER_ENDPOINT"
+	reaperCertPathEnv      = "DOCKERTEST_REAPER_CERT_PATH"
+	reaperSkipTLSVerifyEnv = "DOCKERTEST_REAPER_SKIP_TLS_VERIFY"
+)
+
+// reaperReady is written by the reaper once it runs and is connected to the daemon, so that StartReaper knows the
+// executable called RunReaper.
+const reaperReady = "dockertest-reaper\n"
+
+// reaperFailed starts the line the reaper writes instead of reaperReady if it cannot connect to the daemon.
+const reaperFailed = "dockertest-reaper error: "
+
+// reaperStartTimeout is how long StartReaper waits for the reaper to report that it runs.
+const reaperStartTimeout = 10 * time.Second
+
+// RunReaper runs the reaper and exits if the process was started as one by StartReaper, and returns right away
+// otherwise. The reaper is the current executable started again, so that it does not need any image or binary
+// besides the test binary itself. Binaries calling StartReaper must therefore call RunReaper before anything
+// else, usually at the beginning of TestMain:
+//
+//	func TestMain(m *testing.M) {
+//		dockertest.RunReaper()
+//		// ...
+//	}
+func RunReaper() {
+	if session := os.Getenv(reaperSessionEnv); session != "" {
+		os.Exit(runReaper(session, os.Getenv(reaperEndpointEnv), os.Getenv(reaperCertPathEnv),
+			os.Getenv(reaperSkipTLSVerifyEnv) != ""))
+	}
+}
+
+// Reaper is a watchdog process that removes every container, network and volume created by a pool once the
+// process that started it exits, even if it crashed or got killed before it could call Purge.
+type Reaper struct {
+	// Session is the value of the SessionLabel stamped on everything the pool creates.
+	Session string
+
+	pool  *Pool
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+}
+
+// StartReaper starts a reaper for the pool. From then on every container, network and volume created through the
+// pool is labelled with the reaper's session, and removed by the reaper once the current process exits.
+// The executable has to call RunReaper first thing, see RunReaper.
+// The reaper connects to the daemon with the endpoint and TLS material of the pool, and StartReaper fails if it
+// cannot.
+// Calling StartReaper again returns the reaper that is already running.
+func (d *Pool) StartReaper() (*Reaper, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.reaper != nil {
+		return d.reaper, nil
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to locate executable for reaper: %w", err)
+	}
+
+	session, err := newSessionID()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to generate reaper session: %w", err)
+	}
+
+	cmd := exec.Command(executable)
+	cmd.Env = append(os.Environ(),
+		reaperSessionEnv+"="+session,
+		reaperEndpointEnv+"="+d.Client.Endpoint(),
+		reaperCertPathEnv+"="+d.tlsPath,
+	)
+	if d.tlsSkipVerify {
+		cmd.Env = append(cmd.Env, reaperSkipTLSVerifyEnv+"=1")
+	}
+	// failures to remove the session are only reported here, as the process that started the reaper is gone
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to connect to reaper: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to connect to reaper: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("Failed to start reaper: %w", err)
+	}
+
+	// an executable that does not call RunReaper would run in full, e.g. run all tests once more
+	ready := make(chan string, 1)
+	go func() {
+		line, _ := bufio.NewReader(stdout).ReadString('\n')
+		ready <- line
+	}()
+	timer := time.NewTimer(reaperStartTimeout)
+	defer timer.Stop()
+	select {
+	case line := <-ready:
+		if line != reaperReady {
+			_ = cmd.Process.Kill()
+			_ = cmd.Wait()
+			if strings.HasPrefix(line, reaperFailed) {
+				return nil, fmt.Errorf("Failed to start reaper: %s", strings.TrimSpace(strings.TrimPrefix(line, reaperFailed)))
+			}
+			return nil, fmt.Errorf("Failed to start reaper: %s does not call dockertest.RunReaper", executable)
+		}
+	case <-timer.C:
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return nil, fmt.Errorf("Failed to start reaper: %s did not call dockertest.RunReaper within %s", executable, reaperStartTimeout)
+	}
+
+	d.reaper = &Reaper{
+		Session: session,
+		pool:    d,
+		cmd:     cmd,
+		stdin:   stdin,
+	}
+	return d.reaper, nil
+}
+
+// Close disconnects from the reaper, which then removes everything labelled with its session right away.
+// Close waits for the reaper to finish. Afterwards the pool no longer labels what it creates, until StartReaper
+// is called again.
+func (r *Reaper) Close() error {
+	r.pool.mu.Lock()
+	if r.pool.reaper == r {
+		r.pool.reaper = nil
+	}
+	r.pool.mu.Unlock()
+
+	if err := r.stdin.Close(); err != nil {
+		return err
+	}
+
+	if err := r.cmd.Wait(); err != nil {
+		return fmt.Errorf("Reaper failed to remove session %s: %w", r.Session, err)
+	}
+
+	return nil
+}
+
+// sessionLabels returns labels with the reaper's session label added, if a reaper is running.
+// The given map is never modified.
+func (d *Pool) sessionLabels(labels map[string]string) map[string]string {
+	d.mu.Lock()
+	reaper := d.reaper
+	d.mu.Unlock()
+	if reaper == nil {
+		return labels
+	}
+
+	stamped := make(map[string]string, len(labels)+1)
+	for k, v := range labels {
+		stamped[k] = v
+	}
+	stamped[SessionLabel] = reaper.Session
+	return stamped
+}
+
+func newSessionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// runReaper connects to the daemon, blocks until the parent process closes the connection, either explicitly or by
+// exiting, and then removes everything labelled with the session. It returns the process exit code.
+func runReaper(session, endpoint, certPath string, skipTLSVerify bool) int {
+	// The parent's process group may be interrupted as a whole, e.g. by pressing Ctrl+C. This is exactly when the
+	// reaper has to stay alive.
+	signal.Ignore(os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGHUP)
+
+	pool, err := newReaperPool(endpoint, certPath, skipTLSVerify)
+	if err == nil {
+		err = pool.Client.Ping()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stdout, "%sFailed to connect to %s: %s\n", reaperFailed, endpoint, strings.ReplaceAll(err.Error(), "\n", " "))
+		return 1
+	}
+	if _, err := io.WriteString(os.Stdout, reaperReady); err != nil {
+		return 1
+	}
+
+	_, _ = io.Copy(io.Discard, os.Stdin)
+
+	if err := pool.reap(context.Background(), session); err != nil {
+		fmt.Fprintf(os.Stderr, "dockertest: reaper failed to remove session %s: %s\n", session, err)
+		return 1
+	}
+	return 0
+}
+
+// newReaperPool creates a pool with the same endpoint and TLS material as the pool that started the reaper.
+func newReaperPool(endpoint, certPath string, skipTLSVerify bool) (*Pool, error) {
+	if certPath == "" {
+		client, err := dc.NewClient(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		return &Pool{Client: client}, nil
+	}
+
+	pool, err := NewTLSPool(endpoint, certPath)
+	if err != nil {
+		return nil, err
+	}
+	if skipTLSVerify {
+		pool.Client.TLSConfig.InsecureSkipVerify = true
+	}
+	return pool, nil
+}
+
+// reap removes all containers, networks and volumes labelled with session. Containers go first, as networks and
+// volumes cannot be removed while they are in use.
+func (d *Pool) reap(ctx context.Context, session string) error {
+	label := SessionLabel + "=" + session
+	var failed error
+
+	containers, err := d.Client.ListContainers(dc.ListContainersOptions{
+		All:     true,
+		Filters: map[string][]string{"label": {label}},
+		Context: ctx,
+	})
+	if err != nil {
+		return err
+	}
+	for _, c := range containers {
+		if err := d.Client.RemoveContainer(dc.RemoveContainerOptions{ID: c.ID, Force: true, RemoveVolumes: true, Context: ctx}); err != nil {
+			failed = err
+		}
+	}
+
+	networks, err := d.Client.FilteredListNetworks(dc.NetworkFilterOpts{"label": {label: true}})
+	if err != nil {
+		return err
+	}
+	for _, n := range networks {
+		if err := d.Client.RemoveNetworkWithContext(n.ID, ctx); err != nil {
+			failed = err
+		}
+	}
+
+	volumes, err := d.Client.ListVolumes(dc.ListVolumesOptions{
+		Filters: map[string][]string{"label": {label}},
+		Context: ctx,
+	})
+	if err != nil {
+		return err
+	}
+	for _, v := range volumes {
+		if err := d.Client.RemoveVolumeWithOptions(dc.RemoveVolumeOptions{Name: v.Name, Force: true, Context: ctx}); err != nil {
+			failed = err
+		}
+	}
+
+	return failed
+}
@@ -0,0 +1,110 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package dockertest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	dc "github.com/ory/dockertest/v3/docker"
+	"github.com/ory/dockertest/v3/fakedocker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReaperTLS(t *testing.T) {
+	fake := fakedocker.NewServer()
+	t.Cleanup(fake.Close)
+	secure := httptest.NewTLSServer(fake.Config.Handler)
+	t.Cleanup(secure.Close)
+
+	config := t.TempDir()
+	digest := sha256.Sum256([]byte("secure"))
+	id := hex.EncodeToString(digest[:])
+	meta := filepath.Join(config, "contexts", "meta", id)
+	require.Nil(t, os.MkdirAll(meta, 0o700))
+	require.Nil(t, os.WriteFile(filepath.Join(meta, "meta.json"),
+		[]byte(`{"Name":"secure","Endpoints":{"docker":{"Host":"`+secure.URL+`","SkipTLSVerify":true}}}`), 0o600))
+	require.Nil(t, os.MkdirAll(filepath.Join(config, "contexts", "tls", id, "docker"), 0o700))
+
+	t.Setenv("DOCKER_CONFIG", config)
+	t.Setenv("DOCKER_MACHINE_NAME", "")
+	t.Setenv("DOCKER_HOST", "")
+	t.Setenv("DOCKER_URL", "")
+	t.Setenv("DOCKER_CERT_PATH", "")
+	t.Setenv("DOCKER_CONTEXT", "secure")
+
+	pool, err := NewPool("")
+	require.Nil(t, err)
+	reaper, err := pool.StartReaper()
+	require.Nil(t, err)
+
+	network, err := pool.CreateNetwork("test-reaper-tls")
+	require.Nil(t, err)
+	info, err := pool.Client.NetworkInfo(network.Network.ID)
+	require.Nil(t, err)
+	assert.Equal(t, reaper.Session, info.Labels[SessionLabel])
+
+	require.Nil(t, reaper.Close())
+	networks, err := pool.NetworksByName("test-reaper-tls")
+	require.Nil(t, err)
+	assert.Empty(t, networks)
+}
+
+func TestReaperUnreachable(t *testing.T) {
+	gone := httptest.NewServer(nil)
+	gone.Close()
+
+	pool, err := NewPool(gone.URL)
+	require.Nil(t, err)
+	_, err = pool.StartReaper()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Failed to connect to "+gone.URL)
+}
+
+func TestReaper(t *testing.T) {
+	// Shadow pool so that the reaper only tracks what this test creates
+	pool, err := NewPool(docker)
+	require.NoError(t, err)
+
+	reaper, err := pool.StartReaper()
+	require.Nil(t, err)
+
+	network, err := pool.CreateNetwork("test-reaper")
+	require.Nil(t, err)
+	info, err := pool.Client.NetworkInfo(network.Network.ID)
+	require.Nil(t, err)
+	assert.Equal(t, reaper.Session, info.Labels[SessionLabel])
+
+	resource, err := pool.RunWithOptions(&RunOptions{
+		Repository: "alpine",
+		Tag:        "3.16",
+		Cmd:        []string{"tail", "-f", "/dev/null"},
+		Labels:     map[string]string{"my": "label"},
+	})
+	require.Nil(t, err)
+	assert.Equal(t, reaper.Session, resource.Container.Config.Labels[SessionLabel])
+	assert.Equal(t, "label", resource.Container.Config.Labels["my"])
+
+	require.Nil(t, reaper.Close())
+
+	_, err = pool.Client.InspectContainer(resource.Container.ID)
+	var noSuchContainer *dc.NoSuchContainer
+	require.ErrorAs(t, err, &noSuchContainer)
+
+	networks, err := pool.NetworksByName("test-reaper")
+	require.Nil(t, err)
+	require.Empty(t, networks)
+
+	network, err = pool.CreateNetwork("test-reaper")
+	require.Nil(t, err)
+	info, err = pool.Client.NetworkInfo(network.Network.ID)
+	require.Nil(t, err)
+	assert.NotContains(t, info.Labels, SessionLabel)
+	require.Nil(t, network.Close())
+}
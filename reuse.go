@@ -0,0 +1,144 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package dockertest
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+
+	dc "github.com/ory/dockertest/v3/docker"
+)
+
+// ReuseHashLabel is the label holding the configuration hash of containers started with RunOptions.Reuse.
+const ReuseHashLabel = "org.ory.dockertest.reuse-hash"
+
+// reuseContainer looks for a running container that was started with RunOptions.Reuse and the same configuration
+// as createOpts. It stamps the configuration hash onto createOpts, so that the container created otherwise can be
+// reused later on. Exited or dead containers with the same configuration are removed, as they are never reused and
+// would only pile up, and so is a differently configured container with the requested name, as it would prevent the
+// new one from being created.
+func (d *Pool) reuseContainer(ctx context.Context, opts *RunOptions, createOpts *dc.CreateContainerOptions) (*Resource, bool, error) {
+	hash, err := configHash(createOpts, opts.Files)
+	if err != nil {
+		return nil, false, fmt.Errorf("Failed to hash container configuration: %w", err)
+	}
+
+	labels := make(map[string]string, len(createOpts.Config.Labels)+1)
+	for k, v := range createOpts.Config.Labels {
+		labels[k] = v
+	}
+	labels[ReuseHashLabel] = hash
+	createOpts.Config.Labels = labels
+
+	containers, err := d.Client.ListContainers(dc.ListContainersOptions{
+		All:     true,
+		Filters: map[string][]string{"label": {ReuseHashLabel + "=" + hash}},
+		Context: ctx,
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("Failed to list reusable containers: %w", err)
+	}
+
+	for _, c := range containers {
+		if c.State != "exited" && c.State != "dead" {
+			continue
+		}
+		if err := d.Client.RemoveContainer(dc.RemoveContainerOptions{ID: c.ID, Force: true, RemoveVolumes: true, Context: ctx}); err != nil {
+			return nil, false, fmt.Errorf("Failed to remove stopped container %s: %w", c.ID, err)
+		}
+	}
+
+	for _, c := range containers {
+		if c.State != "running" {
+			continue
+		}
+
+		container, err := d.Client.InspectContainerWithContext(c.ID, ctx)
+		if err != nil {
+			return nil, false, err
+		}
+
+		r := &Resource{pool: d, Container: container, reuse: true, reused: true}
+		if opts.WaitFor != nil {
+			if err := opts.WaitFor.WaitUntilReady(ctx, r); err != nil {
+				return nil, false, &RunError{Phase: PhaseWait, Err: err}
+			}
+		}
+		return r, true, nil
+	}
+
+	if opts.Name == "" {
+		return nil, false, nil
+	}
+
+	// the name filter matches substrings, e.g. "db" would match "mydb-1" as well
+	stale, ok := d.ContainerByNameContext(ctx, "^/"+regexp.QuoteMeta(opts.Name)+"$")
+	if !ok || stale.Container.Name != "/"+opts.Name || stale.Container.Config == nil {
+		return nil, false, nil
+	}
+	if _, ok := stale.Container.Config.Labels[ReuseHashLabel]; !ok {
+		// not ours to remove, creating the container will fail with a name conflict
+		return nil, false, nil
+	}
+	if err := d.ForcePurgeContext(ctx, stale); err != nil {
+		return nil, false, fmt.Errorf("Failed to remove outdated container %s: %w", opts.Name, err)
+	}
+
+	return nil, false, nil
+}
+
+// configHash returns a digest of the effective configuration of the container described by createOpts, and of the
+// files written into it. Files read from the host are identified by the digest of their content and their mode, so
+// that changing them replaces the container.
+func configHash(createOpts *dc.CreateContainerOptions, files []File) (string, error) {
+	type hashedFile struct {
+		File
+		HostSum  string      `json:",omitempty"`
+		HostMode os.FileMode `json:",omitempty"`
+	}
+	hashed := make([]hashedFile, len(files))
+	for i, f := range files {
+		hashed[i].File = f
+		if f.HostPath == "" {
+			continue
+		}
+		info, err := os.Stat(f.HostPath)
+		if err != nil {
+			return "", err
+		}
+		content, err := os.ReadFile(f.HostPath)
+		if err != nil {
+			return "", err
+		}
+		sum := sha256.Sum256(content)
+		hashed[i].HostSum = hex.EncodeToString(sum[:])
+		hashed[i].HostMode = info.Mode()
+	}
+
+	// encoding/json sorts map keys, so the encoding is stable.
+	b, err := json.Marshal(struct {
+		Name             string
+		Config           *dc.Config
+		HostConfig       *dc.HostConfig
+		NetworkingConfig *dc.NetworkingConfig
+		Files            []hashedFile `json:",omitempty"`
+	}{
+		Name:             createOpts.Name,
+		Config:           createOpts.Config,
+		HostConfig:       createOpts.HostConfig,
+		NetworkingConfig: createOpts.NetworkingConfig,
+		Files:            hashed,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,89 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package dockertest
+
+import (
+	"testing"
+
+	dc "github.com/ory/dockertest/v3/docker"
+	"github.com/ory/dockertest/v3/fakedocker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunWithReuse(t *testing.T) {
+	opts := func(env ...string) *RunOptions {
+		return &RunOptions{
+			Repository: "postgres",
+			Tag:        "9.5",
+			Env:        env,
+			Cmd:        []string{"sleep", "60"},
+			Reuse:      true,
+		}
+	}
+
+	first, err := pool.RunWithOptions(opts("REUSE_TEST=" + t.Name()))
+	require.Nil(t, err)
+	defer pool.ForcePurge(first)
+	assert.False(t, first.Reused())
+
+	// purging a container started with Reuse leaves it running for the next run
+	require.Nil(t, pool.Purge(first))
+
+	second, err := pool.RunWithOptions(opts("REUSE_TEST=" + t.Name()))
+	require.Nil(t, err)
+	assert.True(t, second.Reused())
+	assert.Equal(t, first.Container.ID, second.Container.ID)
+
+	other, err := pool.RunWithOptions(opts("REUSE_TEST=" + t.Name() + "-other"))
+	require.Nil(t, err)
+	defer pool.ForcePurge(other)
+	assert.False(t, other.Reused())
+	assert.NotEqual(t, first.Container.ID, other.Container.ID)
+
+	require.Nil(t, pool.ForcePurge(second))
+	_, err = pool.Client.InspectContainer(first.Container.ID)
+	require.Error(t, err)
+}
+
+func TestRunWithReuseReplacesStale(t *testing.T) {
+	_, pool := newFakePool(t)
+	opts := func(name string, env ...string) *RunOptions {
+		return &RunOptions{Repository: "busybox", Name: name, Env: env, Reuse: true}
+	}
+
+	similar, err := pool.RunWithOptions(opts("mydb-1"))
+	require.Nil(t, err)
+	stale, err := pool.RunWithOptions(opts("db", "VERSION=1"))
+	require.Nil(t, err)
+
+	// only the container named exactly "db" is in the way
+	fresh, err := pool.RunWithOptions(opts("db", "VERSION=2"))
+	require.Nil(t, err)
+	assert.False(t, fresh.Reused())
+	_, err = pool.Client.InspectContainer(stale.Container.ID)
+	var noSuchContainer *dc.NoSuchContainer
+	require.ErrorAs(t, err, &noSuchContainer)
+	_, err = pool.Client.InspectContainer(similar.Container.ID)
+	require.Nil(t, err)
+}
+
+func TestRunWithReuseRemovesExited(t *testing.T) {
+	fake, pool := newFakePool(t)
+	fake.SetBehavior("busybox", fakedocker.Behavior{Exit: true})
+
+	for _, name := range []string{"", "exited"} {
+		opts := &RunOptions{Repository: "busybox", Name: name, Reuse: true}
+		exited, err := pool.RunWithOptions(opts)
+		require.Nil(t, err)
+
+		fresh, err := pool.RunWithOptions(opts)
+		require.Nil(t, err)
+		assert.False(t, fresh.Reused())
+		assert.NotEqual(t, exited.Container.ID, fresh.Container.ID)
+		_, ok := fake.Container(exited.Container.ID)
+		assert.False(t, ok, "exited container %q is left", name)
+		require.Nil(t, pool.ForcePurge(fresh))
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package dockertest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	dc "github.com/ory/dockertest/v3/docker"
+	"github.com/ory/dockertest/v3/docker/pkg/system"
+)
+
+// SharedLabel is the label holding the name of containers started with Pool.RunShared.
+const SharedLabel = "org.ory.dockertest.shared"
+
+// SharedResource is a container shared by all processes on this machine that ask for it by name, see Pool.RunShared.
+type SharedResource struct {
+	*Resource
+
+	// Name is the name the resource is shared under.
+	Name string
+
+	released bool
+}
+
+// sharedState is stored next to the lock file and lists the processes using a shared resource.
+type sharedState struct {
+	PIDs []int `json:"pids"`
+}
+
+var unsafeSharedName = regexp.MustCompile(`[^a-zA-Z0-9_.-]`)
+
+// RunShared starts a container that is shared under name by all processes on this machine, such as the test
+// binaries of the packages run by `go test ./...`. The first process to ask for name starts the container using
+// opts, later ones attach to it. The container is removed once the last process using it called Release.
+//
+// Processes are coordinated through a lock file in the OS temp dir, so all of them have to use the same Docker
+// daemon. Processes that exit without calling Release are noticed and no longer counted. Shared containers are not
+// removed by the reaper.
+func (d *Pool) RunShared(name string, opts *RunOptions, hcOpts ...func(*dc.HostConfig)) (*SharedResource, error) {
+	return d.RunSharedContext(context.Background(), name, opts, hcOpts...)
+}
+
+// RunSharedContext is like RunShared. The context can be used to cancel waiting for other processes as well as
+// starting the container, see RunWithOptionsContext.
+func (d *Pool) RunSharedContext(ctx context.Context, name string, opts *RunOptions, hcOpts ...func(*dc.HostConfig)) (*SharedResource, error) {
+	var r *Resource
+	err := d.withSharedState(ctx, name, func(state *sharedState) error {
+		c, err := d.sharedContainer(ctx, name)
+		if err != nil {
+			return err
+		}
+
+		if c != nil {
+			r = &Resource{pool: d, Container: c}
+			if opts.WaitFor != nil {
+				if err := opts.WaitFor.WaitUntilReady(ctx, r); err != nil {
+					return fmt.Errorf("Shared container did not become ready: %w", err)
+				}
+			}
+		} else {
+			runOpts := *opts
+			runOpts.Labels = make(map[string]string, len(opts.Labels)+1)
+			for k, v := range opts.Labels {
+				runOpts.Labels[k] = v
+			}
+			runOpts.Labels[SharedLabel] = name
+
+			r, err = d.RunWithOptionsContext(ctx, &runOpts, hcOpts...)
+			if err != nil {
+				return err
+			}
+		}
+
+		state.PIDs = append(state.PIDs, os.Getpid())
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to run shared resource %s: %w", name, err)
+	}
+
+	return &SharedResource{Resource: r, Name: name}, nil
+}
+
+// Release tells other processes that this one no longer uses the resource. The container is removed if no other
+// process uses it anymore.
+func (s *SharedResource) Release() error {
+	return s.ReleaseContext(context.Background())
+}
+
+// ReleaseContext is like Release. The context can be used to cancel waiting for other processes as well as
+// removing the container.
+func (s *SharedResource) ReleaseContext(ctx context.Context) error {
+	if s.released {
+		return nil
+	}
+
+	pid := os.Getpid()
+	err := s.pool.withSharedState(ctx, s.Name, func(state *sharedState) error {
+		for i, p := range state.PIDs {
+			if p == pid {
+				state.PIDs = append(state.PIDs[:i], state.PIDs[i+1:]...)
+				break
+			}
+		}
+
+		if len(state.PIDs) > 0 {
+			return nil
+		}
+		return s.pool.ForcePurgeContext(ctx, s.Resource)
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to release shared resource %s: %w", s.Name, err)
+	}
+
+	s.released = true
+	return nil
+}
+
+// Close is an alias for Release.
+func (s *SharedResource) Close() error {
+	return s.Release()
+}
+
+// sharedContainer returns the running container shared under name, or nil if there is none. Containers left behind
+// in any other state are removed.
+func (d *Pool) sharedContainer(ctx context.Context, name string) (*dc.Container, error) {
+	containers, err := d.Client.ListContainers(dc.ListContainersOptions{
+		All:     true,
+		Filters: map[string][]string{"label": {SharedLabel + "=" + name}},
+		Context: ctx,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var found *dc.Container
+	for _, c := range containers {
+		if found == nil && c.State == "running" {
+			found, err = d.Client.InspectContainerWithContext(c.ID, ctx)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if err := d.Client.RemoveContainer(dc.RemoveContainerOptions{ID: c.ID, Force: true, RemoveVolumes: true, Context: ctx}); err != nil {
+			return nil, fmt.Errorf("Failed to remove stale shared container %s: %w", c.ID, err)
+		}
+	}
+
+	return found, nil
+}
+
+// withSharedState locks the state of the resource shared under name, calls update with it, and stores the state
+// again unless update fails. Processes that are no longer alive are removed from the state before update is called.
+func (d *Pool) withSharedState(ctx context.Context, name string, update func(state *sharedState) error) error {
+	base := filepath.Join(os.TempDir(), "dockertest-shared-"+unsafeSharedName.ReplaceAllString(name, "_"))
+
+	lock, err := os.OpenFile(base+".lock", os.O_RDWR|os.O_CREATE, 0o666)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	for {
+		locked, err := tryLockFile(lock)
+		if err != nil {
+			return fmt.Errorf("Failed to lock %s: %w", lock.Name(), err)
+		}
+		if locked {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	defer unlockFile(lock)
+
+	var state sharedState
+	b, err := os.ReadFile(base + ".json")
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if len(b) > 0 {
+		if err := json.Unmarshal(b, &state); err != nil {
+			return fmt.Errorf("Failed to decode %s.json: %w", base, err)
+		}
+	}
+
+	alive := state.PIDs[:0]
+	for _, pid := range state.PIDs {
+		if system.IsProcessAlive(pid) {
+			alive = append(alive, pid)
+		}
+	}
+	state.PIDs = alive
+
+	if err := update(&state); err != nil {
+		return err
+	}
+
+	b, err = json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(base+".json", b, 0o666)
+}
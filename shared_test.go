@@ -0,0 +1,45 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package dockertest
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunShared(t *testing.T) {
+	name := fmt.Sprintf("%s-%d", t.Name(), time.Now().UnixNano())
+	opts := &RunOptions{
+		Repository: "postgres",
+		Tag:        "9.5",
+		Cmd:        []string{"sleep", "60"},
+	}
+
+	var wg sync.WaitGroup
+	shared := make([]*SharedResource, 2)
+	errs := make([]error, 2)
+	for i := range shared {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			shared[i], errs[i] = pool.RunShared(name, opts)
+		}(i)
+	}
+	wg.Wait()
+	require.Nil(t, errs[0])
+	require.Nil(t, errs[1])
+	require.Equal(t, shared[0].Container.ID, shared[1].Container.ID)
+
+	require.Nil(t, shared[0].Release())
+	_, err := pool.Client.InspectContainer(shared[1].Container.ID)
+	require.Nil(t, err, "container must stay while it is still used")
+
+	require.Nil(t, shared[1].Release())
+	_, err = pool.Client.InspectContainer(shared[1].Container.ID)
+	require.Error(t, err)
+}
@@ -0,0 +1,322 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package dockertest
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	dc "github.com/ory/dockertest/v3/docker"
+)
+
+// StatsSample is the resource usage of a container at a point in time, computed the way docker stats does.
+type StatsSample struct {
+	Time time.Time `json:"time"`
+
+	CPUPercent float64 `json:"cpu_percent"`
+
+	// MemoryUsage is the memory used by the container in bytes, without the page cache that can be reclaimed.
+	MemoryUsage   uint64  `json:"memory_usage"`
+	MemoryLimit   uint64  `json:"memory_limit"`
+	MemoryPercent float64 `json:"memory_percent"`
+
+	// BlockRead and BlockWrite are the bytes read from and written to block devices since the previous sample.
+	BlockRead  uint64 `json:"block_read"`
+	BlockWrite uint64 `json:"block_write"`
+
+	// NetworkRx and NetworkTx are the bytes received and sent on all networks since the previous sample.
+	NetworkRx uint64 `json:"network_rx"`
+	NetworkTx uint64 `json:"network_tx"`
+
+	PIDs uint64 `json:"pids"`
+}
+
+// Summary describes the values a metric took over the samples of a StatsRecorder.
+type Summary struct {
+	Count int
+	Min   float64
+	Max   float64
+	Mean  float64
+	Sum   float64
+
+	sorted []float64
+}
+
+// Percentile returns the value below which p percent of the values fall, using the nearest-rank method, e.g.
+// Percentile(95). It returns 0 if there are no values.
+func (s Summary) Percentile(p float64) float64 {
+	if len(s.sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(s.sorted))))
+	if rank < 1 {
+		rank = 1
+	} else if rank > len(s.sorted) {
+		rank = len(s.sorted)
+	}
+	return s.sorted[rank-1]
+}
+
+func summarize(values []float64) Summary {
+	s := Summary{Count: len(values), sorted: append([]float64{}, values...)}
+	if len(values) == 0 {
+		return s
+	}
+	sort.Float64s(s.sorted)
+	s.Min, s.Max = s.sorted[0], s.sorted[len(s.sorted)-1]
+	for _, v := range values {
+		s.Sum += v
+	}
+	s.Mean = s.Sum / float64(len(values))
+	return s
+}
+
+// StatsSummary summarizes every metric of the samples of a StatsRecorder. The summaries of BlockRead, BlockWrite,
+// NetworkRx and NetworkTx are over the bytes transferred between samples, so their Sum is the total.
+type StatsSummary struct {
+	CPUPercent    Summary
+	MemoryUsage   Summary
+	MemoryPercent Summary
+	BlockRead     Summary
+	BlockWrite    Summary
+	NetworkRx     Summary
+	NetworkTx     Summary
+}
+
+// StatsRecorder samples the resource usage of a container in the background, see Resource.StatsRecorder.
+type StatsRecorder struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu      sync.Mutex
+	samples []StatsSample
+	err     error
+}
+
+// StatsRecorder starts sampling the resource usage of the container every interval until Stop is called, the
+// container stops, or ctx is done. Docker reports the statistics about once a second, so shorter intervals record
+// every report. The first report is the baseline of the deltas and is not recorded itself.
+//
+//	rec := resource.StatsRecorder(ctx, time.Second)
+//	// run the load test
+//	require.NoError(t, rec.Stop())
+//	require.Less(t, rec.Summary().MemoryUsage.Max, float64(300<<20))
+func (r *Resource) StatsRecorder(ctx context.Context, interval time.Duration) *StatsRecorder {
+	ctx, cancel := context.WithCancel(ctx)
+	rec := &StatsRecorder{cancel: cancel, done: make(chan struct{})}
+
+	stats := make(chan *dc.Stats)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- r.pool.Client.Stats(dc.StatsOptions{
+			ID:      r.Container.ID,
+			Stats:   stats,
+			Stream:  true,
+			Context: ctx,
+		})
+	}()
+
+	go func() {
+		defer close(rec.done)
+
+		var prev *dc.Stats
+		for s := range stats {
+			if prev != nil && s.Read.Before(prev.Read.Add(interval)) {
+				continue
+			}
+			if prev != nil {
+				rec.mu.Lock()
+				rec.samples = append(rec.samples, newStatsSample(prev, s))
+				rec.mu.Unlock()
+			}
+			prev = s
+		}
+
+		if err := <-errs; err != nil && ctx.Err() == nil {
+			rec.mu.Lock()
+			rec.err = fmt.Errorf("Failed to read stats of container %s: %w", r.Container.ID, err)
+			rec.mu.Unlock()
+		}
+	}()
+
+	return rec
+}
+
+// Stop stops sampling and returns the error that stopped it before, if any.
+func (rec *StatsRecorder) Stop() error {
+	rec.cancel()
+	<-rec.done
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return rec.err
+}
+
+// Samples returns the samples recorded so far.
+func (rec *StatsRecorder) Samples() []StatsSample {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return append([]StatsSample{}, rec.samples...)
+}
+
+// Summary summarizes the samples recorded so far.
+func (rec *StatsRecorder) Summary() StatsSummary {
+	samples := rec.Samples()
+	metric := func(f func(s StatsSample) float64) Summary {
+		values := make([]float64, len(samples))
+		for i, s := range samples {
+			values[i] = f(s)
+		}
+		return summarize(values)
+	}
+
+	return StatsSummary{
+		CPUPercent:    metric(func(s StatsSample) float64 { return s.CPUPercent }),
+		MemoryUsage:   metric(func(s StatsSample) float64 { return float64(s.MemoryUsage) }),
+		MemoryPercent: metric(func(s StatsSample) float64 { return s.MemoryPercent }),
+		BlockRead:     metric(func(s StatsSample) float64 { return float64(s.BlockRead) }),
+		BlockWrite:    metric(func(s StatsSample) float64 { return float64(s.BlockWrite) }),
+		NetworkRx:     metric(func(s StatsSample) float64 { return float64(s.NetworkRx) }),
+		NetworkTx:     metric(func(s StatsSample) float64 { return float64(s.NetworkTx) }),
+	}
+}
+
+// WriteJSON writes the samples recorded so far to w as a JSON array.
+func (rec *StatsRecorder) WriteJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(rec.Samples())
+}
+
+// WriteCSV writes the samples recorded so far to w as CSV, with a header row naming the columns like the JSON
+// fields of StatsSample.
+func (rec *StatsRecorder) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"time", "cpu_percent", "memory_usage", "memory_limit", "memory_percent",
+		"block_read", "block_write", "network_rx", "network_tx", "pids"})
+	for _, s := range rec.Samples() {
+		_ = cw.Write([]string{
+			s.Time.Format(time.RFC3339Nano),
+			strconv.FormatFloat(s.CPUPercent, 'f', 2, 64),
+			strconv.FormatUint(s.MemoryUsage, 10),
+			strconv.FormatUint(s.MemoryLimit, 10),
+			strconv.FormatFloat(s.MemoryPercent, 'f', 2, 64),
+			strconv.FormatUint(s.BlockRead, 10),
+			strconv.FormatUint(s.BlockWrite, 10),
+			strconv.FormatUint(s.NetworkRx, 10),
+			strconv.FormatUint(s.NetworkTx, 10),
+			strconv.FormatUint(s.PIDs, 10),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// newStatsSample computes the sample of s, with the block I/O and network deltas since prev.
+func newStatsSample(prev, s *dc.Stats) StatsSample {
+	sample := StatsSample{
+		Time:        s.Read,
+		CPUPercent:  cpuPercent(s),
+		MemoryUsage: memoryUsage(s),
+		MemoryLimit: s.MemoryStats.Limit,
+		PIDs:        s.PidsStats.Current,
+	}
+	if sample.MemoryLimit != 0 {
+		sample.MemoryPercent = float64(sample.MemoryUsage) / float64(sample.MemoryLimit) * 100
+	}
+
+	read, write := blockIO(s)
+	prevRead, prevWrite := blockIO(prev)
+	sample.BlockRead, sample.BlockWrite = delta(prevRead, read), delta(prevWrite, write)
+
+	rx, tx := networkIO(s)
+	prevRx, prevTx := networkIO(prev)
+	sample.NetworkRx, sample.NetworkTx = delta(prevRx, rx), delta(prevTx, tx)
+	return sample
+}
+
+// cpuPercent computes the CPU usage like docker stats: relative to the capacity of all online CPUs on Linux, and to
+// the capacity of the processors of the container on Windows.
+func cpuPercent(s *dc.Stats) float64 {
+	cpuDelta := float64(s.CPUStats.CPUUsage.TotalUsage) - float64(s.PreCPUStats.CPUUsage.TotalUsage)
+
+	if s.NumProcs > 0 {
+		// Windows reports the usage in 100ns intervals
+		possible := float64(s.Read.Sub(s.PreRead).Nanoseconds()) / 100 * float64(s.NumProcs)
+		if possible <= 0 || cpuDelta <= 0 {
+			return 0
+		}
+		return cpuDelta / possible * 100
+	}
+
+	systemDelta := float64(s.CPUStats.SystemCPUUsage) - float64(s.PreCPUStats.SystemCPUUsage)
+	onlineCPUs := float64(s.CPUStats.OnlineCPUs)
+	if onlineCPUs == 0 {
+		onlineCPUs = float64(len(s.CPUStats.CPUUsage.PercpuUsage))
+	}
+	if systemDelta <= 0 || cpuDelta <= 0 {
+		return 0
+	}
+	return cpuDelta / systemDelta * onlineCPUs * 100
+}
+
+// memoryUsage computes the memory usage like docker stats, which leaves out the inactive page cache.
+func memoryUsage(s *dc.Stats) uint64 {
+	mem := s.MemoryStats
+	if mem.PrivateWorkingSet > 0 {
+		// Windows
+		return mem.PrivateWorkingSet
+	}
+	if v := mem.Stats.TotalInactiveFile; v > 0 && v < mem.Usage {
+		// cgroup v1
+		return mem.Usage - v
+	}
+	if v := mem.Stats.InactiveFile; v < mem.Usage {
+		// cgroup v2
+		return mem.Usage - v
+	}
+	return mem.Usage
+}
+
+// blockIO returns the bytes read from and written to block devices since the container started.
+func blockIO(s *dc.Stats) (read, write uint64) {
+	for _, e := range s.BlkioStats.IOServiceBytesRecursive {
+		switch strings.ToLower(e.Op) {
+		case "read":
+			read += e.Value
+		case "write":
+			write += e.Value
+		}
+	}
+	if read == 0 && write == 0 {
+		// Windows
+		read, write = s.StorageStats.ReadSizeBytes, s.StorageStats.WriteSizeBytes
+	}
+	return read, write
+}
+
+// networkIO returns the bytes received and sent on all networks of the container.
+func networkIO(s *dc.Stats) (rx, tx uint64) {
+	for _, n := range s.Networks {
+		rx += n.RxBytes
+		tx += n.TxBytes
+	}
+	return rx, tx
+}
+
+// delta returns the increase from prev to cur of a counter, which restarts from 0 if cur is less than prev, e.g.
+// because a network was disconnected.
+func delta(prev, cur uint64) uint64 {
+	if cur < prev {
+		return cur
+	}
+	return cur - prev
+}
@@ -0,0 +1,76 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package dockertest
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	dc "github.com/ory/dockertest/v3/docker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsRecorder(t *testing.T) {
+	fake, pool := newFakePool(t)
+
+	resource, err := pool.Run("busybox", "latest", nil)
+	require.Nil(t, err)
+
+	start := time.Now().UTC()
+	sample := func(i int, cpu, system, memory, read, rx uint64) dc.Stats {
+		var s dc.Stats
+		s.Read = start.Add(time.Duration(i) * 500 * time.Millisecond)
+		s.CPUStats.CPUUsage.TotalUsage = cpu
+		s.CPUStats.SystemCPUUsage = system
+		s.CPUStats.OnlineCPUs = 2
+		s.MemoryStats.Usage = memory
+		s.MemoryStats.Stats.InactiveFile = 10 << 20
+		s.MemoryStats.Limit = 1 << 30
+		s.BlkioStats.IOServiceBytesRecursive = []dc.BlkioStatsEntry{{Op: "read", Value: read}, {Op: "write", Value: 1}}
+		s.Networks = map[string]dc.NetworkStats{"eth0": {RxBytes: rx}}
+		return s
+	}
+
+	rec := resource.StatsRecorder(context.Background(), time.Second)
+	require.Nil(t, fake.AddStats(resource.Container.ID,
+		sample(0, 0, 0, 100<<20, 0, 0),
+		sample(1, 100, 1000, 500<<20, 0, 0), // within the interval, only used for the deltas
+		sample(2, 500, 2000, 200<<20, 4096, 1000),
+		sample(4, 1000, 3000, 310<<20, 8192, 3000),
+	))
+	require.Eventually(t, func() bool { return len(rec.Samples()) == 2 }, 5*time.Second, 10*time.Millisecond)
+	require.Nil(t, fake.Exit(resource.Container.ID, 0))
+	require.Nil(t, rec.Stop())
+
+	samples := rec.Samples()
+	require.Len(t, samples, 2)
+	assert.InDelta(t, 80, samples[0].CPUPercent, 0.001)
+	assert.Equal(t, uint64(190<<20), samples[0].MemoryUsage)
+	assert.Equal(t, uint64(4096), samples[0].BlockRead)
+	assert.Equal(t, uint64(0), samples[0].BlockWrite)
+	assert.Equal(t, uint64(1000), samples[0].NetworkRx)
+	assert.InDelta(t, 100, samples[1].CPUPercent, 0.001)
+	assert.Equal(t, uint64(2000), samples[1].NetworkRx)
+
+	summary := rec.Summary()
+	assert.Equal(t, 2, summary.MemoryUsage.Count)
+	assert.Equal(t, float64(300<<20), summary.MemoryUsage.Max)
+	assert.Equal(t, float64(190<<20), summary.MemoryUsage.Min)
+	assert.Equal(t, float64(190<<20), summary.MemoryUsage.Percentile(50))
+	assert.Equal(t, float64(8192), summary.BlockRead.Sum)
+	assert.InDelta(t, 90, summary.CPUPercent.Mean, 0.001)
+
+	var csvOut, jsonOut bytes.Buffer
+	require.Nil(t, rec.WriteCSV(&csvOut))
+	lines := strings.Split(strings.TrimSpace(csvOut.String()), "\n")
+	require.Len(t, lines, 3)
+	assert.True(t, strings.HasPrefix(lines[0], "time,cpu_percent,memory_usage"))
+	assert.Contains(t, lines[1], ",80.00,199229440,")
+	require.Nil(t, rec.WriteJSON(&jsonOut))
+	assert.Contains(t, jsonOut.String(), `"memory_usage":314572800`)
+}
@@ -0,0 +1,187 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package dockertest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	dc "github.com/ory/dockertest/v3/docker"
+)
+
+// DefaultLogTail is the number of log lines RunT reports for a container when the test that started it fails.
+const DefaultLogTail = 100
+
+// LogDirEnv is the environment variable RunT reads the directory to write the output of containers to from, if
+// Pool.LogDir is not set.
+const LogDirEnv = "DOCKERTEST_LOG_DIR"
+
+// NewPoolT is like NewPool, but fails the test instead of returning an error.
+func NewPoolT(t testing.TB, endpoint string) *Pool {
+	t.Helper()
+
+	pool, err := NewPool(endpoint)
+	if err != nil {
+		t.Fatalf("Could not construct pool: %s", err)
+	}
+	return pool
+}
+
+// RunT starts a container on a pool connected to the default endpoint, see Pool.RunT.
+func RunT(t testing.TB, opts *RunOptions, hcOpts ...func(*dc.HostConfig)) *Resource {
+	t.Helper()
+	return NewPoolT(t, "").RunT(t, opts, hcOpts...)
+}
+
+// RunT is like RunWithOptions, but fails the test instead of returning an error, and removes the container once
+// the test and all its subtests have completed.
+//
+// If the test failed, the last DefaultLogTail lines of the container's output, its state and its exit code are
+// logged before the container is removed. With go test -v the container's output is logged while the test runs.
+//
+// If Pool.LogDir or the DOCKERTEST_LOG_DIR environment variable is set, the container's output is also written to
+// <dir>/<test name>/<container name>.log, e.g. to keep it as an artifact of a CI run.
+func (d *Pool) RunT(t testing.TB, opts *RunOptions, hcOpts ...func(*dc.HostConfig)) *Resource {
+	t.Helper()
+
+	r, err := d.RunWithOptions(opts, hcOpts...)
+	if err != nil {
+		t.Fatalf("Could not start resource: %s", err)
+	}
+
+	stopStreaming := func() {}
+	if dir := d.logDir(); testing.Verbose() || dir != "" {
+		stopStreaming = r.streamLogs(t, testing.Verbose(), dir)
+	}
+
+	t.Cleanup(func() {
+		stopStreaming()
+
+		if t.Failed() {
+			r.logFailure(t, !testing.Verbose())
+		}
+
+		if err := d.Purge(r); err != nil {
+			t.Errorf("Could not purge resource: %s", err)
+		}
+	})
+
+	return r
+}
+
+// logDir returns the directory RunT writes the output of containers to, or an empty string.
+func (d *Pool) logDir() string {
+	if d.LogDir != "" {
+		return d.LogDir
+	}
+	return os.Getenv(LogDirEnv)
+}
+
+// streamLogs logs the container's output line by line if verbose is set, and writes it to a file in dir unless dir
+// is empty, until the returned function is called.
+func (r *Resource) streamLogs(t testing.TB, verbose bool, dir string) (stop func()) {
+	var f *os.File
+	if dir != "" {
+		var err error
+		if f, err = createLogFile(dir, t.Name(), r.Container.Name); err != nil {
+			t.Logf("Could not create log file for container %s: %s", r.Container.Name, err)
+			if !verbose {
+				return func() {}
+			}
+		}
+	}
+
+	var last time.Time
+	handle := func(l Line) {
+		last = l.Time
+		if verbose {
+			t.Logf("%s: %s", r.Container.Name, l.Text)
+		}
+		if f != nil {
+			fmt.Fprintf(f, "%s %s %s\n", l.Time.Format(time.RFC3339Nano), l.Stream, l.Text)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_ = r.FollowLogs(ctx, handle)
+	}()
+
+	return func() {
+		cancel()
+		// t.Log must not be called once the test has completed.
+		wg.Wait()
+
+		// the stream may not have caught up with the container yet, so the rest of its output is read once more
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = r.readLogs(ctx, false, func(l Line) {
+			if l.Time.After(last) {
+				handle(l)
+			}
+		})
+
+		if f != nil {
+			_ = f.Close()
+		}
+	}
+}
+
+var unsafePathChars = regexp.MustCompile(`[^\w.-]+`)
+
+// createLogFile creates the file the output of a container is written to, <dir>/<test name>/<container name>.log.
+// Subtests get nested directories.
+func createLogFile(dir, testName, containerName string) (*os.File, error) {
+	segments := strings.Split(testName, "/")
+	for i, segment := range segments {
+		segments[i] = unsafePathChars.ReplaceAllString(segment, "_")
+	}
+	testDir := filepath.Join(append([]string{dir}, segments...)...)
+	if err := os.MkdirAll(testDir, 0o755); err != nil {
+		return nil, err
+	}
+	name := unsafePathChars.ReplaceAllString(strings.TrimPrefix(containerName, "/"), "_")
+	return os.Create(filepath.Join(testDir, name+".log"))
+}
+
+// logFailure logs the container's state and exit code, and its last DefaultLogTail lines of output if withLogs is set.
+func (r *Resource) logFailure(t testing.TB, withLogs bool) {
+	c, err := r.pool.Client.InspectContainer(r.Container.ID)
+	if err != nil {
+		t.Logf("Could not inspect container %s: %s", r.Container.ID, err)
+		return
+	}
+
+	if withLogs {
+		var out bytes.Buffer
+		err := r.pool.Client.Logs(dc.LogsOptions{
+			Container:    c.ID,
+			OutputStream: &out,
+			ErrorStream:  &out,
+			Stdout:       true,
+			Stderr:       true,
+			Tail:         strconv.Itoa(DefaultLogTail),
+			RawTerminal:  c.Config != nil && c.Config.Tty,
+		})
+		if err != nil {
+			t.Logf("Could not read logs of container %s: %s", c.Name, err)
+		} else {
+			t.Logf("Last %d log lines of container %s:\n%s", DefaultLogTail, c.Name, out.String())
+		}
+	}
+
+	t.Logf("Container %s is %s, exit code %d", c.Name, c.State.StateString(), c.State.ExitCode)
+}
@@ -0,0 +1,86 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package dockertest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ory/dockertest/v3/fakedocker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingT records what RunT logs and pretends the test failed.
+type failingT struct {
+	testing.TB
+	logs     []string
+	cleanups []func()
+	mu       sync.Mutex
+}
+
+func (t *failingT) Helper()      {}
+func (t *failingT) Failed() bool { return true }
+func (t *failingT) Cleanup(f func()) {
+	t.cleanups = append(t.cleanups, f)
+}
+func (t *failingT) Logf(format string, args ...interface{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.logs = append(t.logs, fmt.Sprintf(format, args...))
+}
+
+func TestRunT(t *testing.T) {
+	fake, pool := newFakePool(t)
+	var out strings.Builder
+	for i := 1; i <= DefaultLogTail+5; i++ {
+		fmt.Fprintf(&out, "line %d\n", i)
+	}
+	fake.SetBehavior("busybox", fakedocker.Behavior{Stdout: out.String(), Exit: true, ExitCode: 3})
+
+	r := pool.RunT(t, &RunOptions{Repository: "busybox", Name: "passing"})
+	_, ok := fake.Container(r.Container.ID)
+	require.True(t, ok)
+
+	ft := &failingT{TB: t}
+	failed := pool.RunT(ft, &RunOptions{Repository: "busybox", Name: "failing"})
+	require.Len(t, ft.cleanups, 1)
+	ft.cleanups[0]()
+
+	if !testing.Verbose() {
+		// with go test -v the output is logged while the container runs instead
+		var tail strings.Builder
+		for i := 6; i <= DefaultLogTail+5; i++ {
+			fmt.Fprintf(&tail, "line %d\n", i)
+		}
+		assert.Contains(t, ft.logs, fmt.Sprintf("Last %d log lines of container /failing:\n%s", DefaultLogTail, tail.String()))
+	}
+	assert.Contains(t, ft.logs, "Container /failing is exited, exit code 3")
+
+	_, ok = fake.Container(failed.Container.ID)
+	require.False(t, ok)
+}
+
+func TestRunTLogDir(t *testing.T) {
+	fake, pool := newFakePool(t)
+	fake.SetBehavior("busybox", fakedocker.Behavior{Stdout: "hello\n", Stderr: "oops\n"})
+	pool.LogDir = t.TempDir()
+
+	t.Run("sub test", func(t *testing.T) {
+		resource := pool.RunT(t, &RunOptions{Repository: "busybox", Name: "greeter"})
+		require.Nil(t, fake.Print(resource.Container.ID, "bye\n", ""))
+	})
+
+	out, err := os.ReadFile(filepath.Join(pool.LogDir, "TestRunTLogDir", "sub_test", "greeter.log"))
+	require.Nil(t, err)
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	require.Len(t, lines, 3)
+	assert.Regexp(t, `^\S+ stdout hello$`, lines[0])
+	assert.Regexp(t, `^\S+ stderr oops$`, lines[1])
+	assert.Regexp(t, `^\S+ stdout bye$`, lines[2])
+}
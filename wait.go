@@ -0,0 +1,260 @@
+// Copyright © 2023 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package dockertest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+// WaitStrategy decides when a started container is ready to be used. RunWithOptions runs the strategy set in
+// RunOptions.WaitFor before it returns the resource.
+type WaitStrategy interface {
+	// WaitUntilReady blocks until the resource is ready, or returns an error once it gives up or ctx is done.
+	WaitUntilReady(ctx context.Context, r *Resource) error
+}
+
+// WaitStrategyFunc is an adapter to use an ordinary function as a WaitStrategy.
+type WaitStrategyFunc func(ctx context.Context, r *Resource) error
+
+// WaitUntilReady calls f(ctx, r).
+func (f WaitStrategyFunc) WaitUntilReady(ctx context.Context, r *Resource) error {
+	return f(ctx, r)
+}
+
+// retryUntilReady retries op with the pool's backoff (see Pool.Retry) and, if it gives up, reports the last error
+// returned by op along with the reason for giving up.
+func retryUntilReady(ctx context.Context, r *Resource, op func(ctx context.Context) error) error {
+	var last error
+	err := r.pool.RetryContext(ctx, func() error {
+		last = op(ctx)
+		return last
+	})
+	if err != nil && last != nil && !errors.Is(err, last) {
+		return fmt.Errorf("%w: %s", err, last)
+	}
+	return err
+}
+
+// LogStrategy waits until the container's output matches Pattern at least Occurrences times.
+type LogStrategy struct {
+	Pattern     *regexp.Regexp
+	Occurrences int
+}
+
+// ForLog returns a strategy that waits until the container's output matches pattern at least occurrences times.
+// Each line is matched on its own, see Resource.WaitForLog.
+//
+//	ForLog(regexp.MustCompile("database system is ready to accept connections"), 2)
+func ForLog(pattern *regexp.Regexp, occurrences int) *LogStrategy {
+	return &LogStrategy{Pattern: pattern, Occurrences: occurrences}
+}
+
+// WaitUntilReady implements WaitStrategy. It gives up once the pool's MaxWait is exceeded, or the container stops.
+func (s *LogStrategy) WaitUntilReady(ctx context.Context, r *Resource) error {
+	ctx, cancel := context.WithTimeout(ctx, r.pool.maxWait())
+	defer cancel()
+	return r.WaitForLog(ctx, s.Pattern, s.Occurrences)
+}
+
+// PortStrategy waits until the published Port (e.g. "5432/tcp") accepts TCP connections.
+type PortStrategy struct {
+	Port string
+}
+
+// ForPort returns a strategy that waits until the published port (e.g. "5432/tcp") accepts TCP connections.
+func ForPort(port string) *PortStrategy {
+	return &PortStrategy{Port: port}
+}
+
+// WaitUntilReady implements WaitStrategy.
+func (s *PortStrategy) WaitUntilReady(ctx context.Context, r *Resource) error {
+	return retryUntilReady(ctx, r, func(ctx context.Context) error {
+		address := r.GetHostPort(s.Port)
+		if address == "" {
+			return backoff.Permanent(fmt.Errorf("port %s is not published", s.Port))
+		}
+
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", address)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	})
+}
+
+// HTTPStrategy waits until a GET request to Path on the published Port returns StatusCode and, if set, a body
+// matching Body.
+type HTTPStrategy struct {
+	Port       string
+	Path       string
+	StatusCode int
+	Body       *regexp.Regexp
+
+	// Client is used to send the requests, http.DefaultClient if nil.
+	Client *http.Client
+}
+
+// ForHTTP returns a strategy that waits until a GET request to path on the published port (e.g. "80/tcp") returns
+// 200 OK. Set StatusCode and Body on the returned strategy to expect something else.
+func ForHTTP(port, path string) *HTTPStrategy {
+	return &HTTPStrategy{Port: port, Path: path, StatusCode: http.StatusOK}
+}
+
+// WaitUntilReady implements WaitStrategy.
+func (s *HTTPStrategy) WaitUntilReady(ctx context.Context, r *Resource) error {
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return retryUntilReady(ctx, r, func(ctx context.Context) error {
+		address := r.GetHostPort(s.Port)
+		if address == "" {
+			return backoff.Permanent(fmt.Errorf("port %s is not published", s.Port))
+		}
+
+		url := "http://" + address + "/" + strings.TrimPrefix(s.Path, "/")
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return backoff.Permanent(err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if s.StatusCode != 0 && resp.StatusCode != s.StatusCode {
+			return fmt.Errorf("%s returned status %d, expected %d", url, resp.StatusCode, s.StatusCode)
+		}
+		if s.Body != nil {
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				return err
+			}
+			if !s.Body.Match(body) {
+				return fmt.Errorf("%s returned a body not matching %q", url, s.Body)
+			}
+		}
+		return nil
+	})
+}
+
+// ExecStrategy waits until Cmd, executed within the container, exits with code 0.
+type ExecStrategy struct {
+	Cmd []string
+}
+
+// ForExec returns a strategy that waits until cmd, executed within the container, exits with code 0.
+//
+//	ForExec("pg_isready", "-U", "postgres")
+func ForExec(cmd ...string) *ExecStrategy {
+	return &ExecStrategy{Cmd: cmd}
+}
+
+// WaitUntilReady implements WaitStrategy.
+func (s *ExecStrategy) WaitUntilReady(ctx context.Context, r *Resource) error {
+	return retryUntilReady(ctx, r, func(ctx context.Context) error {
+		exitCode, err := r.ExecContext(ctx, s.Cmd, ExecOptions{})
+		if err != nil {
+			return err
+		}
+		if exitCode != 0 {
+			return fmt.Errorf("%s exited with code %d", strings.Join(s.Cmd, " "), exitCode)
+		}
+		return nil
+	})
+}
+
+// HealthStrategy waits until the Docker HEALTHCHECK of the container reports it as healthy.
+type HealthStrategy struct{}
+
+// ForHealthy returns a strategy that waits until the Docker HEALTHCHECK of the container reports it as healthy.
+// The image or RunOptions.Healthcheck have to define a healthcheck. Unlike Resource.WaitHealthy, it keeps waiting
+// while the container is unhealthy, until the pool's MaxWait is exceeded.
+func ForHealthy() *HealthStrategy {
+	return &HealthStrategy{}
+}
+
+// WaitUntilReady implements WaitStrategy.
+func (s *HealthStrategy) WaitUntilReady(ctx context.Context, r *Resource) error {
+	return retryUntilReady(ctx, r, func(ctx context.Context) error {
+		c, err := r.pool.Client.InspectContainerWithContext(r.Container.ID, ctx)
+		if err != nil {
+			return err
+		}
+
+		switch c.State.Health.Status {
+		case "healthy":
+			return nil
+		case "":
+			return backoff.Permanent(errors.New("container has no healthcheck"))
+		default:
+			return fmt.Errorf("container is %s", c.State.Health.Status)
+		}
+	})
+}
+
+// All returns a strategy that waits until all of the given strategies are satisfied, one after another.
+func All(strategies ...WaitStrategy) WaitStrategy {
+	return WaitStrategyFunc(func(ctx context.Context, r *Resource) error {
+		for _, s := range strategies {
+			if err := s.WaitUntilReady(ctx, r); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Any returns a strategy that waits until one of the given strategies is satisfied. The strategies run
+// concurrently, and the others are cancelled as soon as one of them succeeds.
+func Any(strategies ...WaitStrategy) WaitStrategy {
+	return WaitStrategyFunc(func(ctx context.Context, r *Resource) error {
+		if len(strategies) == 0 {
+			return nil
+		}
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		errs := make(chan error, len(strategies))
+		for _, s := range strategies {
+			go func(s WaitStrategy) {
+				errs <- s.WaitUntilReady(ctx, r)
+			}(s)
+		}
+
+		var msgs []string
+		for range strategies {
+			err := <-errs
+			if err == nil {
+				return nil
+			}
+			msgs = append(msgs, err.Error())
+		}
+		return fmt.Errorf("no wait strategy succeeded: %s", strings.Join(msgs, "; "))
+	})
+}
+
+// WithTimeout returns a strategy that gives up on s after timeout, independently of any other strategy it is
+// composed with.
+func WithTimeout(s WaitStrategy, timeout time.Duration) WaitStrategy {
+	return WaitStrategyFunc(func(ctx context.Context, r *Resource) error {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		return s.WaitUntilReady(ctx, r)
+	})
+}